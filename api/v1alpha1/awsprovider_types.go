@@ -15,29 +15,104 @@
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
-// NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
+const (
+	AWSProviderFinalizer = "hmc.mirantis.com/awsprovider"
+
+	// AWSProviderLabelKey is the label of the objects created for the
+	// AWSProvider, its value is the name of the CAPA identity objects.
+	AWSProviderLabelKey = "hmc.mirantis.com/awsprovider"
+
+	// AWSClusterStaticIdentityKind is the kind of the CAPA identity with static credentials.
+	AWSClusterStaticIdentityKind = "AWSClusterStaticIdentity"
+	// AWSClusterRoleIdentityKind is the kind of the CAPA identity assuming a role.
+	AWSClusterRoleIdentityKind = "AWSClusterRoleIdentity"
+)
+
+const (
+	// AWSIdentityReadyCondition indicates the CAPA identity objects of the
+	// AWSProvider are created.
+	AWSIdentityReadyCondition = "IdentityReady"
+	// AWSCredentialsValidCondition indicates the credentials of the AWSProvider
+	// are accepted by AWS STS and all the regions are reachable.
+	AWSCredentialsValidCondition = "CredentialsValid"
+
+	// AWSNotValidatedReason indicates the credentials of the AWSProvider are
+	// not validated, as the role is assumed with the credentials of the CAPA
+	// controller not available to HMC.
+	AWSNotValidatedReason = "NotValidated"
+)
 
 // AWSProviderSpec defines the desired state of AWSProvider
+// +kubebuilder:validation:XValidation:rule="has(self.credentialsSecretRef) || has(self.roleARN)", message="either credentialsSecretRef or roleARN must be set"
 type AWSProviderSpec struct {
-	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// CredentialsSecretRef is the reference to the Secret in the namespace of
+	// the AWSProvider with the AccessKeyID, SecretAccessKey and optionally
+	// SessionToken of the account. If RoleARN is set too, the credentials are
+	// used to assume the role.
+	// +optional
+	CredentialsSecretRef *corev1.LocalObjectReference `json:"credentialsSecretRef,omitempty"`
+	// RoleARN is the ARN of the role assumed to access the account. The role
+	// is assumed with the credentials of the Secret if set, otherwise with the
+	// credentials of the CAPA controller.
+	// +kubebuilder:validation:Pattern=`^arn:[\w-]+:iam::\d{12}:role/.+$`
+	// +optional
+	RoleARN string `json:"roleARN,omitempty"`
+	// ExternalID is the external ID required to assume the role.
+	// +optional
+	ExternalID string `json:"externalID,omitempty"`
+	// Regions is the list of the regions the clusters are allowed to be
+	// deployed to. The first region is used to validate the credentials.
+	// +kubebuilder:validation:MinItems=1
+	Regions []string `json:"regions"`
+}
 
-	// Foo is an example field of AWSProvider. Edit awsprovider_types.go to remove/update
-	Foo string `json:"foo,omitempty"`
+// AWSRegionStatus is the reachability of a region.
+type AWSRegionStatus struct {
+	// Name is the name of the region.
+	Name string `json:"name"`
+	// Reachable indicates the EC2 API of the region is reachable with the
+	// credentials of the AWSProvider.
+	Reachable bool `json:"reachable"`
+	// Message is the reason the region is not reachable.
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // AWSProviderStatus defines the observed state of AWSProvider
 type AWSProviderStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the last observed generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// IdentityRef is the reference to the CAPA identity object to set in the
+	// identityRef of the AWSClusters using the account.
+	// +optional
+	IdentityRef *corev1.TypedLocalObjectReference `json:"identityRef,omitempty"`
+	// AccountID is the ID of the account the credentials are validated for.
+	// +optional
+	AccountID string `json:"accountID,omitempty"`
+	// ARN is the ARN of the identity the credentials are validated for.
+	// +optional
+	ARN string `json:"arn,omitempty"`
+	// Regions is the reachability of the allowed regions.
+	// +optional
+	Regions []AWSRegionStatus `json:"regions,omitempty"`
+	// LastValidationTime is the time of the last validation of the credentials.
+	// +optional
+	LastValidationTime *metav1.Time `json:"lastValidationTime,omitempty"`
+	// Conditions contains details for the current state of the AWSProvider.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="account",type="string",JSONPath=".status.accountID",description="Account ID",priority=0
+// +kubebuilder:printcolumn:name="ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready",priority=0
+// +kubebuilder:printcolumn:name="status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description="Status",priority=1
 
 // AWSProvider is the Schema for the awsprovider API
 type AWSProvider struct {
@@ -48,6 +123,17 @@ type AWSProvider struct {
 	Status AWSProviderStatus `json:"status,omitempty"`
 }
 
+func (in *AWSProvider) GetConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+// IdentityName returns the name of the cluster-scoped CAPA identity objects
+// of the AWSProvider. The name is derived from the UID, so the identities of
+// the AWSProviders of different namespaces never collide.
+func (in *AWSProvider) IdentityName() string {
+	return "hmc-aws-" + string(in.UID)
+}
+
 //+kubebuilder:object:root=true
 
 // AWSProviderList contains a list of AWSProvider
@@ -14,6 +14,11 @@
 
 package v1alpha1
 
+import (
+	helmcontrollerv2 "github.com/fluxcd/helm-controller/api/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
 // Providers is a structure holding different types of CAPI providers
 type Providers struct {
 	// InfrastructureProviders is the list of CAPI infrastructure providers
@@ -23,3 +28,44 @@ type Providers struct {
 	// ControlPlaneProviders is the list of CAPI control plane providers
 	ControlPlaneProviders []string `json:"controlPlane,omitempty"`
 }
+
+const (
+	// ReconcileRequestAnnotation is the annotation of a Deployment or a Management
+	// requesting the reconciliation of their HelmReleases. Its value is an
+	// arbitrary token, such as the current time, which is propagated to the
+	// Flux reconcile, force and reset requests of the HelmReleases, so the
+	// failed releases are retried with their failure counts reset. The token
+	// is recorded in status.lastHandledReconcileAt once propagated.
+	ReconcileRequestAnnotation = "reconcile.hmc.mirantis.com/requestedAt"
+)
+
+// HelmReleaseSettings configures the HelmRelease created for a Management
+// component or a Deployment. The settings not set here use the Flux defaults.
+type HelmReleaseSettings struct {
+	// Timeout is the time to wait for any individual Kubernetes operation
+	// (like Jobs for hooks) during the performance of a Helm action.
+	// +kubebuilder:validation:Type=string
+	// +kubebuilder:validation:Pattern="^([0-9]+(\\.[0-9]+)?(ms|s|m|h))+$"
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Install holds the configuration for the Helm install action, such as the
+	// remediation retries and the CRDs policy.
+	// +optional
+	Install *helmcontrollerv2.Install `json:"install,omitempty"`
+	// Upgrade holds the configuration for the Helm upgrade action, such as the
+	// remediation retries and strategy and the CRDs policy.
+	// +optional
+	Upgrade *helmcontrollerv2.Upgrade `json:"upgrade,omitempty"`
+	// Test holds the configuration for the Helm test action.
+	// +optional
+	Test *helmcontrollerv2.Test `json:"test,omitempty"`
+	// DriftDetection holds the configuration for detecting and handling
+	// differences between the manifest in the Helm storage and the resources
+	// in the cluster.
+	// +optional
+	DriftDetection *helmcontrollerv2.DriftDetection `json:"driftDetection,omitempty"`
+	// PostRenderers holds an array of Helm PostRenderers, which will be applied
+	// in order of their definition.
+	// +optional
+	PostRenderers []helmcontrollerv2.PostRenderer `json:"postRenderers,omitempty"`
+}
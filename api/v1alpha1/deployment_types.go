@@ -34,6 +34,8 @@ const (
 	HelmChartReadyCondition = "HelmChartReady"
 	// HelmReleaseReadyCondition indicates the corresponding HelmRelease is ready and fully reconciled.
 	HelmReleaseReadyCondition = "HelmReleaseReady"
+	// ServicesReadyCondition indicates the services of the Deployment are installed into its cluster.
+	ServicesReadyCondition = "ServicesReady"
 	// ReadyCondition indicates the Deployment is ready and fully reconciled.
 	ReadyCondition string = "Ready"
 )
@@ -50,6 +52,19 @@ const (
 	// ProgressingReason indicates a condition or event observed progression, for example when the reconciliation of a
 	// resource or an action has started.
 	ProgressingReason string = "Progressing"
+
+	// DeletingReason indicates a condition or event observed the deletion of the resource and its dependents.
+	DeletingReason string = "Deleting"
+)
+
+const (
+	// DeploymentValidationClient validates the Deployment by rendering the
+	// Template chart with the provided configuration.
+	DeploymentValidationClient = "Client"
+	// DeploymentValidationServer additionally submits the rendered objects to
+	// the API server with the server-side dry-run, so they are validated
+	// against the CRD schemas and the admission webhooks.
+	DeploymentValidationServer = "Server"
 )
 
 // DeploymentSpec defines the desired state of Deployment
@@ -57,6 +72,14 @@ type DeploymentSpec struct {
 	// DryRun specifies whether the template should be applied after validation or only validated.
 	// +optional
 	DryRun bool `json:"dryRun,omitempty"`
+	// Validation is the mode of the validation of the Template with the
+	// provided configuration: Client only renders the chart, Server also
+	// submits the rendered objects to the API server with the server-side
+	// dry-run in the namespace of the Deployment.
+	// +kubebuilder:validation:Enum=Client;Server
+	// +kubebuilder:default:=Client
+	// +optional
+	Validation string `json:"validation,omitempty"`
 	// Template is a reference to a Template object located in the same namespace.
 	// +kubebuilder:validation:Required
 	Template string `json:"template"`
@@ -65,6 +88,38 @@ type DeploymentSpec struct {
 	// the template and DryRun will be enabled.
 	// +optional
 	Config *apiextensionsv1.JSON `json:"config,omitempty"`
+	// HelmRelease configures the HelmRelease of the Deployment, such as the
+	// timeout, the install and upgrade remediation and the drift detection.
+	// +optional
+	HelmRelease *HelmReleaseSettings `json:"helmRelease,omitempty"`
+	// Services is the list of the services installed into the cluster of the
+	// Deployment with its kubeconfig Secret once the cluster is created.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Services []DeploymentService `json:"services,omitempty"`
+}
+
+// DeploymentService is a Helm release installed into the cluster of a Deployment.
+type DeploymentService struct {
+	// Name is the name of the service, unique within the Deployment. The
+	// HelmRelease of the service is named after the Deployment and the service.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Template is the name of the Template of the service type in the system namespace.
+	// +kubebuilder:validation:MinLength=1
+	Template string `json:"template"`
+	// Namespace is the namespace of the cluster the service is installed to,
+	// which also stores the Helm release. It is created if missing.
+	// +kubebuilder:default:=default
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Values are the Helm values of the service.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+	// HelmRelease configures the HelmRelease of the service.
+	// +optional
+	HelmRelease *HelmReleaseSettings `json:"helmRelease,omitempty"`
 }
 
 // DeploymentStatus defines the observed state of Deployment
@@ -72,6 +127,10 @@ type DeploymentStatus struct {
 	// ObservedGeneration is the last observed generation.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastHandledReconcileAt is the value of the reconcile request annotation
+	// last propagated to the HelmRelease of the Deployment.
+	// +optional
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
 	// Conditions contains details for the current state of the Deployment
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
@@ -123,6 +182,14 @@ func (in *Deployment) InitConditions() {
 			Reason:  ProgressingReason,
 			Message: "HelmRelease is not yet ready",
 		})
+		if len(in.Spec.Services) > 0 {
+			apimeta.SetStatusCondition(in.GetConditions(), metav1.Condition{
+				Type:    ServicesReadyCondition,
+				Status:  metav1.ConditionUnknown,
+				Reason:  ProgressingReason,
+				Message: "Services are not yet ready",
+			})
+		}
 	}
 	apimeta.SetStatusCondition(in.GetConditions(), metav1.Condition{
 		Type:    ReadyCondition,
@@ -15,6 +15,9 @@
 package v1alpha1
 
 import (
+	"encoding/json"
+	"fmt"
+
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/yaml"
@@ -28,10 +31,18 @@ const (
 		"credentialsSecretName": "aws-credentials"
 	}`
 
-	ManagementName      = "hmc"
-	ManagementNamespace = "hmc-system"
+	// DefaultManagementName is the default name of the Management object.
+	DefaultManagementName = "hmc"
+	// DefaultSystemNamespace is the default namespace HMC is installed to. The
+	// Management object, Releases and all Templates are located in this namespace.
+	DefaultSystemNamespace = "hmc-system"
 
 	ManagementFinalizer = "hmc.mirantis.com/management"
+
+	// GlobalValuesKey is the key of the HMC global values in the global values
+	// of the charts. The global settings of the Management are injected into the
+	// values of the Templates declaring support for them as global.hmc.
+	GlobalValuesKey = "hmc"
 )
 
 // ManagementSpec defines the desired state of Management
@@ -42,6 +53,69 @@ type ManagementSpec struct {
 
 	// Providers is the list of supported CAPI providers.
 	Providers []Component `json:"providers,omitempty"`
+
+	// Release is the name of the Release in the templates namespace pinning
+	// the Templates of the core and provider components. The Templates of the
+	// components present in the Release are taken from the Release.
+	// +optional
+	Release string `json:"release,omitempty"`
+
+	// Global holds the settings injected into the values of all the core,
+	// provider and deployment Templates declaring support for the HMC global values.
+	// +optional
+	Global *GlobalSettings `json:"global,omitempty"`
+}
+
+// GlobalSettings holds the management-wide settings for restricted networks.
+type GlobalSettings struct {
+	// RegistryMirrors maps the original image registries, such as docker.io,
+	// to the registries their images are pulled from instead, such as registry.local/docker.io.
+	// +optional
+	RegistryMirrors map[string]string `json:"registryMirrors,omitempty"`
+	// Proxy configures the HTTP proxy used to access the external network.
+	// +optional
+	Proxy *ProxySettings `json:"proxy,omitempty"`
+	// TrustedCAs is the PEM encoded bundle of the CA certificates trusted in
+	// addition to the system ones.
+	// +optional
+	TrustedCAs string `json:"trustedCAs,omitempty"`
+}
+
+// ProxySettings configures the HTTP proxy.
+type ProxySettings struct {
+	// HTTPProxy is the proxy for HTTP requests.
+	// +optional
+	HTTPProxy string `json:"httpProxy,omitempty"`
+	// HTTPSProxy is the proxy for HTTPS requests.
+	// +optional
+	HTTPSProxy string `json:"httpsProxy,omitempty"`
+	// NoProxy is the comma-separated list of hosts, domains and CIDRs accessed without the proxy.
+	// +optional
+	NoProxy string `json:"noProxy,omitempty"`
+}
+
+// HelmValues returns the global settings as the HMC global values, i.e. nested
+// under global.hmc. Returns nil if no settings are provided.
+func (in *GlobalSettings) HelmValues() (map[string]interface{}, error) {
+	if in == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal global settings: %w", err)
+	}
+	settings := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal global settings: %w", err)
+	}
+	if len(settings) == 0 {
+		return nil, nil
+	}
+	return map[string]interface{}{
+		"global": map[string]interface{}{
+			GlobalValuesKey: settings,
+		},
+	}, nil
 }
 
 // Core represents a structure describing core Management components.
@@ -54,13 +128,31 @@ type Core struct {
 
 // Component represents HMC management component
 type Component struct {
+	// Name is the name of the component, it is also used as the name of its HelmRelease.
+	// Defaults to the name of the Template.
+	// +optional
+	Name string `json:"name,omitempty"`
 	// Template is the name of the Template associated with this component.
-	Template string `json:"template"`
+	// Can be omitted if the Template of the component is provided by the Release.
+	// +optional
+	Template string `json:"template,omitempty"`
 	// Config allows to provide parameters for management component customization.
-	// If no Config provided, the field will be populated with the default
-	// values for the template.
+	// The config is deep merged over the default values of the template and
+	// the values imposed by HMC.
 	// +optional
 	Config *apiextensionsv1.JSON `json:"config,omitempty"`
+	// HelmRelease configures the HelmRelease of the component, such as the
+	// timeout, the install and upgrade remediation and the drift detection.
+	// +optional
+	HelmRelease *HelmReleaseSettings `json:"helmRelease,omitempty"`
+}
+
+// GetName returns the name of the component, which defaults to the name of its Template.
+func (in *Component) GetName() string {
+	if in.Name != "" {
+		return in.Name
+	}
+	return in.Template
 }
 
 func (in *Component) HelmValues() (values map[string]interface{}, err error) {
@@ -70,7 +162,27 @@ func (in *Component) HelmValues() (values map[string]interface{}, err error) {
 	return values, err
 }
 
+// SetCoreDefaults sets the default core components if they are not specified.
+func (m *ManagementSpec) SetCoreDefaults() {
+	if m.Core != nil {
+		return
+	}
+	m.Core = &Core{
+		HMC: Component{
+			Template: DefaultCoreHMCTemplate,
+		},
+		CAPI: Component{
+			Template: DefaultCoreCAPITemplate,
+		},
+	}
+}
+
+// SetDefaults sets the default core components and providers if they are not specified.
 func (m *ManagementSpec) SetDefaults() {
+	m.SetCoreDefaults()
+	if m.Providers != nil {
+		return
+	}
 	m.Providers = []Component{
 		{
 			Template: "k0smotron",
@@ -91,21 +203,74 @@ type ManagementStatus struct {
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 	// AvailableProviders holds all CAPI providers available on the Management cluster.
 	AvailableProviders Providers `json:"availableProviders,omitempty"`
+	// Release is the name of the Release all the components are rolled out to.
+	// +optional
+	Release string `json:"release,omitempty"`
+	// TargetRelease is the name of the Release the components are being rolled out to.
+	// +optional
+	TargetRelease string `json:"targetRelease,omitempty"`
 	// Components indicates the status of installed HMC components and CAPI providers.
 	Components map[string]ComponentStatus `json:"components,omitempty"`
+	// Templates is the status of the sync of the default Templates.
+	// +optional
+	Templates *TemplatesSyncStatus `json:"templates,omitempty"`
+	// LastHandledReconcileAt is the value of the reconcile request annotation
+	// last propagated to the HelmReleases of the components.
+	// +optional
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+	// Conditions contains details for the current state of the Management
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// TemplatesSyncStatus is the status of the sync of the default HelmRepository
+// and the default Templates.
+type TemplatesSyncStatus struct {
+	// LastSyncTime is the time of the last successful sync.
+	// +optional
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastAttemptTime is the time of the last sync attempt.
+	// +optional
+	LastAttemptTime *metav1.Time `json:"lastAttemptTime,omitempty"`
+	// ChartVersion is the version of the hmc-templates chart in use. Empty if
+	// the Templates embedded into the HMC binary are used.
+	// +optional
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// Error is the error of the last sync attempt. Empty if it succeeded.
+	// +optional
+	Error string `json:"error,omitempty"`
+	// ConsecutiveFailures is the number of sync attempts failed in a row.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
 }
 
 // ComponentStatus is the status of Management component installation
 type ComponentStatus struct {
+	// Template is the name of the Template last applied to the component.
+	Template string `json:"template,omitempty"`
+	// ChartVersion is the version of the chart installed by the last successful release.
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// AppVersion is the version of the application installed by the last successful release.
+	AppVersion string `json:"appVersion,omitempty"`
 	// Success represents if a component installation was successful
 	Success bool `json:"success,omitempty"`
 	// Error stores as error message in case of failed installation
 	Error string `json:"error,omitempty"`
+	// Values are the effective Helm values applied to the component: the default
+	// values of the Template merged with the global values, the values imposed
+	// by HMC and the component config. Only the latter are set in the
+	// HelmRelease, the defaults are applied by Helm.
+	// +optional
+	Values *apiextensionsv1.JSON `json:"values,omitempty"`
+	// Conditions contains details for the current state of the component
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 // +kubebuilder:resource:shortName=hmc-mgmt;mgmt
+// +kubebuilder:printcolumn:name="release",type="string",JSONPath=".status.release",description="Release",priority=0
+// +kubebuilder:printcolumn:name="ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready",priority=0
+// +kubebuilder:printcolumn:name="status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description="Status",priority=1
 
 // Management is the Schema for the managements API
 type Management struct {
@@ -116,6 +281,10 @@ type Management struct {
 	Status ManagementStatus `json:"status,omitempty"`
 }
 
+func (in *Management) GetConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
 //+kubebuilder:object:root=true
 
 // ManagementList contains a list of Management
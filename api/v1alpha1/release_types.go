@@ -0,0 +1,93 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ReleaseKind is the string representation of a Release.
+	ReleaseKind = "Release"
+)
+
+// ReleaseSpec defines the desired state of Release
+type ReleaseSpec struct {
+	// Version is the version of the HMC release.
+	// +kubebuilder:validation:Required
+	Version string `json:"version"`
+	// HMC references the Template of the core HMC component.
+	HMC ReleaseTemplate `json:"hmc"`
+	// CAPI references the Template of the core Cluster API component.
+	CAPI ReleaseTemplate `json:"capi"`
+	// Providers is the list of the provider components of the release.
+	// +optional
+	Providers []ReleaseProvider `json:"providers,omitempty"`
+}
+
+// ReleaseTemplate references the Template of a core component in the Release.
+type ReleaseTemplate struct {
+	// Template is the name of the Template.
+	// +kubebuilder:validation:Required
+	Template string `json:"template"`
+}
+
+// ReleaseProvider references the Template of a provider component in the Release.
+type ReleaseProvider struct {
+	// Name is the name of the Management component.
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+	// Template is the name of the Template.
+	// +kubebuilder:validation:Required
+	Template string `json:"template"`
+}
+
+// ProviderTemplate returns the name of the Template of the provider component
+// with the given name, or an empty string if the Release does not contain it.
+func (in *ReleaseSpec) ProviderTemplate(name string) string {
+	for _, provider := range in.Providers {
+		if provider.Name == name {
+			return provider.Template
+		}
+	}
+	return ""
+}
+
+//+kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=hmc-rel
+// +kubebuilder:printcolumn:name="version",type="string",JSONPath=".spec.version",description="Version",priority=0
+// +kubebuilder:printcolumn:name="hmc",type="string",JSONPath=".spec.hmc.template",description="HMC Template",priority=1
+// +kubebuilder:printcolumn:name="capi",type="string",JSONPath=".spec.capi.template",description="Cluster API Template",priority=1
+
+// Release is the Schema for the releases API
+type Release struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ReleaseSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ReleaseList contains a list of Release
+type ReleaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Release `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Release{}, &ReleaseList{})
+}
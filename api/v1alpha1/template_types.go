@@ -22,9 +22,6 @@ import (
 )
 
 const (
-	// TemplatesNamespace is the namespace where all Templates are located
-	TemplatesNamespace = "hmc-system"
-
 	// ManagementKind is the string representation of a Management.
 	ManagementKind = "Management"
 	// TemplateKind is the string representation of a Template.
@@ -32,6 +29,8 @@ const (
 	// DeploymentKind is the string representation of a Deployment.
 	DeploymentKind = "Deployment"
 
+	// ChartAnnotationPrefix is the prefix of all chart annotations recognized by HMC.
+	ChartAnnotationPrefix = "hmc.mirantis.com/"
 	// ChartAnnotationType is an annotation containing the type of Template.
 	ChartAnnotationType = "hmc.mirantis.com/type"
 	// ChartAnnotationInfraProviders is an annotation containing the CAPI infrastructure providers associated with Template.
@@ -40,6 +39,36 @@ const (
 	ChartAnnotationBootstrapProviders = "hmc.mirantis.com/bootstrap-providers"
 	// ChartAnnotationControlPlaneProviders is an annotation containing the CAPI control plane providers associated with Template.
 	ChartAnnotationControlPlaneProviders = "hmc.mirantis.com/control-plane-providers"
+	// ChartAnnotationDependsOn is an annotation containing the Management components the Template depends on.
+	ChartAnnotationDependsOn = "hmc.mirantis.com/depends-on"
+	// ChartAnnotationGlobalValues is an annotation declaring whether the chart honors the HMC global values,
+	// see GlobalValuesKey.
+	ChartAnnotationGlobalValues = "hmc.mirantis.com/global-values"
+)
+
+const (
+	// TemplateCatalogLabelKey is the label set on the catalog ConfigMap of a Template.
+	// The value of the label is the name of the Template.
+	TemplateCatalogLabelKey = "hmc.mirantis.com/catalog"
+
+	// CatalogKeyType is the catalog ConfigMap key containing the type of the Template.
+	CatalogKeyType = "type"
+	// CatalogKeyDescription is the catalog ConfigMap key containing the chart description.
+	CatalogKeyDescription = "description"
+	// CatalogKeyVersion is the catalog ConfigMap key containing the chart version.
+	CatalogKeyVersion = "version"
+	// CatalogKeyAppVersion is the catalog ConfigMap key containing the chart appVersion.
+	CatalogKeyAppVersion = "appVersion"
+	// CatalogKeyIcon is the catalog ConfigMap key containing the chart icon URL.
+	CatalogKeyIcon = "icon"
+	// CatalogKeyKeywords is the catalog ConfigMap key containing the chart keywords as a JSON list.
+	CatalogKeyKeywords = "keywords"
+	// CatalogKeyMaintainers is the catalog ConfigMap key containing the chart maintainers as a JSON list.
+	CatalogKeyMaintainers = "maintainers"
+	// CatalogKeyReadme is the catalog ConfigMap key containing the chart README.
+	CatalogKeyReadme = "readme"
+	// CatalogKeyChangelog is the catalog ConfigMap key containing the chart CHANGELOG.
+	CatalogKeyChangelog = "changelog"
 )
 
 // TemplateType specifies the type of template packaged as a helm chart.
@@ -53,6 +82,8 @@ const (
 	TemplateTypeProvider TemplateType = "provider"
 	// TemplateTypeCore is the type used for HMC and CAPI core components
 	TemplateTypeCore TemplateType = "core"
+	// TemplateTypeService is the type used for the services installed by HMC Deployments into their clusters.
+	TemplateTypeService TemplateType = "service"
 )
 
 // TemplateSpec defines the desired state of Template
@@ -62,11 +93,16 @@ type TemplateSpec struct {
 	Helm HelmSpec `json:"helm"`
 	// Type specifies the type of the provided template.
 	// Should be set if not present in the Helm chart metadata.
-	// +kubebuilder:validation:Enum=deployment;provider;core
+	// +kubebuilder:validation:Enum=deployment;provider;core;service
 	Type TemplateType `json:"type,omitempty"`
 	// Providers represent required/exposed CAPI providers depending on the template type.
 	// Should be set if not present in the Helm chart metadata.
 	Providers Providers `json:"providers,omitempty"`
+	// DependsOn is the list of Management components the template depends on.
+	// Only used by templates of the provider type.
+	// Should be set if not present in the Helm chart metadata.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
 }
 
 // +kubebuilder:validation:XValidation:rule="(has(self.chartName) && !has(self.chartRef)) || (!has(self.chartName) && has(self.chartRef))", message="either chartName or chartRef must be set"
@@ -95,15 +131,27 @@ type TemplateStatus struct {
 	// that can be used when creating Deployment objects.
 	// +optional
 	Config *apiextensionsv1.JSON `json:"config,omitempty"`
+	// ValuesSchema is the JSON schema of the values of the Helm chart, used to
+	// validate the configuration of the template without downloading the chart.
+	// +optional
+	ValuesSchema *apiextensionsv1.JSON `json:"valuesSchema,omitempty"`
 	// ChartRef is a reference to a source controller resource containing the
 	// Helm chart representing the template.
 	// +optional
 	ChartRef *helmcontrollerv2.CrossNamespaceSourceReference `json:"chartRef,omitempty"`
 	// Type specifies the type of the provided template, as discovered from the Helm chart metadata.
-	// +kubebuilder:validation:Enum=deployment;provider;core
+	// +kubebuilder:validation:Enum=deployment;provider;core;service
 	Type TemplateType `json:"type,omitempty"`
 	// Providers represent required/exposed CAPI providers depending on the template type.
 	Providers Providers `json:"providers,omitempty"`
+	// DependsOn is the list of Management components the template depends on,
+	// as discovered from the Helm chart metadata.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
+	// GlobalValues indicates whether the chart honors the HMC global values,
+	// as declared in the Helm chart metadata.
+	// +optional
+	GlobalValues bool `json:"globalValues,omitempty"`
 	// ObservedGeneration is the last observed generation.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
@@ -115,6 +163,10 @@ type TemplateValidationStatus struct {
 	// ValidationError provides information regarding issues encountered during template validation.
 	// +optional
 	ValidationError string `json:"validationError,omitempty"`
+	// Warnings contains non-fatal issues found in the template metadata,
+	// such as unknown CAPI provider names.
+	// +optional
+	Warnings []string `json:"warnings,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,152 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1alpha1
+
+import (
+	"github.com/fluxcd/pkg/apis/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// TemplateSourceKind is the string representation of a TemplateSource.
+	TemplateSourceKind = "TemplateSource"
+
+	TemplateSourceFinalizer = "hmc.mirantis.com/template-source"
+
+	// TemplateSourceLabelKey is the label set on the objects generated from a
+	// TemplateSource. The value of the label is the name of the TemplateSource.
+	TemplateSourceLabelKey = "hmc.mirantis.com/template-source"
+
+	// TemplateSourceTypeDefault is the type of the HTTP/S Helm repository.
+	TemplateSourceTypeDefault = "default"
+	// TemplateSourceTypeOCI is the type of the OCI Helm repository.
+	TemplateSourceTypeOCI = "oci"
+)
+
+// TemplateSourceSpec defines the desired state of TemplateSource
+// +kubebuilder:validation:XValidation:rule="has(self.charts) || has(self.selector)", message="either charts or selector must be set"
+// +kubebuilder:validation:XValidation:rule="!has(self.selector) || self.type == 'default'", message="selector is only supported by the default type repositories"
+type TemplateSourceSpec struct {
+	// Type of the Helm repository: default for an HTTP/S repository or oci for an OCI registry.
+	// +kubebuilder:validation:Enum=default;oci
+	// +kubebuilder:default=oci
+	Type string `json:"type,omitempty"`
+	// URL of the Helm repository, a valid URL contains at least a protocol and host.
+	// +kubebuilder:validation:Pattern="^(http|https|oci)://.*$"
+	URL string `json:"url"`
+	// SecretRef references a Secret in the TemplateSource namespace containing
+	// the credentials of the Helm repository.
+	// +optional
+	SecretRef *meta.LocalObjectReference `json:"secretRef,omitempty"`
+	// CertSecretRef references a Secret in the TemplateSource namespace containing
+	// the CA bundle (ca.crt) and, optionally, the TLS client certificate (tls.crt)
+	// and key (tls.key) used to connect to the Helm repository.
+	// +optional
+	CertSecretRef *meta.LocalObjectReference `json:"certSecretRef,omitempty"`
+	// Insecure allows connecting to a non-TLS HTTP OCI registry.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+	// Interval at which the repository and the charts are checked for updates.
+	// Defaults to 10m.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Charts is the list of charts to import from the repository as Templates.
+	// +kubebuilder:validation:MinItems=1
+	// +optional
+	Charts []TemplateSourceChart `json:"charts,omitempty"`
+	// Selector selects the charts to import from the index of the repository,
+	// a Template is generated for each selected version of the charts. OCI
+	// registries do not provide an index, so the selector is only supported by
+	// the default type repositories.
+	// +optional
+	Selector *TemplateSourceSelector `json:"selector,omitempty"`
+}
+
+// TemplateSourceSelector selects the chart versions of the repository index.
+type TemplateSourceSelector struct {
+	// Name is the glob pattern of the chart names, e.g. aws-*. Defaults to all the charts.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Version is the semver range of the chart versions, e.g. ">=0.1.0 <1.0.0".
+	// Defaults to all the versions except the pre-releases.
+	// +optional
+	Version string `json:"version,omitempty"`
+}
+
+// TemplateSourceChart selects a chart to import from the repository.
+type TemplateSourceChart struct {
+	// Name of the chart in the repository.
+	Name string `json:"name"`
+	// Version of the chart, a semver version or range. Defaults to the latest version.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Template is the name of the Template generated for the chart.
+	// Defaults to the name of the chart.
+	// +optional
+	Template string `json:"template,omitempty"`
+}
+
+// TemplateName returns the name of the Template generated for the chart.
+func (in *TemplateSourceChart) TemplateName() string {
+	if in.Template != "" {
+		return in.Template
+	}
+	return in.Name
+}
+
+// TemplateSourceStatus defines the observed state of TemplateSource
+type TemplateSourceStatus struct {
+	// ObservedGeneration is the last observed generation.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Templates is the list of the Templates generated from the TemplateSource.
+	// +optional
+	Templates []string `json:"templates,omitempty"`
+	// Conditions contains details for the current state of the TemplateSource
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=hmc-ts;ts
+// +kubebuilder:printcolumn:name="url",type="string",JSONPath=".spec.url",description="URL",priority=0
+// +kubebuilder:printcolumn:name="ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready",priority=0
+// +kubebuilder:printcolumn:name="status",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].message",description="Status",priority=1
+
+// TemplateSource is the Schema for the templatesources API
+type TemplateSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TemplateSourceSpec   `json:"spec,omitempty"`
+	Status TemplateSourceStatus `json:"status,omitempty"`
+}
+
+func (in *TemplateSource) GetConditions() *[]metav1.Condition {
+	return &in.Status.Conditions
+}
+
+//+kubebuilder:object:root=true
+
+// TemplateSourceList contains a list of TemplateSource
+type TemplateSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TemplateSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TemplateSource{}, &TemplateSourceList{})
+}
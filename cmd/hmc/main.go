@@ -0,0 +1,160 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command hmc provides the HMC operations run outside of the management cluster.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/bundle"
+)
+
+const usage = `Usage: hmc <command> [flags]
+
+Commands:
+  bundle export   Export the default Template charts and their images to a bundle
+  bundle import   Import a bundle to a local OCI registry
+  template render Render a local Template chart without a cluster
+  template lint   Check a local Template chart before it is published
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(hmc.AddToScheme(scheme))
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:])
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return errors.New("unknown command")
+	}
+	switch args[0] + " " + args[1] {
+	case "bundle export":
+		return bundleExport(ctx, args[2:])
+	case "bundle import":
+		return bundleImport(ctx, args[2:])
+	case "template render":
+		return templateRender(ctx, args[2:])
+	case "template lint":
+		return templateLint(ctx, args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %s %s", args[0], args[1])
+	}
+}
+
+func bundleExport(ctx context.Context, args []string) error {
+	opts := bundle.ExportOptions{Log: os.Stderr}
+	var output string
+	flags := flag.NewFlagSet("bundle export", flag.ContinueOnError)
+	flags.StringVar(&output, "output", "hmc-bundle.tar.gz", "The path of the bundle.")
+	flags.StringVar(&opts.SourceRegistry, "source-registry", "oci://ghcr.io/mirantis/hmc/charts",
+		"The OCI registry the charts are pulled from.")
+	flags.BoolVar(&opts.PlainHTTP, "plain-http", false, "Access the source registry over HTTP.")
+	flags.BoolVar(&opts.Insecure, "insecure", false, "Skip the verification of the source registry certificate.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := bundle.Export(ctx, opts, f); err != nil {
+		return errors.Join(err, f.Close(), os.Remove(output))
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Bundle is written to %s\n", output)
+	return nil
+}
+
+func bundleImport(ctx context.Context, args []string) error {
+	opts := bundle.ImportOptions{Log: os.Stderr}
+	var input string
+	var updateManagement bool
+	var namespace, managementName string
+	flags := flag.NewFlagSet("bundle import", flag.ContinueOnError)
+	flags.StringVar(&input, "bundle", "hmc-bundle.tar.gz", "The path of the bundle.")
+	flags.StringVar(&opts.ChartRegistry, "chart-registry", "",
+		"The OCI registry the charts are pushed to, e.g. oci://registry.local/hmc/charts.")
+	flags.StringVar(&opts.ImageRegistry, "image-registry", "",
+		"The registry the images are pushed to. Defaults to the host of the chart registry.")
+	flags.BoolVar(&opts.PlainHTTP, "plain-http", false, "Access the target registries over HTTP.")
+	flags.BoolVar(&opts.Insecure, "insecure", false, "Skip the verification of the target registries certificates.")
+	flags.BoolVar(&updateManagement, "update-management", false,
+		"Set the default registry of HMC to the chart registry in the Management object "+
+			"of the cluster in the current kubeconfig context.")
+	flags.StringVar(&namespace, "namespace", hmc.DefaultSystemNamespace, "The namespace HMC is installed to.")
+	flags.StringVar(&managementName, "management-name", hmc.DefaultManagementName, "The name of the Management object.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	manifest, err := bundle.Import(ctx, opts, f)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d charts and %d images of HMC %s\n",
+		len(manifest.Charts), len(manifest.Images), manifest.Version)
+
+	if !updateManagement {
+		return nil
+	}
+	cfg, err := ctrl.GetConfig()
+	if err != nil {
+		return err
+	}
+	cl, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKey{Namespace: namespace, Name: managementName}
+	if err := bundle.UpdateManagement(ctx, cl, key, opts.ChartRegistry, opts.RegistryOptions); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Management %s is updated to use %s\n", key, opts.ChartRegistry)
+	return nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+
+	"github.com/Mirantis/hmc/pkg/templatechart"
+)
+
+// stringList is the flag accepting multiple values.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// renderFlags binds the flags of the rendering of a Template chart.
+type renderFlags struct {
+	values      values.Options
+	apiVersions stringList
+	opts        templatechart.RenderOptions
+}
+
+func (f *renderFlags) bind(flags *flag.FlagSet) {
+	flags.Var((*stringList)(&f.values.ValueFiles), "values", "The values file, can be repeated.")
+	flags.Var((*stringList)(&f.values.ValueFiles), "f", "Shorthand for --values.")
+	flags.Var((*stringList)(&f.values.Values), "set", "The value in the key=value format, can be repeated.")
+	flags.StringVar(&f.opts.ReleaseName, "release-name", templatechart.DefaultReleaseName,
+		"The name of the release, such as the name of the Deployment.")
+	flags.StringVar(&f.opts.Namespace, "namespace", templatechart.DefaultNamespace, "The namespace of the release.")
+	flags.StringVar(&f.opts.KubeVersion, "kube-version", "", "The Kubernetes version the chart is rendered for.")
+	flags.Var(&f.apiVersions, "api-versions", "The additional API version available to the chart, can be repeated.")
+}
+
+// parse parses the flags and returns the path of the chart given as the only
+// positional argument, which may precede the flags.
+func (f *renderFlags) parse(flags *flag.FlagSet, args []string) (string, error) {
+	var chartPath string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		chartPath, args = args[0], args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return "", err
+	}
+	if chartPath == "" && flags.NArg() > 0 {
+		// the flags following the chart path
+		chartPath = flags.Arg(0)
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return "", err
+		}
+	}
+	if chartPath == "" || flags.NArg() > 0 {
+		return "", errors.New("exactly one chart directory or archive is expected")
+	}
+	vals, err := f.values.MergeValues(getter.Providers{})
+	if err != nil {
+		return "", fmt.Errorf("failed to read values: %w", err)
+	}
+	f.opts.Values = vals
+	f.opts.APIVersions = f.apiVersions
+	return chartPath, nil
+}
+
+func templateRender(ctx context.Context, args []string) error {
+	var f renderFlags
+	flags := flag.NewFlagSet("template render", flag.ContinueOnError)
+	f.bind(flags)
+	chartPath, err := f.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	helmChart, err := templatechart.Load(chartPath)
+	if err != nil {
+		return err
+	}
+	metadata, err := templatechart.ParseMetadata(helmChart, nil)
+	if err != nil {
+		return fmt.Errorf("invalid HMC metadata: %w", err)
+	}
+	for _, warning := range metadata.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+	release, err := templatechart.Render(ctx, helmChart, f.opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, release.Manifest)
+	return nil
+}
+
+func templateLint(ctx context.Context, args []string) error {
+	var f renderFlags
+	flags := flag.NewFlagSet("template lint", flag.ContinueOnError)
+	f.bind(flags)
+	chartPath, err := f.parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	result, err := templatechart.Lint(ctx, chartPath, f.opts)
+	if err != nil {
+		return err
+	}
+	if result.Metadata != nil {
+		fmt.Fprintf(os.Stderr, "Template type: %s\n", result.Metadata.Type)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", warning)
+	}
+	for _, err := range result.Errors {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	if result.Failed() {
+		return fmt.Errorf("chart %s has %d errors", chartPath, len(result.Errors))
+	}
+	fmt.Fprintf(os.Stderr, "Chart %s is valid\n", chartPath)
+	return nil
+}
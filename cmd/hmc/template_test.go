@@ -0,0 +1,97 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/Mirantis/hmc/pkg/templatechart"
+)
+
+var _ = Describe("Template render flags", func() {
+	parse := func(args ...string) (string, *renderFlags, error) {
+		f := &renderFlags{}
+		flags := flag.NewFlagSet("template render", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		f.bind(flags)
+		chartPath, err := f.parse(flags, args)
+		return chartPath, f, err
+	}
+
+	DescribeTable("should accept the chart path before, between or after the flags",
+		func(args ...string) {
+			chartPath, f, err := parse(args...)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(chartPath).To(Equal("chart"))
+			Expect(f.opts.ReleaseName).To(Equal("cluster"))
+			Expect(f.opts.Values).To(HaveKeyWithValue("replicas", BeEquivalentTo(3)))
+		},
+		Entry("before", "chart", "--release-name", "cluster", "--set", "replicas=3"),
+		Entry("between", "--release-name=cluster", "chart", "--set", "replicas=3"),
+		Entry("after", "--release-name", "cluster", "--set", "replicas=3", "chart"),
+	)
+
+	It("should use the defaults", func() {
+		chartPath, f, err := parse("chart.tgz")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(chartPath).To(Equal("chart.tgz"))
+		Expect(f.opts).To(Equal(templatechart.RenderOptions{
+			ReleaseName: templatechart.DefaultReleaseName,
+			Namespace:   templatechart.DefaultNamespace,
+			Values:      map[string]interface{}{},
+		}))
+	})
+
+	It("should merge the values files and the values in order", func() {
+		_, f, err := parse("-f", "testdata/values.yaml", "chart", "--values", "testdata/override.yaml",
+			"--set", "replicas=5", "--set", "tags.team=core")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.opts.Values).To(Equal(map[string]interface{}{
+			"replicas": int64(5),
+			"region":   "eu-west-1",
+			"tags": map[string]interface{}{
+				"team": "core",
+				"env":  "test",
+			},
+		}))
+	})
+
+	It("should pass the capabilities", func() {
+		_, f, err := parse("chart", "--namespace", "tenant", "--kube-version", "v1.30.2",
+			"--api-versions", "infrastructure.cluster.x-k8s.io/v1beta2", "--api-versions", "cert-manager.io/v1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.opts.Namespace).To(Equal("tenant"))
+		Expect(f.opts.KubeVersion).To(Equal("v1.30.2"))
+		Expect(f.opts.APIVersions).To(Equal([]string{"infrastructure.cluster.x-k8s.io/v1beta2", "cert-manager.io/v1"}))
+	})
+
+	DescribeTable("should reject the invalid arguments",
+		func(errMsg string, args ...string) {
+			_, _, err := parse(args...)
+			Expect(err).To(MatchError(ContainSubstring(errMsg)))
+		},
+		Entry("no chart", "exactly one chart directory or archive is expected", "--set", "replicas=3"),
+		Entry("two charts", "exactly one chart directory or archive is expected", "chart", "other"),
+		Entry("two charts after the flags", "exactly one chart directory or archive is expected",
+			"--set", "replicas=3", "chart", "other"),
+		Entry("unknown flag", "flag provided but not defined: -unknown", "chart", "--unknown"),
+		Entry("missing values file", "failed to read values", "chart", "-f", "testdata/missing.yaml"),
+		Entry("invalid value", "failed to read values", "chart", "--set", "{replicas"),
+	)
+})
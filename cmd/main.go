@@ -17,7 +17,9 @@ package main
 import (
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -25,17 +27,23 @@ import (
 
 	hcv2 "github.com/fluxcd/helm-controller/api/v2"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/awsaccount"
 	"github.com/Mirantis/hmc/internal/controller"
+	"github.com/Mirantis/hmc/internal/helm"
 	hmcwebhook "github.com/Mirantis/hmc/internal/webhook"
 	//+kubebuilder:scaffold:imports
 )
@@ -60,15 +68,26 @@ func main() {
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
-	var defaultOCIRegistry string
+	var defaultRegistryURL string
 	var insecureRegistry bool
 	var registryCredentialsSecret string
+	var registryCertSecret string
+	var registryProvider string
 	var createManagement bool
 	var createTemplates bool
+	var embeddedTemplates bool
 	var hmcTemplatesChartName string
 	var enableWebhook bool
 	var webhookPort int
 	var webhookCertDir string
+	var systemNamespace string
+	var managementName string
+	var pollPeriod time.Duration
+	var errPollPeriod time.Duration
+	var maxErrPollPeriod time.Duration
+	var helmEngine string
+	var downloadOpts helm.DownloadOptions
+	var awsEndpoint string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -79,19 +98,62 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
-	flag.StringVar(&defaultOCIRegistry, "default-oci-registry", "oci://ghcr.io/mirantis/hmc/charts",
-		"The default OCI registry to download Helm charts from.")
+	flag.StringVar(&defaultRegistryURL, "default-registry-url", "oci://ghcr.io/mirantis/hmc/charts",
+		"The URL of the default registry to download Helm charts from. "+
+			"Either an oci:// URL of an OCI registry or an http(s):// URL of a Helm repository.")
+	flag.StringVar(&defaultRegistryURL, "default-oci-registry", "oci://ghcr.io/mirantis/hmc/charts",
+		"Deprecated: use --default-registry-url instead.")
 	flag.StringVar(&registryCredentialsSecret, "registry-creds-secret", "",
 		"Secret containing authentication credentials for the registry.")
-	flag.BoolVar(&insecureRegistry, "insecure-registry", false, "Allow connecting to an HTTP registry.")
+	flag.StringVar(&registryCertSecret, "registry-cert-secret", "",
+		"Secret containing the CA certificate (ca.crt) and/or the client certificate and key (tls.crt, tls.key) "+
+			"used to connect to the registry.")
+	flag.StringVar(&registryProvider, "registry-provider", "generic",
+		"The provider used to authenticate to the OCI registry: generic, aws, azure or gcp.")
+	flag.BoolVar(&insecureRegistry, "insecure-registry", false,
+		"Allow connecting to an HTTP OCI registry. HTTP Helm repositories are set with an http:// URL instead.")
 	flag.BoolVar(&createManagement, "create-management", true, "Create Management object with default configuration.")
 	flag.BoolVar(&createTemplates, "create-templates", true, "Create HMC Templates.")
+	flag.BoolVar(&embeddedTemplates, "embedded-templates", false,
+		"Create HMC Templates embedded into the binary instead of installing the HMC Templates chart. "+
+			"The charts of the Templates are pulled from the default registry.")
 	flag.StringVar(&hmcTemplatesChartName, "hmc-templates-chart-name", "hmc-templates",
 		"The name of the helm chart with HMC Templates.")
 	flag.BoolVar(&enableWebhook, "enable-webhook", true, "Enable admission webhook.")
 	flag.IntVar(&webhookPort, "webhook-port", 9443, "Admission webhook port.")
 	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
 		"Webhook cert dir, only used when webhook-port is specified.")
+	flag.StringVar(&systemNamespace, "system-namespace", hmcmirantiscomv1alpha1.DefaultSystemNamespace,
+		"The namespace HMC is installed to. The Management object, Releases and Templates are located in this namespace.")
+	flag.StringVar(&managementName, "management-name", hmcmirantiscomv1alpha1.DefaultManagementName,
+		"The name of the Management object.")
+	flag.DurationVar(&pollPeriod, "poll-period", 10*time.Minute,
+		"The period of the sync of the default HelmRepository and Templates.")
+	flag.DurationVar(&errPollPeriod, "poll-error-period", 10*time.Second,
+		"The initial delay of the sync of the default HelmRepository and Templates after a failure. "+
+			"The delay doubles with each consecutive failure.")
+	flag.DurationVar(&maxErrPollPeriod, "poll-max-error-period", 5*time.Minute,
+		"The maximum delay of the sync of the default HelmRepository and Templates after failures.")
+	flag.StringVar(&helmEngine, "helm-engine", helm.EngineFlux,
+		"The engine installing the Helm releases of the Management components and Deployments: "+
+			"flux (the Flux helm-controller) or native (the Helm SDK in the controller manager).")
+	flag.Int64Var(&downloadOpts.MaxSize, "chart-download-max-size", helm.DefaultMaxChartSize,
+		"The maximum size in bytes of the downloaded chart archives.")
+	flag.DurationVar(&downloadOpts.Timeout, "chart-download-timeout", helm.DefaultDownloadTimeout,
+		"The timeout of a single chart download request.")
+	flag.IntVar(&downloadOpts.Retries, "chart-download-retries", helm.DefaultDownloadRetries,
+		"The number of retries of a failed chart download request, negative value disables the retries.")
+	flag.DurationVar(&downloadOpts.RetryWaitMin, "chart-download-retry-wait-min", helm.DefaultDownloadRetryWaitMin,
+		"The minimum wait between the retries of a failed chart download request.")
+	flag.DurationVar(&downloadOpts.RetryWaitMax, "chart-download-retry-wait-max", helm.DefaultDownloadRetryWaitMax,
+		"The maximum wait between the retries of a failed chart download request.")
+	flag.StringVar(&downloadOpts.CAFile, "chart-download-ca-file", "",
+		"The PEM bundle of the CA certificates trusted for the chart downloads in addition to the system ones.")
+	flag.StringVar(&downloadOpts.ProxyURL, "chart-download-proxy", "",
+		"The URL of the HTTP proxy for the chart downloads, defaults to the proxy environment variables.")
+	flag.StringVar(&awsEndpoint, "aws-endpoint", "",
+		"The endpoint of the AWS STS and EC2 APIs used to validate the AWSProviders, such as the URL of a local mock. "+
+			"The regional endpoints are used if not set.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -124,8 +186,24 @@ func main() {
 			TLSOpts:       tlsOpts,
 		},
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "31c555b4.hmc.mirantis.com",
+		Cache: cache.Options{
+			ByObject: map[client.Object]cache.ByObject{
+				// only the ConfigMaps managed by HMC, such as the Template catalog entries, are
+				// watched: the other ConfigMaps are not found by the reads through the manager
+				// client and must be read with the API reader of the manager instead
+				&corev1.ConfigMap{}: {
+					Label: labels.SelectorFromSet(labels.Set{hmcmirantiscomv1alpha1.HMCManagedLabelKey: "true"}),
+				},
+			},
+		},
+		Client: client.Options{
+			Cache: &client.CacheOptions{
+				// the Secrets are read from the API server, so their data is never cached
+				DisableFor: []client.Object{&corev1.Secret{}},
+			},
+		},
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: "31c555b4.hmc.mirantis.com",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -153,45 +231,95 @@ func main() {
 		os.Exit(1)
 	}
 
+	downloader, err := helm.NewDownloader(downloadOpts)
+	if err != nil {
+		setupLog.Error(err, "invalid chart download settings")
+		os.Exit(1)
+	}
+
+	var installer helm.Installer
+	switch helmEngine {
+	case helm.EngineFlux:
+		installer = &helm.FluxInstaller{Client: mgr.GetClient()}
+	case helm.EngineNative:
+		installer = &helm.NativeInstaller{
+			Client:     mgr.GetClient(),
+			Config:     mgr.GetConfig(),
+			RESTMapper: mgr.GetRESTMapper(),
+			Puller:     &helm.ChartPuller{Client: mgr.GetClient(), Downloader: downloader},
+		}
+	default:
+		setupLog.Error(fmt.Errorf("unknown Helm engine %q", helmEngine), "invalid --helm-engine flag")
+		os.Exit(1)
+	}
+
 	if err = (&controller.TemplateReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:     mgr.GetClient(),
+		APIReader:  mgr.GetAPIReader(),
+		Scheme:     mgr.GetScheme(),
+		Downloader: downloader,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Template")
 		os.Exit(1)
 	}
 	if err = (&controller.DeploymentReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Config: mgr.GetConfig(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Config:          mgr.GetConfig(),
+		SystemNamespace: systemNamespace,
+		ManagementName:  managementName,
+		Installer:       installer,
+		Downloader:      downloader,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Deployment")
 		os.Exit(1)
 	}
 	if err = (&controller.ManagementReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Config: mgr.GetConfig(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Config:          mgr.GetConfig(),
+		SystemNamespace: systemNamespace,
+		Installer:       installer,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Management")
 		os.Exit(1)
 	}
+	if err = (&controller.TemplateSourceReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		SystemNamespace: systemNamespace,
+		Downloader:      downloader,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TemplateSource")
+		os.Exit(1)
+	}
 	if err = (&controller.AWSProviderReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		SystemNamespace: systemNamespace,
+		Validator:       &awsaccount.SDKValidator{Endpoint: awsEndpoint},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "AWSProvider")
 		os.Exit(1)
 	}
-	if err = mgr.Add(&controller.Poller{
+	if err = (&controller.Poller{
 		Client:                    mgr.GetClient(),
 		CreateManagement:          createManagement,
 		CreateTemplates:           createTemplates,
-		DefaultOCIRegistry:        defaultOCIRegistry,
+		EmbeddedTemplates:         embeddedTemplates,
+		SystemNamespace:           systemNamespace,
+		ManagementName:            managementName,
+		DefaultRegistryURL:        defaultRegistryURL,
 		RegistryCredentialsSecret: registryCredentialsSecret,
+		RegistryCertSecret:        registryCertSecret,
+		RegistryProvider:          registryProvider,
 		InsecureRegistry:          insecureRegistry,
 		HMCTemplatesChartName:     hmcTemplatesChartName,
-	}); err != nil {
+		PollPeriod:                pollPeriod,
+		ErrPollPeriod:             errPollPeriod,
+		MaxErrPollPeriod:          maxErrPollPeriod,
+		Installer:                 installer,
+	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ReleaseController")
 		os.Exit(1)
 	}
@@ -208,11 +336,17 @@ func main() {
 	}
 
 	if enableWebhook {
-		if err := (&hmcwebhook.DeploymentValidator{}).SetupWebhookWithManager(mgr); err != nil {
+		if err := (&hmcwebhook.DeploymentValidator{
+			SystemNamespace: systemNamespace,
+			HelmEngine:      helmEngine,
+		}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Deployment")
 			os.Exit(1)
 		}
-		if err := (&hmcwebhook.ManagementValidator{}).SetupWebhookWithManager(mgr); err != nil {
+		if err := (&hmcwebhook.ManagementValidator{
+			SystemNamespace: systemNamespace,
+			ManagementName:  managementName,
+		}).SetupWebhookWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "Management")
 			os.Exit(1)
 		}
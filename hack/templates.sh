@@ -20,11 +20,13 @@ set -eu
 TEMPLATES_DIR=${TEMPLATES_DIR:-templates}
 # Output directory for the generated Template manifests
 TEMPLATES_OUTPUT_DIR=${TEMPLATES_OUTPUT_DIR:-templates/hmc-templates/files/templates}
+# Output directory for the copy of the Template manifests embedded into the manager binary
+EMBEDDED_TEMPLATES_OUTPUT_DIR=${EMBEDDED_TEMPLATES_OUTPUT_DIR:-internal/templates/files}
 # The name of the HMC templates helm chart
 HMC_TEMPLATES_CHART_NAME='hmc-templates'
 
-mkdir -p $TEMPLATES_OUTPUT_DIR
-rm $TEMPLATES_OUTPUT_DIR/*.yaml
+mkdir -p $TEMPLATES_OUTPUT_DIR $EMBEDDED_TEMPLATES_OUTPUT_DIR
+rm -f $TEMPLATES_OUTPUT_DIR/*.yaml $EMBEDDED_TEMPLATES_OUTPUT_DIR/*.yaml
 
 for chart in $TEMPLATES_DIR/*; do
     if [ -d "$chart" ]; then
@@ -43,6 +45,8 @@ spec:
     chartVersion: $version
 EOF
 
+        cp $TEMPLATES_OUTPUT_DIR/$name.yaml $EMBEDDED_TEMPLATES_OUTPUT_DIR/$name.yaml
+
         echo "Generated $TEMPLATES_OUTPUT_DIR/$name.yaml"
     fi
 done
@@ -0,0 +1,139 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package awsaccount validates the credentials of the AWS accounts of the
+// AWSProviders with the AWS STS and EC2 APIs. The endpoint of the APIs can be
+// overridden, so the validation runs against a local mock of AWS.
+package awsaccount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// roleSessionName is the name of the session of the role assumed to validate
+// the account.
+const roleSessionName = "hmc-validation"
+
+// Credentials are the credentials of an AWS account.
+type Credentials struct {
+	// AccessKeyID, SecretAccessKey and SessionToken are the static
+	// credentials, required to validate the account.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN is the role assumed with the credentials, if set.
+	RoleARN string
+	// ExternalID is the external ID required to assume the role.
+	ExternalID string
+}
+
+// Identity is the identity the credentials belong to.
+type Identity struct {
+	// AccountID is the ID of the account.
+	AccountID string
+	// ARN is the ARN of the user or the assumed role.
+	ARN string
+}
+
+// Validator validates the credentials of an AWS account.
+type Validator interface {
+	// GetIdentity returns the identity of the credentials, calling the API of
+	// the region.
+	GetIdentity(ctx context.Context, creds Credentials, region string) (*Identity, error)
+	// CheckRegion returns an error if the EC2 API of the region is not
+	// reachable with the credentials.
+	CheckRegion(ctx context.Context, creds Credentials, region string) error
+}
+
+// SDKValidator is the Validator calling the AWS STS and EC2 APIs with the AWS SDK.
+type SDKValidator struct {
+	// Endpoint overrides the endpoint of the STS and EC2 APIs, such as the URL
+	// of a local mock of AWS. The endpoints of the regions are used if empty.
+	Endpoint string
+}
+
+var _ Validator = &SDKValidator{}
+
+func (v *SDKValidator) GetIdentity(ctx context.Context, creds Credentials, region string) (*Identity, error) {
+	cfg, err := v.config(creds, region)
+	if err != nil {
+		return nil, err
+	}
+	out, err := sts.NewFromConfig(cfg, v.stsOptions).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	return &Identity{AccountID: aws.ToString(out.Account), ARN: aws.ToString(out.Arn)}, nil
+}
+
+func (v *SDKValidator) CheckRegion(ctx context.Context, creds Credentials, region string) error {
+	cfg, err := v.config(creds, region)
+	if err != nil {
+		return err
+	}
+	out, err := ec2.NewFromConfig(cfg, v.ec2Options).DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{})
+	if err != nil {
+		return fmt.Errorf("failed to describe availability zones: %w", err)
+	}
+	if len(out.AvailabilityZones) == 0 {
+		return errors.New("no availability zones are available")
+	}
+	return nil
+}
+
+// config returns the configuration of the AWS clients of the region with the
+// credentials, assuming the role if it is set. The default credentials of the
+// environment are never used, as they are not the ones CAPA uses for the
+// account.
+func (v *SDKValidator) config(creds Credentials, region string) (aws.Config, error) {
+	if creds.AccessKeyID == "" {
+		return aws.Config{}, errors.New("static credentials are required to validate the account")
+	}
+	cfg := aws.Config{
+		Region: region,
+		Credentials: credentials.NewStaticCredentialsProvider(
+			creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken),
+	}
+	if creds.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg, v.stsOptions), creds.RoleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = roleSessionName
+				if creds.ExternalID != "" {
+					o.ExternalID = aws.String(creds.ExternalID)
+				}
+			})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
+
+func (v *SDKValidator) stsOptions(o *sts.Options) {
+	if v.Endpoint != "" {
+		o.BaseEndpoint = aws.String(v.Endpoint)
+	}
+}
+
+func (v *SDKValidator) ec2Options(o *ec2.Options) {
+	if v.Endpoint != "" {
+		o.BaseEndpoint = aws.String(v.Endpoint)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package awsaccount
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testAccountID = "123456789012"
+	testRoleARN   = "arn:aws:iam::123456789012:role/capa"
+	// deniedAccessKeyID is the access key the mock of AWS denies the access to.
+	deniedAccessKeyID = "AKIADENIED"
+)
+
+const getCallerIdentityResponse = `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AIDATEST</UserId>
+    <Account>` + testAccountID + `</Account>
+  </GetCallerIdentityResult>
+  <ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</GetCallerIdentityResponse>`
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2100-01-01T00:00:00Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::` + testAccountID + `:assumed-role/capa/` + roleSessionName + `</Arn>
+      <AssumedRoleId>AROATEST:` + roleSessionName + `</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>2</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`
+
+const describeAvailabilityZonesResponse = `<DescribeAvailabilityZonesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <requestId>3</requestId>
+  <availabilityZoneInfo>
+    <item><zoneName>us-east-2a</zoneName><zoneState>available</zoneState><regionName>us-east-2</regionName></item>
+  </availabilityZoneInfo>
+</DescribeAvailabilityZonesResponse>`
+
+const stsAccessDeniedResponse = `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error><Type>Sender</Type><Code>AccessDenied</Code><Message>User is not authorized to perform this operation</Message></Error>
+  <RequestId>4</RequestId>
+</ErrorResponse>`
+
+const ec2UnauthorizedResponse = `<Response>
+  <Errors><Error><Code>UnauthorizedOperation</Code><Message>You are not authorized to perform this operation.</Message></Error></Errors>
+  <RequestID>5</RequestID>
+</Response>`
+
+// awsMock is a mock of the STS and EC2 query APIs. It records the actions it
+// is called with and denies the access to the deniedAccessKeyID.
+type awsMock struct {
+	mu      sync.Mutex
+	actions []string
+	// assumed is set once the role is assumed, the later calls are made with
+	// the credentials of the role.
+	assumed bool
+}
+
+func (m *awsMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	Expect(r.ParseForm()).To(Succeed())
+	action := r.PostForm.Get("Action")
+
+	m.mu.Lock()
+	m.actions = append(m.actions, action)
+	if action == "AssumeRole" {
+		Expect(r.PostForm.Get("RoleArn")).To(Equal(testRoleARN))
+		Expect(r.PostForm.Get("RoleSessionName")).To(Equal(roleSessionName))
+		m.assumed = true
+	}
+	assumed := m.assumed
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	if strings.Contains(r.Header.Get("Authorization"), "Credential="+deniedAccessKeyID+"/") {
+		w.WriteHeader(http.StatusForbidden)
+		if action == "DescribeAvailabilityZones" {
+			_, _ = w.Write([]byte(ec2UnauthorizedResponse))
+		} else {
+			_, _ = w.Write([]byte(stsAccessDeniedResponse))
+		}
+		return
+	}
+	switch action {
+	case "GetCallerIdentity":
+		arn := "arn:aws:iam::" + testAccountID + ":user/hmc"
+		if assumed {
+			arn = "arn:aws:sts::" + testAccountID + ":assumed-role/capa/" + roleSessionName
+		}
+		_, _ = fmt.Fprintf(w, getCallerIdentityResponse, arn)
+	case "AssumeRole":
+		_, _ = w.Write([]byte(assumeRoleResponse))
+	case "DescribeAvailabilityZones":
+		_, _ = w.Write([]byte(describeAvailabilityZonesResponse))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+var _ = Describe("SDKValidator", func() {
+	ctx := context.Background()
+
+	var mock *awsMock
+	var validator *SDKValidator
+
+	BeforeEach(func() {
+		mock = &awsMock{}
+		server := httptest.NewServer(mock)
+		DeferCleanup(server.Close)
+		validator = &SDKValidator{Endpoint: server.URL}
+	})
+
+	It("should validate the static credentials against the endpoint", func() {
+		creds := Credentials{AccessKeyID: "AKIATEST", SecretAccessKey: "secret"}
+
+		identity, err := validator.GetIdentity(ctx, creds, "us-east-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity).To(Equal(&Identity{
+			AccountID: testAccountID,
+			ARN:       "arn:aws:iam::" + testAccountID + ":user/hmc",
+		}))
+		Expect(validator.CheckRegion(ctx, creds, "us-east-2")).To(Succeed())
+		Expect(mock.actions).To(Equal([]string{"GetCallerIdentity", "DescribeAvailabilityZones"}))
+	})
+
+	It("should assume the role with the static credentials", func() {
+		creds := Credentials{AccessKeyID: "AKIATEST", SecretAccessKey: "secret", RoleARN: testRoleARN}
+
+		identity, err := validator.GetIdentity(ctx, creds, "us-east-2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(identity.ARN).To(Equal("arn:aws:sts::" + testAccountID + ":assumed-role/capa/" + roleSessionName))
+		Expect(mock.actions).To(Equal([]string{"AssumeRole", "GetCallerIdentity"}))
+	})
+
+	It("should report the access denied by AWS", func() {
+		creds := Credentials{AccessKeyID: deniedAccessKeyID, SecretAccessKey: "secret"}
+
+		_, err := validator.GetIdentity(ctx, creds, "us-east-2")
+		Expect(err).To(MatchError(And(ContainSubstring("failed to get caller identity"), ContainSubstring("AccessDenied"))))
+		err = validator.CheckRegion(ctx, creds, "us-east-2")
+		Expect(err).To(MatchError(And(ContainSubstring("failed to describe availability zones"), ContainSubstring("UnauthorizedOperation"))))
+	})
+
+	It("should require the static credentials", func() {
+		_, err := validator.GetIdentity(ctx, Credentials{}, "us-east-2")
+		Expect(err).To(MatchError("static credentials are required to validate the account"))
+		Expect(mock.actions).To(BeEmpty())
+	})
+})
@@ -0,0 +1,226 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bundle exports the charts of the default HMC Templates and the
+// container images they reference into a single tarball and imports such a
+// tarball into a local OCI registry, so HMC can be installed without access to
+// the public registries.
+//
+// The tarball contains the manifest file, the chart archives in the charts
+// directory and the images in the OCI image layout in the images directory.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/pkg/content"
+	"oras.land/oras-go/pkg/oras"
+	"oras.land/oras-go/pkg/target"
+)
+
+const (
+	manifestFile = "bundle.json"
+	chartsDir    = "charts"
+	imagesDir    = "images"
+)
+
+// Manifest describes the content of a bundle.
+type Manifest struct {
+	// Version is the HMC version the bundle is exported for.
+	Version string `json:"version"`
+	// Charts are the chart archives of the bundle.
+	Charts []Chart `json:"charts"`
+	// Images are the references of the container images of the bundle, as
+	// found in the chart manifests.
+	Images []string `json:"images"`
+}
+
+// Chart describes a chart archive of a bundle.
+type Chart struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Path is the path of the chart archive relative to the bundle root.
+	Path string `json:"path"`
+}
+
+// RegistryOptions configures the connection to an OCI registry.
+type RegistryOptions struct {
+	// PlainHTTP makes the registry accessed over HTTP.
+	PlainHTTP bool
+	// Insecure skips the verification of the registry TLS certificate.
+	Insecure bool
+}
+
+func (o RegistryOptions) chartClient() (*registry.Client, error) {
+	opts := []registry.ClientOption{registry.ClientOptWriter(io.Discard)}
+	if o.PlainHTTP {
+		opts = append(opts, registry.ClientOptPlainHTTP())
+	}
+	if o.Insecure {
+		opts = append(opts, registry.ClientOptHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // explicitly requested by the user
+			},
+		}))
+	}
+	return registry.NewClient(opts...)
+}
+
+func (o RegistryOptions) imageRegistry() (*content.Registry, error) {
+	return content.NewRegistry(content.RegistryOptions{
+		PlainHTTP: o.PlainHTTP,
+		Insecure:  o.Insecure,
+	})
+}
+
+// chartRef returns the reference of the chart in the OCI registry with the
+// registryURL such as oci://ghcr.io/mirantis/hmc/charts.
+func chartRef(registryURL, name, version string) string {
+	host := strings.TrimPrefix(registryURL, registry.OCIScheme+"://")
+	return fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(host, "/"), name, version)
+}
+
+// copyImage copies the image with all of its platforms between the targets.
+// Docker manifests are not tagged by the OCI layout store, so the reference is
+// added explicitly.
+func copyImage(ctx context.Context, from, to target.Target, fromRef, toRef string) error {
+	desc, err := oras.Copy(ctx, from, fromRef, to, toRef,
+		oras.WithAdditionalCachedMediaTypes(images.MediaTypeDockerSchema2Manifest, images.MediaTypeDockerSchema2ManifestList))
+	if err != nil {
+		return err
+	}
+	if store, ok := to.(*content.OCI); ok {
+		store.AddReference(toRef, desc)
+		return store.SaveIndex()
+	}
+	return nil
+}
+
+// writeArchive writes the content of the dir to w as a gzipped tarball.
+func writeArchive(dir string, w io.Writer) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(tw.Close(), gw.Close())
+}
+
+// readArchive extracts the gzipped tarball read from r to the dir.
+func readArchive(r io.Reader, dir string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %s in the bundle", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(path, tr); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s in the bundle", header.Name)
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r) //nolint:gosec // the bundle is provided by the user
+	return errors.Join(err, f.Close())
+}
+
+func readManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the bundle manifest: %w", err)
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the bundle manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFile), data, 0o644)
+}
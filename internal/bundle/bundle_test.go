@@ -0,0 +1,101 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// archive returns a gzipped tarball of the regular files with the contents.
+func archive(files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		Expect(tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+		})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(tw.Close()).To(Succeed())
+	Expect(gw.Close()).To(Succeed())
+	return buf
+}
+
+var _ = DescribeTable("Chart reference",
+	func(registryURL, expected string) {
+		Expect(chartRef(registryURL, "hmc", "0.0.2")).To(Equal(expected))
+	},
+	Entry("OCI URL", "oci://registry.local/hmc/charts", "registry.local/hmc/charts/hmc:0.0.2"),
+	Entry("trailing slash", "oci://registry.local/charts/", "registry.local/charts/hmc:0.0.2"),
+	Entry("registry host only", "oci://registry.local:5000", "registry.local:5000/hmc:0.0.2"),
+)
+
+var _ = Describe("Bundle archive", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should extract the archive written from a directory", func() {
+		src := GinkgoT().TempDir()
+		Expect(os.MkdirAll(filepath.Join(src, "charts"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(src, "charts", "hmc-0.0.2.tgz"), []byte("chart"), 0o644)).To(Succeed())
+		Expect(writeManifest(src, &Manifest{Version: "0.0.2", Charts: []Chart{{Name: "hmc", Version: "0.0.2", Path: "charts/hmc-0.0.2.tgz"}}})).To(Succeed())
+
+		buf := &bytes.Buffer{}
+		Expect(writeArchive(src, buf)).To(Succeed())
+		Expect(readArchive(buf, dir)).To(Succeed())
+
+		Expect(os.ReadFile(filepath.Join(dir, "charts", "hmc-0.0.2.tgz"))).To(Equal([]byte("chart")))
+		manifest, err := readManifest(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.Version).To(Equal("0.0.2"))
+		Expect(manifest.Charts).To(HaveLen(1))
+	})
+
+	DescribeTable("should reject the paths outside of the directory",
+		func(name string) {
+			err := readArchive(archive(map[string]string{name: "evil"}), dir)
+			Expect(err).To(MatchError(ContainSubstring("invalid path")))
+			Expect(filepath.Join(filepath.Dir(dir), "evil")).NotTo(BeAnExistingFile())
+		},
+		Entry("parent directory", "../evil"),
+		Entry("nested parent directory", "charts/../../evil"),
+	)
+
+	It("should reject the unsupported entries", func() {
+		buf := &bytes.Buffer{}
+		gw := gzip.NewWriter(buf)
+		tw := tar.NewWriter(gw)
+		Expect(tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})).To(Succeed())
+		Expect(tw.Close()).To(Succeed())
+		Expect(gw.Close()).To(Succeed())
+
+		Expect(readArchive(buf, dir)).To(MatchError(ContainSubstring("unsupported entry link")))
+	})
+})
@@ -0,0 +1,133 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"oras.land/oras-go/pkg/content"
+
+	"github.com/Mirantis/hmc/internal/build"
+	"github.com/Mirantis/hmc/internal/templates"
+)
+
+// ExportOptions configures the bundle export.
+type ExportOptions struct {
+	// RegistryOptions configures the connection to the SourceRegistry.
+	RegistryOptions
+	// SourceRegistry is the OCI registry the charts are pulled from.
+	SourceRegistry string
+	// Log receives the progress of the export.
+	Log io.Writer
+}
+
+// Export pulls the charts of the default Templates embedded into the binary from
+// the source registry and the container images referenced by the charts, and
+// writes them to w as a bundle.
+func Export(ctx context.Context, opts ExportOptions, w io.Writer) error {
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	dir, err := os.MkdirTemp("", "hmc-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, chartsDir), 0o755); err != nil {
+		return err
+	}
+
+	defaultTemplates, err := templates.Templates()
+	if err != nil {
+		return err
+	}
+	chartClient, err := opts.chartClient()
+	if err != nil {
+		return fmt.Errorf("failed to create registry client: %w", err)
+	}
+
+	manifest := &Manifest{Version: build.Version}
+	seenCharts := make(map[string]struct{})
+	seenImages := make(map[string]struct{})
+	for _, template := range defaultTemplates {
+		name, version := template.Spec.Helm.ChartName, template.Spec.Helm.ChartVersion
+		if name == "" {
+			// the chart is not served by the registry
+			continue
+		}
+		ref := chartRef(opts.SourceRegistry, name, version)
+		if _, ok := seenCharts[ref]; ok {
+			continue
+		}
+		seenCharts[ref] = struct{}{}
+
+		fmt.Fprintf(opts.Log, "Pulling chart %s\n", ref)
+		result, err := chartClient.Pull(ref)
+		if err != nil {
+			return fmt.Errorf("failed to pull chart %s: %w", ref, err)
+		}
+		path := filepath.Join(chartsDir, fmt.Sprintf("%s-%s.tgz", name, version))
+		if err := os.WriteFile(filepath.Join(dir, path), result.Chart.Data, 0o644); err != nil {
+			return err
+		}
+		manifest.Charts = append(manifest.Charts, Chart{Name: name, Version: version, Path: filepath.ToSlash(path)})
+
+		helmChart, err := loader.LoadArchive(bytes.NewReader(result.Chart.Data))
+		if err != nil {
+			return fmt.Errorf("failed to load chart %s: %w", ref, err)
+		}
+		images, err := chartImages(helmChart)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			if _, ok := seenImages[image]; ok {
+				continue
+			}
+			seenImages[image] = struct{}{}
+			manifest.Images = append(manifest.Images, image)
+		}
+	}
+	sort.Strings(manifest.Images)
+
+	store, err := content.NewOCI(filepath.Join(dir, imagesDir))
+	if err != nil {
+		return err
+	}
+	// the images are pulled from their public registries, so the options of
+	// the source registry are not applied
+	imageRegistry, err := RegistryOptions{}.imageRegistry()
+	if err != nil {
+		return err
+	}
+	for _, image := range manifest.Images {
+		fmt.Fprintf(opts.Log, "Pulling image %s\n", image)
+		if err := copyImage(ctx, imageRegistry, store, image, image); err != nil {
+			return fmt.Errorf("failed to pull image %s: %w", image, err)
+		}
+	}
+
+	if err := writeManifest(dir, manifest); err != nil {
+		return err
+	}
+	return writeArchive(dir, w)
+}
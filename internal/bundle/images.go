@@ -0,0 +1,92 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/reference/docker"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+// chartImages renders the chart with the default values and returns the
+// normalized references of the container images found in the manifests.
+func chartImages(c *chart.Chart) ([]string, error) {
+	values, err := chartutil.ToRenderValues(c, c.Values, chartutil.ReleaseOptions{
+		Name:      c.Name(),
+		Namespace: hmc.DefaultSystemNamespace,
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build values of the chart %s: %w", c.Name(), err)
+	}
+	rendered, err := engine.Render(c, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render the chart %s: %w", c.Name(), err)
+	}
+
+	found := make(map[string]struct{})
+	for name, content := range rendered {
+		if !strings.HasSuffix(name, ".yaml") && !strings.HasSuffix(name, ".yml") {
+			continue
+		}
+		for _, manifest := range releaseutil.SplitManifests(content) {
+			var obj interface{}
+			if err := yaml.Unmarshal([]byte(manifest), &obj); err != nil {
+				return nil, fmt.Errorf("failed to parse %s of the chart %s: %w", name, c.Name(), err)
+			}
+			collectImages(obj, found)
+		}
+	}
+
+	images := make([]string, 0, len(found))
+	for image := range found {
+		ref, err := docker.ParseDockerRef(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %s in the chart %s: %w", image, c.Name(), err)
+		}
+		images = append(images, ref.String())
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// collectImages adds the values of all the image fields of the obj to found.
+func collectImages(obj interface{}, found map[string]struct{}) {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if image, ok := value.(string); ok && key == "image" {
+				if image = strings.TrimSpace(image); image != "" {
+					found[image] = struct{}{}
+				}
+				continue
+			}
+			collectImages(value, found)
+		}
+	case []interface{}:
+		for _, value := range v {
+			collectImages(value, found)
+		}
+	}
+}
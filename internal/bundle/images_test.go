@@ -0,0 +1,56 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/yaml"
+)
+
+var _ = Describe("Chart images", func() {
+	It("should collect the image fields of the nested objects and lists", func() {
+		var obj interface{}
+		Expect(yaml.Unmarshal([]byte(`
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: " busybox:1.36 "
+      containers:
+      - name: manager
+        image: registry.k8s.io/cluster-api/cluster-api-controller:v1.7.2
+      - name: sidecar
+        image: registry.k8s.io/cluster-api/cluster-api-controller:v1.7.2
+      - name: empty
+        image: ""
+metadata:
+  annotations:
+    image: ghcr.io/mirantis/hmc:0.0.2
+  labels:
+    image:
+      name: not-an-image
+`), &obj)).To(Succeed())
+
+		found := make(map[string]struct{})
+		collectImages(obj, found)
+		Expect(found).To(HaveLen(3))
+		Expect(found).To(HaveKey("busybox:1.36"))
+		Expect(found).To(HaveKey("registry.k8s.io/cluster-api/cluster-api-controller:v1.7.2"))
+		Expect(found).To(HaveKey("ghcr.io/mirantis/hmc:0.0.2"))
+	})
+})
@@ -0,0 +1,199 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/reference/docker"
+	"helm.sh/helm/v3/pkg/registry"
+	"oras.land/oras-go/pkg/content"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
+)
+
+// ImportOptions configures the bundle import.
+type ImportOptions struct {
+	// RegistryOptions configures the connection to the target registries.
+	RegistryOptions
+	// ChartRegistry is the OCI registry the charts are pushed to, such as
+	// oci://registry.local/hmc/charts.
+	ChartRegistry string
+	// ImageRegistry is the registry the images are pushed to, such as
+	// registry.local. The source registry host is kept as the path prefix, for
+	// example docker.io/library/busybox:1.36 is pushed as
+	// registry.local/docker.io/library/busybox:1.36, which matches the layout
+	// of the global.hmc.registryMirrors values. Defaults to the host of the
+	// ChartRegistry.
+	ImageRegistry string
+	// Log receives the progress of the import.
+	Log io.Writer
+}
+
+// Import pushes the charts and the images of the bundle read from r to the
+// target registries and returns the manifest of the bundle.
+func Import(ctx context.Context, opts ImportOptions, r io.Reader) (*Manifest, error) {
+	if opts.Log == nil {
+		opts.Log = io.Discard
+	}
+	if !strings.HasPrefix(opts.ChartRegistry, registry.OCIScheme+"://") {
+		return nil, fmt.Errorf("chart registry %q must be an %s:// URL", opts.ChartRegistry, registry.OCIScheme)
+	}
+	if opts.ImageRegistry == "" {
+		opts.ImageRegistry, _, _ = strings.Cut(strings.TrimPrefix(opts.ChartRegistry, registry.OCIScheme+"://"), "/")
+	}
+
+	dir, err := os.MkdirTemp("", "hmc-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := readArchive(r, dir); err != nil {
+		return nil, fmt.Errorf("failed to extract the bundle: %w", err)
+	}
+	manifest, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	chartClient, err := opts.chartClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client: %w", err)
+	}
+	for _, c := range manifest.Charts {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(c.Path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chart %s: %w", c.Name, err)
+		}
+		ref := chartRef(opts.ChartRegistry, c.Name, c.Version)
+		fmt.Fprintf(opts.Log, "Pushing chart %s\n", ref)
+		if _, err := chartClient.Push(data, ref); err != nil {
+			return nil, fmt.Errorf("failed to push chart %s: %w", ref, err)
+		}
+	}
+
+	store, err := content.NewOCI(filepath.Join(dir, imagesDir))
+	if err != nil {
+		return nil, err
+	}
+	imageRegistry, err := opts.imageRegistry()
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range manifest.Images {
+		ref, err := LocalImage(opts.ImageRegistry, image)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(opts.Log, "Pushing image %s\n", ref)
+		if err := copyImage(ctx, store, imageRegistry, image, ref); err != nil {
+			return nil, fmt.Errorf("failed to push image %s: %w", ref, err)
+		}
+	}
+	return manifest, nil
+}
+
+// LocalImage returns the reference of the image in the local registry, which
+// is prefixed with the host of the original registry and keeps the path and
+// the tag of the original reference. Images referenced by digest are pushed by
+// digest only.
+func LocalImage(imageRegistry, image string) (string, error) {
+	named, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %s: %w", image, err)
+	}
+	ref := strings.TrimSuffix(imageRegistry, "/") + "/" + docker.Domain(named) + "/" + docker.Path(named)
+	if tagged, ok := named.(docker.Tagged); ok {
+		ref += ":" + tagged.Tag()
+	}
+	return ref, nil
+}
+
+// UpdateManagement sets the default registry of the HMC controller manager
+// in the config of the hmc core component of the Management, so the default
+// HelmRepository is reconciled with the registry the bundle is imported to.
+// The embedded Templates are enabled as well, since the bundle does not
+// contain the hmc-templates chart installing them.
+func UpdateManagement(ctx context.Context, cl client.Client, key client.ObjectKey, chartRegistry string, opts RegistryOptions) error {
+	mgmt := &hmc.Management{}
+	if err := cl.Get(ctx, key, mgmt); err != nil {
+		return fmt.Errorf("failed to get Management %s: %w", key, err)
+	}
+	if mgmt.Spec.Core == nil {
+		mgmt.Spec.SetCoreDefaults()
+	}
+	component := &mgmt.Spec.Core.HMC
+	values, err := helm.ParseHMCValues(component.Config)
+	if err != nil {
+		return err
+	}
+	if len(values.ManagerArgs()) == 0 {
+		// lists are replaced on merge, so the default arguments of the chart
+		// are kept
+		args, err := defaultManagerArgs(ctx, cl, mgmt)
+		if err != nil {
+			return err
+		}
+		values.SetManagerArgs(args)
+	}
+	// the deprecated argument is removed, so it does not override the new one
+	values.RemoveManagerArg("--default-oci-registry")
+	values.SetManagerArg("--default-registry-url", chartRegistry)
+	values.SetManagerArg("--embedded-templates", "true")
+	if opts.PlainHTTP || opts.Insecure {
+		values.SetManagerArg("--insecure-registry", "true")
+	}
+	if err := values.Validate(); err != nil {
+		return fmt.Errorf("invalid HMC config: %w", err)
+	}
+	if component.Config, err = values.JSON(); err != nil {
+		return err
+	}
+	if err := cl.Update(ctx, mgmt); err != nil {
+		return fmt.Errorf("failed to update Management %s: %w", key, err)
+	}
+	return nil
+}
+
+// defaultManagerArgs returns the default controller manager arguments of the
+// chart of the Template the hmc core component is installed from.
+func defaultManagerArgs(ctx context.Context, cl client.Client, mgmt *hmc.Management) ([]string, error) {
+	component := mgmt.Spec.Core.HMC
+	name := component.GetName()
+	if name == "" {
+		name = hmc.DefaultCoreHMCTemplate
+	}
+	templateName := mgmt.Status.Components[name].Template
+	if templateName == "" {
+		templateName = component.Template
+	}
+	template := &hmc.Template{}
+	key := client.ObjectKey{Namespace: mgmt.Namespace, Name: templateName}
+	if err := cl.Get(ctx, key, template); err != nil {
+		return nil, fmt.Errorf("failed to get Template %s: %w", key, err)
+	}
+	defaults, err := helm.ParseHMCValues(template.Status.Config)
+	if err != nil {
+		return nil, err
+	}
+	return defaults.ManagerArgs(), nil
+}
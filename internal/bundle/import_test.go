@@ -0,0 +1,122 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
+)
+
+var _ = DescribeTable("Local image reference",
+	func(image, expected string) {
+		ref, err := LocalImage("registry.local:5000/", image)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ref).To(Equal(expected))
+	},
+	Entry("Docker Hub short name", "busybox:1.36", "registry.local:5000/docker.io/library/busybox:1.36"),
+	Entry("Docker Hub without tag", "docker.io/library/busybox", "registry.local:5000/docker.io/library/busybox:latest"),
+	Entry("other registry", "registry.k8s.io/cluster-api/cluster-api-controller:v1.7.2",
+		"registry.local:5000/registry.k8s.io/cluster-api/cluster-api-controller:v1.7.2"),
+	Entry("registry with port", "registry.example.com:443/hmc/controller:0.0.2",
+		"registry.local:5000/registry.example.com:443/hmc/controller:0.0.2"),
+	Entry("digest", "ghcr.io/mirantis/hmc@sha256:"+"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+		"registry.local:5000/ghcr.io/mirantis/hmc"),
+)
+
+var _ = Describe("Local image validation", func() {
+	It("should reject the invalid references", func() {
+		_, err := LocalImage("registry.local", "Invalid:Image")
+		Expect(err).To(MatchError(ContainSubstring("invalid image Invalid:Image")))
+	})
+})
+
+var _ = Describe("Management update", func() {
+	ctx := context.Background()
+	key := client.ObjectKey{Namespace: hmc.DefaultSystemNamespace, Name: hmc.DefaultManagementName}
+	const chartRegistry = "oci://registry.local/hmc/charts"
+
+	var cl client.Client
+
+	managerArgs := func() []string {
+		mgmt := &hmc.Management{}
+		Expect(cl.Get(ctx, key, mgmt)).To(Succeed())
+		values, err := helm.ParseHMCValues(mgmt.Spec.Core.HMC.Config)
+		Expect(err).NotTo(HaveOccurred())
+		return values.ManagerArgs()
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(hmc.AddToScheme(scheme)).To(Succeed())
+		cl = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+			&hmc.Management{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}},
+			&hmc.Template{
+				ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: hmc.DefaultCoreHMCTemplate},
+				Status: hmc.TemplateStatus{
+					Config: &apiextensionsv1.JSON{Raw: []byte(
+						`{"controllerManager":{"manager":{"args":["--default-oci-registry=oci://ghcr.io/mirantis/hmc/charts","--create-management=true"]}}}`,
+					)},
+				},
+			},
+		).Build()
+	})
+
+	It("should keep the default arguments of the chart", func() {
+		Expect(UpdateManagement(ctx, cl, key, chartRegistry, RegistryOptions{})).To(Succeed())
+		Expect(managerArgs()).To(Equal([]string{
+			"--create-management=true",
+			"--default-registry-url=" + chartRegistry,
+			"--embedded-templates=true",
+		}))
+	})
+
+	It("should override the arguments set in the config", func() {
+		mgmt := &hmc.Management{}
+		Expect(cl.Get(ctx, key, mgmt)).To(Succeed())
+		mgmt.Spec.SetCoreDefaults()
+		mgmt.Spec.Core.HMC.Config = &apiextensionsv1.JSON{Raw: []byte(
+			`{"admissionWebhook":{"enabled":false},"controllerManager":{"manager":{"args":["--default-registry-url=oci://other","--embedded-templates=false"]}}}`,
+		)}
+		Expect(cl.Update(ctx, mgmt)).To(Succeed())
+
+		Expect(UpdateManagement(ctx, cl, key, chartRegistry, RegistryOptions{PlainHTTP: true})).To(Succeed())
+		Expect(managerArgs()).To(Equal([]string{
+			"--default-registry-url=" + chartRegistry,
+			"--embedded-templates=true",
+			"--insecure-registry=true",
+		}))
+
+		Expect(cl.Get(ctx, key, mgmt)).To(Succeed())
+		Expect(string(mgmt.Spec.Core.HMC.Config.Raw)).To(ContainSubstring(`"admissionWebhook":{"enabled":false}`))
+	})
+
+	It("should fail if the Template of the hmc component is missing", func() {
+		Expect(cl.Delete(ctx, &hmc.Template{ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace, Name: hmc.DefaultCoreHMCTemplate,
+		}})).To(Succeed())
+		Expect(UpdateManagement(ctx, cl, key, chartRegistry, RegistryOptions{})).To(
+			MatchError(ContainSubstring("failed to get Template")))
+	})
+})
@@ -0,0 +1,93 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/fluxcd/pkg/apis/meta"
+)
+
+// addDependencies adds the given components to the dependencies of the component.
+func (c *component) addDependencies(names ...string) {
+	for _, name := range names {
+		if name == c.Name || slices.ContainsFunc(c.dependsOn, func(ref meta.NamespacedObjectReference) bool {
+			return ref.Name == name
+		}) {
+			continue
+		}
+		c.dependsOn = append(c.dependsOn, meta.NamespacedObjectReference{Name: name})
+	}
+}
+
+// sortComponents orders the components so that every component goes after the
+// components it depends on, keeping the original order otherwise. Components
+// depending on components missing in the Management spec, or forming a
+// dependency cycle, are returned in errs and excluded from the result.
+func sortComponents(components []component) (sorted []component, errs map[string]error) {
+	errs = make(map[string]error)
+	known := make(map[string]struct{}, len(components))
+	for _, c := range components {
+		known[c.Name] = struct{}{}
+	}
+	for _, c := range components {
+		for _, dep := range c.dependsOn {
+			if _, ok := known[dep.Name]; !ok {
+				errs[c.Name] = fmt.Errorf("component %s depends on %s which is not in the Management spec", c.Name, dep.Name)
+			}
+		}
+	}
+
+	done := make(map[string]struct{}, len(components))
+	for progress := true; progress; {
+		progress = false
+		for _, c := range components {
+			if _, ok := done[c.Name]; ok {
+				continue
+			}
+			if _, ok := errs[c.Name]; ok {
+				continue
+			}
+			ready := true
+			for _, dep := range c.dependsOn {
+				if _, ok := done[dep.Name]; !ok {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, c)
+				done[c.Name] = struct{}{}
+				progress = true
+			}
+		}
+	}
+
+	var cycle []string
+	for _, c := range components {
+		_, isDone := done[c.Name]
+		_, hasErr := errs[c.Name]
+		if !isDone && !hasErr {
+			cycle = append(cycle, c.Name)
+		}
+	}
+	for _, name := range cycle {
+		errs[name] = fmt.Errorf("component %s is blocked by a dependency cycle or a failed dependency among: %s",
+			name, strings.Join(cycle, ", "))
+	}
+	return sorted, errs
+}
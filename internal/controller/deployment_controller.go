@@ -16,8 +16,11 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	hcv2 "github.com/fluxcd/helm-controller/api/v2"
@@ -25,24 +28,41 @@ import (
 	fluxconditions "github.com/fluxcd/pkg/runtime/conditions"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	"github.com/go-logr/logr"
-	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
 
 	hmc "github.com/Mirantis/hmc/api/v1alpha1"
 	"github.com/Mirantis/hmc/internal/helm"
 	"github.com/Mirantis/hmc/internal/telemetry"
+	"github.com/Mirantis/hmc/pkg/templatechart"
+)
+
+const (
+	// dryRunFieldOwner is the field manager of the objects submitted with the
+	// server-side dry-run during the validation of a Deployment.
+	dryRunFieldOwner = "hmc-validation"
+	// kubeConfigSecretSuffix is the suffix of the name of the Cluster API
+	// Secret with the kubeconfig of the cluster named after the Deployment.
+	kubeConfigSecretSuffix = "-kubeconfig"
+	// kubeConfigSecretKey is the key of the kubeconfig in the Secret.
+	kubeConfigSecretKey = "value"
 )
 
 // DeploymentReconciler reconciles a Deployment object
@@ -50,6 +70,15 @@ type DeploymentReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Config *rest.Config
+	// SystemNamespace is the namespace HMC is installed to.
+	SystemNamespace string
+	// ManagementName is the name of the Management object.
+	ManagementName string
+	// Installer installs the releases of the Deployments, defaults to the Flux
+	// helm-controller.
+	Installer helm.Installer
+	// Downloader downloads the charts of the Deployments.
+	Downloader *helm.Downloader
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -75,7 +104,7 @@ func (r *DeploymentReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	if deployment.Status.ObservedGeneration == 0 {
 		mgmt := &hmc.Management{}
-		mgmtRef := types.NamespacedName{Namespace: hmc.ManagementNamespace, Name: hmc.ManagementName}
+		mgmtRef := types.NamespacedName{Namespace: r.SystemNamespace, Name: r.ManagementName}
 		if err := r.Get(ctx, mgmtRef, mgmt); err != nil {
 			l.Error(err, "Failed to get Management object")
 			return ctrl.Result{}, err
@@ -105,7 +134,7 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 	}()
 
 	template := &hmc.Template{}
-	templateRef := types.NamespacedName{Name: deployment.Spec.Template, Namespace: hmc.TemplatesNamespace}
+	templateRef := types.NamespacedName{Name: deployment.Spec.Template, Namespace: r.SystemNamespace}
 	if err := r.Get(ctx, templateRef, template); err != nil {
 		l.Error(err, "Failed to get Template")
 		errMsg := fmt.Sprintf("failed to get provided template: %s", err)
@@ -158,7 +187,7 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 		return ctrl.Result{}, err
 	}
 	l.Info("Downloading Helm chart")
-	hcChart, err := helm.DownloadChartFromArtifact(ctx, source.GetArtifact())
+	hcChart, err := r.Downloader.DownloadChartFromArtifact(ctx, source.GetArtifact())
 	if err != nil {
 		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
 			Type:    hmc.HelmChartReadyCondition,
@@ -169,16 +198,19 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 		return ctrl.Result{}, err
 	}
 
-	l.Info("Initializing Helm client")
-	getter := helm.NewMemoryRESTClientGetter(r.Config, r.RESTMapper())
-	actionConfig := new(action.Configuration)
-	err = actionConfig.Init(getter, deployment.Namespace, "secret", l.Info)
+	values, err := r.helmValues(ctx, deployment, template)
 	if err != nil {
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.HelmChartReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: fmt.Sprintf("failed to build values: %s", err),
+		})
 		return ctrl.Result{}, err
 	}
 
 	l.Info("Validating Helm chart with provided values")
-	if err := r.validateReleaseWithValues(ctx, actionConfig, deployment, hcChart); err != nil {
+	if err := r.validateReleaseWithValues(ctx, deployment, hcChart, values); err != nil {
 		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
 			Type:    hmc.HelmChartReadyCondition,
 			Status:  metav1.ConditionFalse,
@@ -203,8 +235,14 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 			UID:        deployment.UID,
 		}
 
-		hr, _, err := helm.ReconcileHelmRelease(ctx, r.Client, deployment.Name, deployment.Namespace, deployment.Spec.Config,
-			ownerRef, template.Status.ChartRef, defaultReconcileInterval, nil)
+		hr, err := installOwnedRelease(ctx, installerOrDefault(r.Installer, r.Client), deployment, deployment.Name,
+			helm.WithValues(values),
+			helm.WithOwnerReference(ownerRef),
+			helm.WithChartRef(template.Status.ChartRef),
+			helm.WithReconcileInterval(defaultReconcileInterval),
+			helm.WithSettings(deployment.Spec.HelmRelease),
+			helm.WithReconcileRequest(deployment.Annotations[hmc.ReconcileRequestAnnotation]),
+		)
 		if err != nil {
 			apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
 				Type:    hmc.HelmReleaseReadyCondition,
@@ -214,6 +252,9 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 			})
 			return ctrl.Result{}, err
 		}
+		if token := deployment.Annotations[hmc.ReconcileRequestAnnotation]; token != "" {
+			deployment.Status.LastHandledReconcileAt = token
+		}
 
 		hrReadyCondition := fluxconditions.Get(hr, fluxmeta.ReadyCondition)
 		if hrReadyCondition != nil {
@@ -227,25 +268,280 @@ func (r *DeploymentReconciler) Update(ctx context.Context, l logr.Logger, deploy
 		if !fluxconditions.IsReady(hr) {
 			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
 		}
+
+		ready, err := r.reconcileServices(ctx, deployment, ownerRef)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !ready {
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
 	}
 	return ctrl.Result{}, nil
 }
 
-func (r *DeploymentReconciler) validateReleaseWithValues(ctx context.Context, actionConfig *action.Configuration, deployment *hmc.Deployment, hcChart *chart.Chart) error {
-	install := action.NewInstall(actionConfig)
-	install.DryRun = true
-	install.ReleaseName = deployment.Name
-	install.Namespace = deployment.Namespace
-	install.ClientOnly = true
+// reconcileServices installs the services of the Deployment into its cluster
+// and uninstalls the services removed from the spec. It returns whether all
+// the services are ready.
+func (r *DeploymentReconciler) reconcileServices(ctx context.Context, deployment *hmc.Deployment, ownerRef *metav1.OwnerReference) (bool, error) {
+	installer := installerOrDefault(r.Installer, r.Client)
+	if len(deployment.Spec.Services) > 0 && !usesFlux(installer) {
+		// the services are installed into the clusters of the Deployments
+		err := errors.New("services are not supported by the native Helm engine")
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.ServicesReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err.Error(),
+		})
+		return false, err
+	}
+	desired := make(map[string]bool, len(deployment.Spec.Services))
+	var errs error
+	var notReady []string
+	for _, svc := range deployment.Spec.Services {
+		desired[serviceReleaseName(deployment, svc.Name)] = true
+		hr, err := r.installService(ctx, installer, deployment, svc, ownerRef)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("service %s: %w", svc.Name, err))
+			continue
+		}
+		if !fluxconditions.IsReady(hr) {
+			msg := svc.Name
+			if hrReadyCondition := fluxconditions.Get(hr, fluxmeta.ReadyCondition); hrReadyCondition != nil {
+				msg += ": " + hrReadyCondition.Message
+			}
+			notReady = append(notReady, msg)
+		}
+	}
+	remaining, err := r.uninstallServices(ctx, deployment, desired)
+	errs = errors.Join(errs, err)
+
+	switch {
+	case errs != nil:
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.ServicesReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: errs.Error(),
+		})
+		return false, errs
+	case len(notReady) > 0:
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.ServicesReadyCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  hmc.ProgressingReason,
+			Message: "Services are not yet ready: " + strings.Join(notReady, "; "),
+		})
+		return false, nil
+	case remaining > 0:
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.ServicesReadyCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  hmc.DeletingReason,
+			Message: fmt.Sprintf("%d removed services are being uninstalled", remaining),
+		})
+		return false, nil
+	case len(deployment.Spec.Services) == 0:
+		apimeta.RemoveStatusCondition(deployment.GetConditions(), hmc.ServicesReadyCondition)
+	default:
+		apimeta.SetStatusCondition(deployment.GetConditions(), metav1.Condition{
+			Type:    hmc.ServicesReadyCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  hmc.SucceededReason,
+			Message: "Services are ready",
+		})
+	}
+	return true, nil
+}
+
+// installService installs the service into the cluster of the Deployment with
+// the kubeConfig Secret created by Cluster API. The HelmRelease depends on the
+// HelmRelease of the cluster and stores the release in the target namespace.
+func (r *DeploymentReconciler) installService(ctx context.Context, installer helm.Installer, deployment *hmc.Deployment, svc hmc.DeploymentService, ownerRef *metav1.OwnerReference) (*hcv2.HelmRelease, error) {
+	template := &hmc.Template{}
+	templateRef := types.NamespacedName{Name: svc.Template, Namespace: r.SystemNamespace}
+	if err := r.Get(ctx, templateRef, template); err != nil {
+		return nil, fmt.Errorf("failed to get Template %s: %w", templateRef, err)
+	}
+	if template.Status.Type != hmc.TemplateTypeService {
+		return nil, fmt.Errorf("only templates of '%s' type are supported, %s is of '%s' type",
+			hmc.TemplateTypeService, svc.Template, template.Status.Type)
+	}
+	if !template.Status.Valid {
+		return nil, fmt.Errorf("template %s is not marked as valid", svc.Template)
+	}
 
-	vals, err := deployment.HelmValues()
+	namespace := svc.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	return installOwnedRelease(ctx, installer, deployment, serviceReleaseName(deployment, svc.Name),
+		helm.WithValues(svc.Values),
+		helm.WithOwnerReference(ownerRef),
+		helm.WithChartRef(template.Status.ChartRef),
+		helm.WithReconcileInterval(defaultReconcileInterval),
+		helm.WithDependsOn([]fluxmeta.NamespacedObjectReference{{Name: deployment.Name}}),
+		helm.WithKubeConfig(deployment.Name+kubeConfigSecretSuffix, kubeConfigSecretKey),
+		helm.WithTargetNamespace(namespace),
+		helm.WithStorageNamespace(namespace),
+		helm.WithSettings(svc.HelmRelease),
+		func(hr *hcv2.HelmRelease) {
+			// the target namespace may not exist in the new cluster
+			install := hr.Spec.Install.DeepCopy()
+			if install == nil {
+				install = &hcv2.Install{}
+			}
+			install.CreateNamespace = true
+			hr.Spec.Install = install
+		},
+		helm.WithReconcileRequest(deployment.Annotations[hmc.ReconcileRequestAnnotation]),
+	)
+}
+
+// uninstallServices uninstalls the services of the Deployment whose
+// HelmReleases are not desired. It returns the number of such services still
+// installed.
+func (r *DeploymentReconciler) uninstallServices(ctx context.Context, deployment *hmc.Deployment, desired map[string]bool) (int, error) {
+	installer := installerOrDefault(r.Installer, r.Client)
+	releases, err := installer.List(ctx, deployment.Namespace)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	remaining := 0
+	var errs error
+	for _, hr := range releases {
+		if hr.Name == deployment.Name || desired[hr.Name] || !ownedBy(&hr, deployment.UID) {
+			continue
+		}
+		remaining++
+		if err := installer.Uninstall(ctx, hr.Name, hr.Namespace); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to uninstall service %s: %w", hr.Name, err))
+		}
+	}
+	return remaining, errs
+}
+
+// serviceReleaseName returns the name of the HelmRelease of the service.
+func serviceReleaseName(deployment *hmc.Deployment, service string) string {
+	return deployment.Name + "-" + service
+}
+
+// installOwnedRelease installs the release of the Deployment unless the
+// HelmRelease with the name exists and is not owned by the Deployment. Such
+// HelmRelease belongs to another object whose release name collides, e.g. the
+// Deployment foo-bar and the service bar of the Deployment foo.
+func installOwnedRelease(ctx context.Context, installer helm.Installer, deployment *hmc.Deployment, name string, opts ...helm.ReleaseOption) (*hcv2.HelmRelease, error) {
+	hr, err := installer.Get(ctx, name, deployment.Namespace)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to get HelmRelease %s/%s: %w", deployment.Namespace, name, err)
+	case !ownedBy(hr, deployment.UID):
+		return nil, fmt.Errorf("HelmRelease %s/%s already exists and is not owned by the Deployment", deployment.Namespace, name)
+	}
+	return installer.Install(ctx, name, deployment.Namespace, opts...)
+}
+
+// ownedBy returns whether the object is owned by the object with the UID.
+func ownedBy(obj metav1.Object, uid types.UID) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// helmValues returns the config of the Deployment merged over the global values
+// of the Management if the Template supports them.
+func (r *DeploymentReconciler) helmValues(ctx context.Context, deployment *hmc.Deployment, template *hmc.Template) (*apiextensionsv1.JSON, error) {
+	if !template.Status.GlobalValues {
+		return deployment.Spec.Config, nil
+	}
+	mgmt := &hmc.Management{}
+	mgmtRef := types.NamespacedName{Namespace: r.SystemNamespace, Name: r.ManagementName}
+	if err := r.Get(ctx, mgmtRef, mgmt); err != nil {
+		return nil, fmt.Errorf("failed to get Management %s: %w", mgmtRef, err)
 	}
-	_, err = install.RunWithContext(ctx, hcChart, vals)
+	globalValues, err := mgmt.Spec.Global.HelmValues()
+	if err != nil || globalValues == nil {
+		return deployment.Spec.Config, err
+	}
+	config, err := deployment.HelmValues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	raw, err := json.Marshal(helm.MergeValues(globalValues, config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	return &apiextensionsv1.JSON{Raw: raw}, nil
+}
+
+func (r *DeploymentReconciler) validateReleaseWithValues(ctx context.Context, deployment *hmc.Deployment, hcChart *chart.Chart, values *apiextensionsv1.JSON) error {
+	var vals map[string]interface{}
+	if values != nil {
+		if err := json.Unmarshal(values.Raw, &vals); err != nil {
+			return err
+		}
+	}
+	release, err := templatechart.Render(ctx, hcChart, templatechart.RenderOptions{
+		ReleaseName: deployment.Name,
+		Namespace:   deployment.Namespace,
+		Values:      vals,
+	})
 	if err != nil {
 		return err
 	}
+	if deployment.Spec.Validation == hmc.DeploymentValidationServer {
+		return r.validateServerSide(ctx, deployment.Namespace, release.Manifest)
+	}
+	return nil
+}
+
+// validateServerSide submits the objects of the rendered manifest to the API
+// server with the server-side dry-run, so they are validated against the CRD
+// schemas and the admission webhooks. The namespaced objects without namespace
+// are submitted to the given namespace. The errors are reported per object.
+func (r *DeploymentReconciler) validateServerSide(ctx context.Context, namespace, manifest string) error {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for key := range manifests {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var errs []string
+	for _, key := range keys {
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(manifests[key]), &obj.Object); err != nil {
+			return fmt.Errorf("failed to parse rendered manifest: %w", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		gvk := obj.GroupVersionKind()
+		mapping, err := r.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s %s: %s", gvk.Kind, obj.GetName(), err))
+			continue
+		}
+		if mapping.Scope.Name() == apimeta.RESTScopeNameNamespace && obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+		err = r.Patch(ctx, obj, client.Apply, client.DryRunAll, client.ForceOwnership, client.FieldOwner(dryRunFieldOwner))
+		if err != nil {
+			ref := obj.GetName()
+			if obj.GetNamespace() != "" {
+				ref = obj.GetNamespace() + "/" + ref
+			}
+			errs = append(errs, fmt.Sprintf("%s %s: %s", gvk.Kind, ref, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
 	return nil
 }
 
@@ -300,11 +596,18 @@ func (r *DeploymentReconciler) getSource(ctx context.Context, ref *hcv2.CrossNam
 }
 
 func (r *DeploymentReconciler) Delete(ctx context.Context, l logr.Logger, deployment *hmc.Deployment) (ctrl.Result, error) {
-	hr := &hcv2.HelmRelease{}
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      deployment.Name,
-		Namespace: deployment.Namespace,
-	}, hr)
+	// the services are uninstalled while the cluster still exists
+	remaining, err := r.uninstallServices(ctx, deployment, nil)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if remaining > 0 {
+		l.Info("Services are still being uninstalled, retrying", "count", remaining)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	installer := installerOrDefault(r.Installer, r.Client)
+	_, err = installer.Get(ctx, deployment.Name, deployment.Namespace)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			l.Info("Removing Finalizer", "finalizer", hmc.DeploymentFinalizer)
@@ -319,7 +622,7 @@ func (r *DeploymentReconciler) Delete(ctx context.Context, l logr.Logger, deploy
 		}
 		return ctrl.Result{}, err
 	}
-	err = helm.DeleteHelmRelease(ctx, r.Client, deployment.Name, deployment.Namespace)
+	err = installer.Uninstall(ctx, deployment.Name, deployment.Namespace)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
@@ -329,8 +632,31 @@ func (r *DeploymentReconciler) Delete(ctx context.Context, l logr.Logger, deploy
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&hmc.Deployment{}).
+		Watches(&hmc.Management{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []ctrl.Request {
+				// the global values of the Management are injected into the Deployments
+				if o.GetName() != r.ManagementName || o.GetNamespace() != r.SystemNamespace {
+					return nil
+				}
+				deployments := &hmc.DeploymentList{}
+				if err := r.Client.List(ctx, deployments); err != nil {
+					return nil
+				}
+				requests := make([]ctrl.Request, 0, len(deployments.Items))
+				for _, deployment := range deployments.Items {
+					requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&deployment)})
+				}
+				return requests
+			}),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		)
+	if !usesFlux(installerOrDefault(r.Installer, r.Client)) {
+		// the Deployments are polled until their releases are ready
+		return b.Complete(r)
+	}
+	return b.
 		Watches(&hcv2.HelmRelease{},
 			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []ctrl.Request {
 				deployment := hmc.Deployment{}
@@ -338,6 +664,13 @@ func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 					Namespace: o.GetNamespace(),
 					Name:      o.GetName(),
 				}
+				// the HelmReleases of the services are owned by the Deployment
+				for _, ref := range o.GetOwnerReferences() {
+					if ref.Kind == hmc.DeploymentKind {
+						deploymentRef.Name = ref.Name
+						break
+					}
+				}
 				err := r.Client.Get(ctx, deploymentRef, &deployment)
 				if err != nil {
 					return []ctrl.Request{}
@@ -23,11 +23,13 @@ import (
 	v1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
 )
 
 var _ = Describe("Deployment Controller", func() {
@@ -48,11 +50,11 @@ var _ = Describe("Deployment Controller", func() {
 
 		BeforeEach(func() {
 			By("creating hmc-system namespace")
-			err := k8sClient.Get(ctx, types.NamespacedName{Name: hmc.ManagementNamespace}, namespace)
+			err := k8sClient.Get(ctx, types.NamespacedName{Name: hmc.DefaultSystemNamespace}, namespace)
 			if err != nil && errors.IsNotFound(err) {
 				namespace = &v1.Namespace{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: hmc.ManagementNamespace,
+						Name: hmc.DefaultSystemNamespace,
 					},
 				}
 				Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
@@ -64,7 +66,7 @@ var _ = Describe("Deployment Controller", func() {
 				template = &hmc.Template{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      templateName,
-						Namespace: hmc.TemplatesNamespace,
+						Namespace: hmc.DefaultSystemNamespace,
 					},
 					Spec: hmc.TemplateSpec{
 						Helm: hmc.HelmSpec{
@@ -93,8 +95,8 @@ var _ = Describe("Deployment Controller", func() {
 			if err != nil && errors.IsNotFound(err) {
 				management = &hmc.Management{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      hmc.ManagementName,
-						Namespace: hmc.ManagementNamespace,
+						Name:      hmc.DefaultManagementName,
+						Namespace: hmc.DefaultSystemNamespace,
 					},
 					Spec: hmc.ManagementSpec{},
 				}
@@ -126,8 +128,10 @@ var _ = Describe("Deployment Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &DeploymentReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: hmc.DefaultSystemNamespace,
+				ManagementName:  hmc.DefaultManagementName,
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -139,3 +143,140 @@ var _ = Describe("Deployment Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("Deployment server-side validation", func() {
+	It("should report the invalid objects", func() {
+		reconciler := &DeploymentReconciler{Client: k8sClient}
+		ctx := context.Background()
+
+		valid := `---
+# Source: test/templates/configmap.yaml
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+data:
+  key: value
+`
+		Expect(reconciler.validateServerSide(ctx, "default", valid)).To(Succeed())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "valid"}, &v1.ConfigMap{})).
+			To(MatchError(ContainSubstring("not found")))
+
+		invalid := valid + `---
+# Source: test/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: invalid
+spec:
+  ports:
+  - port: 100000
+---
+# Source: test/templates/unknown.yaml
+apiVersion: unknown.hmc.mirantis.com/v1
+kind: Unknown
+metadata:
+  name: unknown
+`
+		err := reconciler.validateServerSide(ctx, "default", invalid)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("Service default/invalid:"))
+		Expect(err.Error()).To(ContainSubstring("Unknown unknown:"))
+		Expect(err.Error()).NotTo(ContainSubstring("ConfigMap"))
+	})
+})
+
+var _ = Describe("Deployment services", func() {
+	It("should install the services into the cluster of the Deployment", func() {
+		ctx := context.Background()
+		reconciler := &DeploymentReconciler{Client: k8sClient, SystemNamespace: "default"}
+
+		template := &hmc.Template{
+			ObjectMeta: metav1.ObjectMeta{Name: "service-template", Namespace: "default"},
+			Spec: hmc.TemplateSpec{
+				Helm: hmc.HelmSpec{ChartName: "ingress-nginx"},
+			},
+		}
+		Expect(k8sClient.Create(ctx, template)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, template)
+		template.Status = hmc.TemplateStatus{
+			TemplateValidationStatus: hmc.TemplateValidationStatus{Valid: true},
+			Type:                     hmc.TemplateTypeService,
+			ChartRef: &hcv2.CrossNamespaceSourceReference{
+				Kind:      "HelmChart",
+				Name:      "service-template",
+				Namespace: "default",
+			},
+		}
+		Expect(k8sClient.Status().Update(ctx, template)).To(Succeed())
+
+		deployment := &hmc.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", UID: "cluster-uid"},
+		}
+		ownerRef := &metav1.OwnerReference{
+			APIVersion: hmc.GroupVersion.String(),
+			Kind:       hmc.DeploymentKind,
+			Name:       deployment.Name,
+			UID:        deployment.UID,
+		}
+		svc := hmc.DeploymentService{Name: "ingress", Template: template.Name, Namespace: "ingress-nginx"}
+		_, err := reconciler.installService(ctx, installerOrDefault(nil, k8sClient), deployment, svc, ownerRef)
+		Expect(err).NotTo(HaveOccurred())
+
+		hr := &hcv2.HelmRelease{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cluster-ingress"}, hr)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, hr)
+		Expect(hr.Spec.KubeConfig).NotTo(BeNil())
+		Expect(hr.Spec.KubeConfig.SecretRef.Name).To(Equal("cluster-kubeconfig"))
+		Expect(hr.Spec.KubeConfig.SecretRef.Key).To(Equal("value"))
+		Expect(hr.Spec.TargetNamespace).To(Equal("ingress-nginx"))
+		Expect(hr.Spec.StorageNamespace).To(Equal("ingress-nginx"))
+		Expect(hr.Spec.DependsOn).To(HaveLen(1))
+		Expect(hr.Spec.DependsOn[0].Name).To(Equal("cluster"))
+		Expect(hr.Spec.Install).NotTo(BeNil())
+		Expect(hr.Spec.Install.CreateNamespace).To(BeTrue())
+
+		By("rejecting the missing templates")
+		svc.Template = "missing"
+		_, err = reconciler.installService(ctx, installerOrDefault(nil, k8sClient), deployment, svc, ownerRef)
+		Expect(err).To(HaveOccurred())
+
+		By("refusing to take over the HelmRelease of another Deployment with the same name")
+		other := &hmc.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-ingress", Namespace: "default", UID: "other-uid"},
+		}
+		_, err = reconciler.installService(ctx, installerOrDefault(nil, k8sClient), other,
+			hmc.DeploymentService{Name: "ingress", Template: template.Name}, &metav1.OwnerReference{
+				APIVersion: hmc.GroupVersion.String(),
+				Kind:       hmc.DeploymentKind,
+				Name:       other.Name,
+				UID:        other.UID,
+			})
+		Expect(err).NotTo(HaveOccurred())
+		otherHR := &hcv2.HelmRelease{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cluster-ingress-ingress"}, otherHR)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, otherHR)
+
+		_, err = installOwnedRelease(ctx, installerOrDefault(nil, k8sClient), other, other.Name)
+		Expect(err).To(MatchError("HelmRelease default/cluster-ingress already exists and is not owned by the Deployment"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "cluster-ingress"}, hr)).To(Succeed())
+		Expect(hr.OwnerReferences).To(HaveLen(1))
+		Expect(hr.OwnerReferences[0].UID).To(Equal(deployment.UID))
+	})
+
+	It("should reject the services with the native Helm engine", func() {
+		reconciler := &DeploymentReconciler{Client: k8sClient, Installer: &helm.NativeInstaller{}}
+		deployment := &hmc.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+			Spec: hmc.DeploymentSpec{
+				Services: []hmc.DeploymentService{{Name: "ingress", Template: "service-template"}},
+			},
+		}
+		ready, err := reconciler.reconcileServices(context.Background(), deployment, nil)
+		Expect(err).To(MatchError("services are not supported by the native Helm engine"))
+		Expect(ready).To(BeFalse())
+		condition := apimeta.FindStatusCondition(deployment.Status.Conditions, hmc.ServicesReadyCondition)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+	})
+})
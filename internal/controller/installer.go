@@ -0,0 +1,37 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/Mirantis/hmc/internal/helm"
+)
+
+// installerOrDefault returns the installer of the releases, which defaults to
+// the Flux helm-controller.
+func installerOrDefault(installer helm.Installer, cl client.Client) helm.Installer {
+	if installer == nil {
+		return &helm.FluxInstaller{Client: cl}
+	}
+	return installer
+}
+
+// usesFlux returns true if the releases are installed by the Flux
+// helm-controller, so the HelmRelease objects can be watched.
+func usesFlux(installer helm.Installer) bool {
+	_, ok := installer.(*helm.FluxInstaller)
+	return ok
+}
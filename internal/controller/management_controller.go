@@ -19,9 +19,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
 	"github.com/fluxcd/pkg/apis/meta"
+	fluxconditions "github.com/fluxcd/pkg/runtime/conditions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -29,6 +36,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	hmc "github.com/Mirantis/hmc/api/v1alpha1"
@@ -41,6 +49,11 @@ type ManagementReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Config *rest.Config
+	// SystemNamespace is the namespace HMC is installed to.
+	SystemNamespace string
+	// Installer installs the releases of the components, defaults to the Flux
+	// helm-controller.
+	Installer helm.Installer
 }
 
 func (r *ManagementReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -76,10 +89,14 @@ func (r *ManagementReconciler) Update(ctx context.Context, management *hmc.Manag
 		return ctrl.Result{}, nil
 	}
 
-	// TODO: this should be implemented in admission controller instead
-	if changed := applyDefaultCoreConfiguration(management); changed {
+	if management.Spec.Core == nil {
+		// the core components are defaulted by the admission webhook, which may be disabled
 		l.Info("Applying default core configuration")
-		return ctrl.Result{}, r.Client.Update(ctx, management)
+		management.Spec.SetCoreDefaults()
+		if err := r.Client.Update(ctx, management); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update Management %s/%s: %w", management.Namespace, management.Name, err)
+		}
+		return ctrl.Result{}, nil
 	}
 
 	ownerRef := &metav1.OwnerReference{
@@ -93,147 +110,753 @@ func (r *ManagementReconciler) Update(ctx context.Context, management *hmc.Manag
 	detectedProviders := hmc.Providers{}
 	detectedComponents := make(map[string]hmc.ComponentStatus)
 
-	err := r.enableAdmissionWebhook(ctx, management)
+	release, err := r.getRelease(ctx, management)
 	if err != nil {
-		l.Error(err, "failed to enable admission webhook")
-		return ctrl.Result{}, err
+		l.Error(err, "failed to get Release")
+		management.Status.TargetRelease = management.Spec.Release
+		apimeta.SetStatusCondition(management.GetConditions(), metav1.Condition{
+			Type:    hmc.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, errors.Join(err, r.Status().Update(ctx, management))
 	}
 
-	components := wrappedComponents(management)
+	installer := installerOrDefault(r.Installer, r.Client)
+	components := wrappedComponents(management, release)
+	if !usesFlux(installer) {
+		// the native engine would replace the pod running the upgrade of the
+		// HMC release, which is therefore upgraded with Helm by the user
+		components[0].observed = true
+	}
+	globalValues, err := management.Spec.Global.HelmValues()
+	if err == nil {
+		// the HMC core component always goes first
+		err = r.configureHMC(ctx, &components[0])
+	}
+	if err != nil {
+		l.Error(err, "failed to configure components")
+		apimeta.SetStatusCondition(management.GetConditions(), metav1.Condition{
+			Type:    hmc.ReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, errors.Join(err, r.Status().Update(ctx, management))
+	}
 	for _, component := range components {
+		// keep the conditions to preserve their transition time
+		if status, ok := management.Status.Components[component.Name]; ok {
+			detectedComponents[component.Name] = hmc.ComponentStatus{Template: status.Template, Conditions: status.Conditions}
+		}
+	}
+	templates := make(map[string]*hmc.Template, len(components))
+	for i, component := range components {
+		if component.Template == "" {
+			errMsg := fmt.Sprintf("Template of the component %s is neither specified nor provided by the Release", component.Name)
+			updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, "", hmc.TemplateStatus{}, nil, errMsg)
+			errs = errors.Join(errs, errors.New(errMsg))
+			continue
+		}
 		template := &hmc.Template{}
 		err := r.Get(ctx, types.NamespacedName{
-			Namespace: hmc.TemplatesNamespace,
+			Namespace: r.SystemNamespace,
 			Name:      component.Template,
 		}, template)
 		if err != nil {
-			errMsg := fmt.Sprintf("Failed to get Template %s/%s: %s", hmc.TemplatesNamespace, component.Template, err)
-			updateComponentsStatus(detectedComponents, &detectedProviders, component.Template, template.Status, errMsg)
-			errs = errors.Join(fmt.Errorf(errMsg))
+			errMsg := fmt.Sprintf("Failed to get Template %s/%s: %s", r.SystemNamespace, component.Template, err)
+			updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, component.Template, template.Status, nil, errMsg)
+			errs = errors.Join(errs, errors.New(errMsg))
 			continue
 		}
 		if !template.Status.Valid {
-			errMsg := fmt.Sprintf("Template %s/%s is not marked as valid", hmc.TemplatesNamespace, component.Template)
-			updateComponentsStatus(detectedComponents, &detectedProviders, component.Template, template.Status, errMsg)
-			errs = errors.Join(fmt.Errorf(errMsg))
+			errMsg := fmt.Sprintf("Template %s/%s is not marked as valid", r.SystemNamespace, component.Template)
+			updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, component.Template, template.Status, nil, errMsg)
+			errs = errors.Join(errs, errors.New(errMsg))
+			continue
+		}
+		templates[component.Name] = template
+		if template.Status.Type == hmc.TemplateTypeProvider {
+			components[i].addDependencies(template.Status.DependsOn...)
+		}
+	}
+
+	sortedComponents, dependencyErrs := sortComponents(components)
+	for name, err := range dependencyErrs {
+		template, ok := templates[name]
+		if !ok {
+			// the template error is already reported
 			continue
 		}
+		updateComponentsStatus(detectedComponents, &detectedProviders, name, template.Name, template.Status, nil, err.Error())
+		errs = errors.Join(errs, err)
+	}
+
+	// rolledOut contains the components successfully installed from their target Templates
+	rolledOut := make(map[string]bool, len(sortedComponents))
+	reconcileRequest := management.Annotations[hmc.ReconcileRequestAnnotation]
+	reconcileRequestHandled := true
+	for _, component := range sortedComponents {
+		template, ok := templates[component.Name]
+		if !ok {
+			continue
+		}
+		if previous := detectedComponents[component.Name].Template; previous != "" && previous != template.Name {
+			// the component is upgraded only after all its dependencies are rolled out
+			if pending := pendingDependencies(component, rolledOut); len(pending) > 0 {
+				previousTemplate := &hmc.Template{}
+				err := r.Get(ctx, types.NamespacedName{Namespace: r.SystemNamespace, Name: previous}, previousTemplate)
+				if err == nil && previousTemplate.Status.Valid {
+					l.Info("Holding the component until its dependencies are rolled out",
+						"component", component.Name, "template", previous, "dependencies", pending)
+					template = previousTemplate
+				}
+			}
+		}
 
-		_, _, err = helm.ReconcileHelmRelease(ctx, r.Client, component.Template, management.Namespace, component.Config,
-			ownerRef, template.Status.ChartRef, defaultReconcileInterval, component.dependsOn)
+		values, err := releaseValues(component, template, globalValues)
+		var effective *apiextensionsv1.JSON
+		if err == nil {
+			effective, err = effectiveValues(template, values)
+		}
 		if err != nil {
-			errMsg := fmt.Sprintf("error reconciling HelmRelease %s/%s: %s", management.Namespace, component.Template, err)
-			updateComponentsStatus(detectedComponents, &detectedProviders, component.Template, template.Status, errMsg)
-			errs = errors.Join(fmt.Errorf(errMsg))
+			errMsg := fmt.Sprintf("failed to merge values of the component %s: %s", component.Name, err)
+			updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, template.Name, template.Status, nil, errMsg)
+			errs = errors.Join(errs, errors.New(errMsg))
 			continue
 		}
-		updateComponentsStatus(detectedComponents, &detectedProviders, component.Template, template.Status, "")
+		var hr *hcv2.HelmRelease
+		if component.observed {
+			hr, err = installer.Get(ctx, component.Name, management.Namespace)
+		} else {
+			hr, err = installer.Install(ctx, component.Name, management.Namespace,
+				helm.WithValues(values),
+				helm.WithOwnerReference(ownerRef),
+				helm.WithChartRef(template.Status.ChartRef),
+				helm.WithReconcileInterval(defaultReconcileInterval),
+				helm.WithDependsOn(component.dependsOn),
+				helm.WithSettings(component.HelmRelease),
+				helm.WithReconcileRequest(reconcileRequest),
+			)
+		}
+		if err != nil {
+			reconcileRequestHandled = false
+			errMsg := fmt.Sprintf("error reconciling HelmRelease %s/%s: %s", management.Namespace, component.Name, err)
+			updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, template.Name, template.Status, nil, errMsg)
+			errs = errors.Join(errs, errors.New(errMsg))
+			continue
+		}
+		updateComponentsStatus(detectedComponents, &detectedProviders, component.Name, template.Name, template.Status, hr, "")
+		if !component.observed {
+			status := detectedComponents[component.Name]
+			status.Values = effective
+			detectedComponents[component.Name] = status
+		}
+		rolledOut[component.Name] = template.Name == component.Template && detectedComponents[component.Name].Success
+	}
+
+	blocked, err := r.pruneRemovedComponents(ctx, management, components, detectedComponents, templateProviders(templates))
+	if err != nil {
+		errs = errors.Join(errs, err)
 	}
 
 	management.Status.ObservedGeneration = management.Generation
 	management.Status.AvailableProviders = detectedProviders
 	management.Status.Components = detectedComponents
+	management.Status.TargetRelease = management.Spec.Release
+	if reconcileRequest != "" && reconcileRequestHandled {
+		management.Status.LastHandledReconcileAt = reconcileRequest
+	}
+	readyCondition := managementReadyCondition(detectedComponents)
+	if release != nil {
+		pending := pendingRollout(components, rolledOut)
+		if len(pending) == 0 {
+			management.Status.Release = release.Name
+		} else if readyCondition.Status == metav1.ConditionTrue {
+			readyCondition.Status = metav1.ConditionUnknown
+			readyCondition.Reason = hmc.ProgressingReason
+			readyCondition.Message = fmt.Sprintf("Rolling out Release %s, pending components: %s", release.Name, strings.Join(pending, ", "))
+		}
+	} else {
+		management.Status.Release = ""
+	}
+	apimeta.SetStatusCondition(management.GetConditions(), readyCondition)
 	if err := r.Status().Update(ctx, management); err != nil {
-		errs = errors.Join(fmt.Errorf("failed to update status for Management %s/%s: %w", management.Namespace, management.Name, err))
+		errs = errors.Join(errs, fmt.Errorf("failed to update status for Management %s/%s: %w", management.Namespace, management.Name, err))
 	}
 	if errs != nil {
 		l.Error(errs, "Multiple errors during Management reconciliation")
 		return ctrl.Result{}, errs
 	}
+	if blocked {
+		l.Info("Removal of components is blocked by existing Deployments, retrying")
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+	if readyCondition.Status != metav1.ConditionTrue && !usesFlux(installer) {
+		// the releases are not watched, so the failed ones are retried by polling
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
-func (r *ManagementReconciler) Delete(_ context.Context, _ *hmc.Management) (ctrl.Result, error) {
-	return ctrl.Result{}, nil
+// getRelease returns the Release referenced by the Management, if any.
+func (r *ManagementReconciler) getRelease(ctx context.Context, management *hmc.Management) (*hmc.Release, error) {
+	if management.Spec.Release == "" {
+		return nil, nil
+	}
+	release := &hmc.Release{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.SystemNamespace, Name: management.Spec.Release}, release); err != nil {
+		return nil, fmt.Errorf("failed to get Release %s/%s: %w", r.SystemNamespace, management.Spec.Release, err)
+	}
+	return release, nil
+}
+
+// pendingDependencies returns the dependencies of the component which are not rolled out yet.
+func pendingDependencies(c component, rolledOut map[string]bool) (pending []string) {
+	for _, dep := range c.dependsOn {
+		if !rolledOut[dep.Name] {
+			pending = append(pending, dep.Name)
+		}
+	}
+	return pending
+}
+
+// pendingRollout returns the components which are not rolled out yet.
+func pendingRollout(components []component, rolledOut map[string]bool) (pending []string) {
+	for _, c := range components {
+		if !rolledOut[c.Name] {
+			pending = append(pending, c.Name)
+		}
+	}
+	return pending
+}
+
+// templateProviders returns the providers offered by the Templates of the
+// components, regardless of the readiness of the components.
+func templateProviders(templates map[string]*hmc.Template) hmc.Providers {
+	providers := hmc.Providers{}
+	for _, template := range templates {
+		providers.InfrastructureProviders = append(providers.InfrastructureProviders, template.Status.Providers.InfrastructureProviders...)
+		providers.BootstrapProviders = append(providers.BootstrapProviders, template.Status.Providers.BootstrapProviders...)
+		providers.ControlPlaneProviders = append(providers.ControlPlaneProviders, template.Status.Providers.ControlPlaneProviders...)
+	}
+	return providers
+}
+
+// pruneRemovedComponents deletes the HelmReleases of the components that were
+// installed by the Management but are no longer present in its spec. The removal
+// is blocked while any Deployment relies on the providers of such a component,
+// unless the providers are offered by the components remaining in the spec.
+func (r *ManagementReconciler) pruneRemovedComponents(
+	ctx context.Context,
+	management *hmc.Management,
+	components []component,
+	statuses map[string]hmc.ComponentStatus,
+	specProviders hmc.Providers,
+) (blocked bool, err error) {
+	l := log.FromContext(ctx)
+
+	desired := make(map[string]struct{}, len(components))
+	for _, c := range components {
+		desired[c.Name] = struct{}{}
+	}
+
+	helmReleases, err := r.listOwnedHelmReleases(ctx, management)
+	if err != nil {
+		return false, err
+	}
+
+	var errs error
+	for _, hr := range helmReleases {
+		if _, ok := desired[hr.Name]; ok || !hr.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		templateName := hr.Name
+		if status, ok := management.Status.Components[hr.Name]; ok && status.Template != "" {
+			templateName = status.Template
+		}
+		deployments, err := r.deploymentsUsingComponent(ctx, templateName, specProviders)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if len(deployments) > 0 {
+			blocked = true
+			statuses[hr.Name] = hmc.ComponentStatus{
+				Template: templateName,
+				Error: fmt.Sprintf("component is removed from the Management spec but its providers are used by Deployments: %s",
+					strings.Join(deployments, ", ")),
+			}
+			continue
+		}
+
+		l.Info("Removing HelmRelease of the component removed from the Management spec", "name", hr.Name)
+		if err := installerOrDefault(r.Installer, r.Client).Uninstall(ctx, hr.Name, hr.Namespace); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to delete HelmRelease %s/%s: %w", hr.Namespace, hr.Name, err))
+		}
+	}
+	return blocked, errs
+}
+
+// deploymentsUsingComponent returns the list of Deployments requiring any of the
+// providers of the given component template, which are not offered by the
+// other components.
+func (r *ManagementReconciler) deploymentsUsingComponent(ctx context.Context, templateName string, otherProviders hmc.Providers) ([]string, error) {
+	template := &hmc.Template{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: r.SystemNamespace, Name: templateName}, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			// nothing is known about the providers of the component
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Template %s/%s: %w", r.SystemNamespace, templateName, err)
+	}
+	removedProviders := subtractProviders(template.Status.Providers, otherProviders)
+
+	deployments := &hmc.DeploymentList{}
+	if err := r.List(ctx, deployments); err != nil {
+		return nil, fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	var result []string
+	for _, deployment := range deployments.Items {
+		deploymentTemplate := &hmc.Template{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: r.SystemNamespace, Name: deployment.Spec.Template}, deploymentTemplate)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to get Template %s/%s: %w", r.SystemNamespace, deployment.Spec.Template, err)
+		}
+		if providersIntersect(removedProviders, deploymentTemplate.Status.Providers) {
+			result = append(result, deployment.Namespace+"/"+deployment.Name)
+		}
+	}
+	return result, nil
+}
+
+func isOwnedBy(obj client.Object, owner client.Object) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
+
+// subtractProviders returns the providers from a which are not present in b.
+func subtractProviders(a, b hmc.Providers) hmc.Providers {
+	subtract := func(a, b []string) (result []string) {
+		for _, p := range a {
+			if !slices.Contains(b, p) {
+				result = append(result, p)
+			}
+		}
+		return result
+	}
+	return hmc.Providers{
+		InfrastructureProviders: subtract(a.InfrastructureProviders, b.InfrastructureProviders),
+		BootstrapProviders:      subtract(a.BootstrapProviders, b.BootstrapProviders),
+		ControlPlaneProviders:   subtract(a.ControlPlaneProviders, b.ControlPlaneProviders),
+	}
+}
+
+// providersIntersect returns true if a and b have any provider of the same kind in common.
+func providersIntersect(a, b hmc.Providers) bool {
+	intersect := func(a, b []string) bool {
+		return slices.ContainsFunc(a, func(p string) bool { return slices.Contains(b, p) })
+	}
+	return intersect(a.InfrastructureProviders, b.InfrastructureProviders) ||
+		intersect(a.BootstrapProviders, b.BootstrapProviders) ||
+		intersect(a.ControlPlaneProviders, b.ControlPlaneProviders)
+}
+
+// Delete tears the Management components down in the reverse order of their
+// dependencies: it waits for all Deployments to be removed, then removes the
+// providers, CAPI core and finally HMC core.
+func (r *ManagementReconciler) Delete(ctx context.Context, management *hmc.Management) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	deployments := &hmc.DeploymentList{}
+	if err := r.List(ctx, deployments, client.Limit(1)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	if len(deployments.Items) > 0 {
+		l.Info("Waiting for all Deployments to be removed")
+		return ctrl.Result{RequeueAfter: 10 * time.Second},
+			r.updateDeletionStatus(ctx, management, "Waiting for all Deployments to be removed")
+	}
+
+	helmReleases, err := r.listOwnedHelmReleases(ctx, management)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if len(helmReleases) == 0 {
+		return ctrl.Result{}, r.removeFinalizer(ctx, management)
+	}
+
+	names := teardownStage(wrappedComponents(management, nil), helmReleases)
+	var errs error
+	for _, name := range names {
+		if !helmReleases[name].DeletionTimestamp.IsZero() {
+			continue
+		}
+		l.Info("Removing HelmRelease of the Management component", "name", name)
+		if err := installerOrDefault(r.Installer, r.Client).Uninstall(ctx, name, management.Namespace); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to delete HelmRelease %s/%s: %w", management.Namespace, name, err))
+		}
+	}
+	if errs != nil {
+		return ctrl.Result{}, errs
+	}
+
+	if len(helmReleases) == 1 && len(names) == 1 && management.Spec.Core != nil && names[0] == wrappedComponents(management, nil)[0].Name {
+		// The HMC controller itself is removed together with the HMC core component,
+		// so the Management can not wait for the HelmRelease to be uninstalled.
+		return ctrl.Result{}, r.removeFinalizer(ctx, management)
+	}
+
+	return ctrl.Result{RequeueAfter: 10 * time.Second},
+		r.updateDeletionStatus(ctx, management, fmt.Sprintf("Removing components: %s", strings.Join(names, ", ")))
+}
+
+// teardownStage returns the names of the installed components which can be removed
+// at the moment, that is no other installed component depends on them. HelmReleases
+// of the components missing in the spec have no dependents and are removed first.
+func teardownStage(components []component, helmReleases map[string]*hcv2.HelmRelease) []string {
+	dependents := make(map[string]int)
+	for _, c := range components {
+		if _, ok := helmReleases[c.Name]; !ok {
+			continue
+		}
+		for _, dep := range c.dependsOn {
+			dependents[dep.Name]++
+		}
+	}
+	// dependencies declared by the templates are only known from the HelmReleases
+	for _, hr := range helmReleases {
+		for _, dep := range hr.Spec.DependsOn {
+			dependents[dep.Name]++
+		}
+	}
+	var names []string
+	for name := range helmReleases {
+		if dependents[name] == 0 {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (r *ManagementReconciler) updateDeletionStatus(ctx context.Context, management *hmc.Management, message string) error {
+	apimeta.SetStatusCondition(management.GetConditions(), metav1.Condition{
+		Type:    hmc.ReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  hmc.DeletingReason,
+		Message: message,
+	})
+	if err := r.Status().Update(ctx, management); err != nil {
+		return fmt.Errorf("failed to update status for Management %s/%s: %w", management.Namespace, management.Name, err)
+	}
+	return nil
+}
+
+func (r *ManagementReconciler) removeFinalizer(ctx context.Context, management *hmc.Management) error {
+	l := log.FromContext(ctx)
+	l.Info("Removing Finalizer", "finalizer", hmc.ManagementFinalizer)
+	if controllerutil.RemoveFinalizer(management, hmc.ManagementFinalizer) {
+		if err := r.Client.Update(ctx, management); err != nil {
+			return fmt.Errorf("failed to update Management %s/%s: %w", management.Namespace, management.Name, err)
+		}
+	}
+	l.Info("Management deleted")
+	return nil
+}
+
+// listOwnedHelmReleases returns the HelmReleases installed by the Management by their names.
+func (r *ManagementReconciler) listOwnedHelmReleases(ctx context.Context, management *hmc.Management) (map[string]*hcv2.HelmRelease, error) {
+	helmReleases, err := installerOrDefault(r.Installer, r.Client).List(ctx, management.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*hcv2.HelmRelease)
+	for i := range helmReleases {
+		if isOwnedBy(&helmReleases[i], management) {
+			result[helmReleases[i].Name] = &helmReleases[i]
+		}
+	}
+	return result, nil
 }
 
 type component struct {
 	hmc.Component
 	// helm release dependencies
 	dependsOn []meta.NamespacedObjectReference
+	// values imposed by HMC, overridden by the component config
+	imposedValues map[string]interface{}
+	// the release is installed outside of the controller, only its state is reported
+	observed bool
 }
 
-func wrappedComponents(mgmt *hmc.Management) (components []component) {
+// wrappedComponents returns the components of the Management with the default
+// names set. If the Release is provided, the Templates of the components are
+// taken from it.
+func wrappedComponents(mgmt *hmc.Management, release *hmc.Release) (components []component) {
 	if mgmt.Spec.Core == nil {
 		return
 	}
-	components = append(components, component{Component: mgmt.Spec.Core.HMC})
-	components = append(components, component{Component: mgmt.Spec.Core.CAPI, dependsOn: []meta.NamespacedObjectReference{{Name: mgmt.Spec.Core.HMC.Template}}})
+	hmcComponent := component{Component: mgmt.Spec.Core.HMC}
+	hmcComponent.setDefaultName(hmc.DefaultCoreHMCTemplate)
+	capiComponent := component{Component: mgmt.Spec.Core.CAPI}
+	capiComponent.setDefaultName(hmc.DefaultCoreCAPITemplate)
+	capiComponent.dependsOn = []meta.NamespacedObjectReference{{Name: hmcComponent.Name}}
+	if release != nil {
+		hmcComponent.Template = release.Spec.HMC.Template
+		capiComponent.Template = release.Spec.CAPI.Template
+	}
+	components = append(components, hmcComponent, capiComponent)
+
 	for provider := range mgmt.Spec.Providers {
-		components = append(components, component{Component: mgmt.Spec.Providers[provider], dependsOn: []meta.NamespacedObjectReference{{Name: mgmt.Spec.Core.CAPI.Template}}})
+		providerComponent := component{Component: mgmt.Spec.Providers[provider]}
+		providerComponent.setDefaultName("")
+		providerComponent.dependsOn = []meta.NamespacedObjectReference{{Name: capiComponent.Name}}
+		if release != nil {
+			if template := release.Spec.ProviderTemplate(providerComponent.Name); template != "" {
+				providerComponent.Template = template
+			}
+		}
+		components = append(components, providerComponent)
 	}
 	return
 }
 
-func (r *ManagementReconciler) enableAdmissionWebhook(ctx context.Context, mgmt *hmc.Management) error {
+func (c *component) setDefaultName(defaultName string) {
+	c.Name = c.GetName()
+	if c.Name == "" {
+		c.Name = defaultName
+	}
+}
+
+// configureHMC validates the config of the HMC core component, sets its defaults
+// and enables the admission webhook. The webhook requires the cert-manager API
+// to be installed.
+func (r *ManagementReconciler) configureHMC(ctx context.Context, c *component) error {
 	l := log.FromContext(ctx)
 
-	mgmtComponent := mgmt.Spec.Core.HMC
-	config := map[string]interface{}{}
-	err := json.Unmarshal(mgmtComponent.Config.Raw, &config)
+	values, err := helm.ParseHMCValues(c.Config)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal HMC config into map[string]interface{}: %v", err)
+		return err
+	}
+	values.Default()
+	if err := values.Validate(); err != nil {
+		return fmt.Errorf("invalid HMC config: %w", err)
 	}
-	admissionWebhookValues := make(map[string]interface{})
-	if config["admissionWebhook"] != nil {
-		admissionWebhookValues = config["admissionWebhook"].(map[string]interface{})
+	if c.Config, err = values.JSON(); err != nil {
+		return err
 	}
 
-	err = certmanager.VerifyAPI(ctx, r.Config, r.Scheme, hmc.ManagementNamespace)
+	err = certmanager.VerifyAPI(ctx, r.Config, r.Scheme, r.SystemNamespace)
 	if err != nil {
 		return fmt.Errorf("failed to check in the cert-manager API is installed: %v", err)
 	}
 	l.Info("Cert manager is installed, enabling the HMC admission webhook")
 
-	admissionWebhookValues["enabled"] = true
-	config["admissionWebhook"] = admissionWebhookValues
-	updatedConfig, err := json.Marshal(config)
+	enabled := true
+	imposed := &helm.HMCValues{AdmissionWebhook: &helm.AdmissionWebhookValues{Enabled: &enabled}}
+	c.imposedValues, err = imposed.Values()
+	return err
+}
+
+// releaseValues merges the global values if the Template supports them, the
+// values imposed by HMC and the configuration of the component, the latter
+// taking precedence. These are the values set in the HelmRelease: the default
+// values of the Template are not included, Helm applies them when installing
+// the chart.
+func releaseValues(c component, template *hmc.Template, globalValues map[string]interface{}) (*apiextensionsv1.JSON, error) {
+	config, err := c.HelmValues()
 	if err != nil {
-		return fmt.Errorf("failed to marshal HMC config: %v", err)
+		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
-	mgmtComponent.Config.Raw = updatedConfig
-	return nil
+	if !template.Status.GlobalValues {
+		globalValues = nil
+	}
+	raw, err := json.Marshal(helm.MergeValues(globalValues, c.imposedValues, config))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	return &apiextensionsv1.JSON{Raw: raw}, nil
 }
 
-func applyDefaultCoreConfiguration(mgmt *hmc.Management) (changed bool) {
-	if mgmt.Spec.Core != nil {
-		// Only apply defaults when there's no configuration provided
-		return false
+// effectiveValues merges the values of the HelmRelease over the default values
+// of the Template, which are the values the chart is installed with.
+func effectiveValues(template *hmc.Template, values *apiextensionsv1.JSON) (*apiextensionsv1.JSON, error) {
+	var defaults, overrides map[string]interface{}
+	if template.Status.Config != nil {
+		if err := json.Unmarshal(template.Status.Config.Raw, &defaults); err != nil {
+			return nil, fmt.Errorf("failed to parse default values of the Template %s: %w", template.Name, err)
+		}
 	}
-	mgmt.Spec.Core = &hmc.Core{
-		HMC: hmc.Component{
-			Template: hmc.DefaultCoreHMCTemplate,
-		},
-		CAPI: hmc.Component{
-			Template: hmc.DefaultCoreCAPITemplate,
-		},
+	if values != nil {
+		if err := json.Unmarshal(values.Raw, &overrides); err != nil {
+			return nil, fmt.Errorf("failed to parse values: %w", err)
+		}
 	}
-
-	return true
+	raw, err := json.Marshal(helm.MergeValues(defaults, overrides))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal values: %w", err)
+	}
+	return &apiextensionsv1.JSON{Raw: raw}, nil
 }
 
+// updateComponentsStatus sets the status of the component based on the Ready
+// condition of its HelmRelease. The component is only considered successfully
+// installed once the HelmRelease is ready, the providers of such components are
+// added to the list of the available providers.
 func updateComponentsStatus(
 	components map[string]hmc.ComponentStatus,
 	providers *hmc.Providers,
 	componentName string,
+	templateName string,
 	templateStatus hmc.TemplateStatus,
+	hr *hcv2.HelmRelease,
 	err string) {
 
-	components[componentName] = hmc.ComponentStatus{
-		Error:   err,
-		Success: err == "",
+	status := hmc.ComponentStatus{
+		Template: templateName,
+	}
+	if previous, ok := components[componentName]; ok {
+		status.Conditions = previous.Conditions
 	}
 
-	if err == "" {
+	if err != "" {
+		// the Template was not applied
+		status.Template = components[componentName].Template
+		status.Error = err
+		apimeta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    hmc.HelmReleaseReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err,
+		})
+		components[componentName] = status
+		return
+	}
+
+	if hr != nil {
+		if latest := hr.Status.History.Latest(); latest != nil {
+			status.ChartVersion = latest.ChartVersion
+			status.AppVersion = latest.AppVersion
+		}
+	}
+	condition := helmReleaseReadyCondition(hr)
+	apimeta.SetStatusCondition(&status.Conditions, condition)
+	switch condition.Status {
+	case metav1.ConditionTrue:
+		status.Success = true
+	case metav1.ConditionFalse:
+		status.Error = condition.Message
+	}
+	components[componentName] = status
+
+	if status.Success {
 		providers.InfrastructureProviders = append(providers.InfrastructureProviders, templateStatus.Providers.InfrastructureProviders...)
 		providers.BootstrapProviders = append(providers.BootstrapProviders, templateStatus.Providers.BootstrapProviders...)
 		providers.ControlPlaneProviders = append(providers.ControlPlaneProviders, templateStatus.Providers.ControlPlaneProviders...)
 	}
 }
 
+// helmReleaseReadyCondition converts the Ready condition of the HelmRelease
+// into the HelmReleaseReady condition of the component.
+func helmReleaseReadyCondition(hr *hcv2.HelmRelease) metav1.Condition {
+	if hr == nil {
+		return metav1.Condition{
+			Type:    hmc.HelmReleaseReadyCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  hmc.ProgressingReason,
+			Message: "HelmRelease is not yet created",
+		}
+	}
+	hrReadyCondition := fluxconditions.Get(hr, meta.ReadyCondition)
+	if hrReadyCondition == nil || hr.Status.ObservedGeneration != hr.Generation {
+		return metav1.Condition{
+			Type:    hmc.HelmReleaseReadyCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  hmc.ProgressingReason,
+			Message: "HelmRelease is not yet reconciled",
+		}
+	}
+	return metav1.Condition{
+		Type:    hmc.HelmReleaseReadyCondition,
+		Status:  hrReadyCondition.Status,
+		Reason:  hrReadyCondition.Reason,
+		Message: hrReadyCondition.Message,
+	}
+}
+
+// managementReadyCondition aggregates the statuses of all components into the
+// Ready condition of the Management.
+func managementReadyCondition(statuses map[string]hmc.ComponentStatus) metav1.Condition {
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var failed, progressing []string
+	for _, name := range names {
+		status := statuses[name]
+		switch {
+		case status.Success:
+		case status.Error != "":
+			failed = append(failed, name)
+		default:
+			progressing = append(progressing, name)
+		}
+	}
+	condition := metav1.Condition{
+		Type:    hmc.ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  hmc.SucceededReason,
+		Message: "All components are ready",
+	}
+	if len(progressing) > 0 {
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = hmc.ProgressingReason
+		condition.Message = fmt.Sprintf("Components are not yet ready: %s", strings.Join(progressing, ", "))
+	}
+	if len(failed) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = hmc.FailedReason
+		condition.Message = fmt.Sprintf("Components failed: %s", strings.Join(failed, ", "))
+	}
+	return condition
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ManagementReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&hmc.Management{}).
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&hmc.Management{})
+	if usesFlux(installerOrDefault(r.Installer, r.Client)) {
+		b = b.Watches(&hcv2.HelmRelease{},
+			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &hmc.Management{}),
+		)
+	}
+	return b.
+		Watches(&hmc.Release{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []ctrl.Request {
+				managements := &hmc.ManagementList{}
+				if err := r.Client.List(ctx, managements); err != nil {
+					return []ctrl.Request{}
+				}
+				var requests []ctrl.Request
+				for _, management := range managements.Items {
+					if management.Spec.Release == o.GetName() && o.GetNamespace() == r.SystemNamespace {
+						requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&management)})
+					}
+				}
+				return requests
+			}),
+		).
 		Complete(r)
 }
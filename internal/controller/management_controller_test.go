@@ -16,16 +16,23 @@ package controller
 
 import (
 	"context"
+	"time"
 
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	fluxmeta "github.com/fluxcd/pkg/apis/meta"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
 )
 
 var _ = Describe("Management Controller", func() {
@@ -67,8 +74,9 @@ var _ = Describe("Management Controller", func() {
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
 			controllerReconciler := &ManagementReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: hmcmirantiscomv1alpha1.DefaultSystemNamespace,
 			}
 
 			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
@@ -80,3 +88,534 @@ var _ = Describe("Management Controller", func() {
 		})
 	})
 })
+
+var _ = Describe("Management teardown", func() {
+	It("should remove components in the reverse order of their dependencies", func() {
+		management := &hmcmirantiscomv1alpha1.Management{
+			Spec: hmcmirantiscomv1alpha1.ManagementSpec{
+				Core: &hmcmirantiscomv1alpha1.Core{
+					HMC:  hmcmirantiscomv1alpha1.Component{Template: "hmc"},
+					CAPI: hmcmirantiscomv1alpha1.Component{Template: "cluster-api"},
+				},
+				Providers: []hmcmirantiscomv1alpha1.Component{{Template: "k0smotron"}},
+			},
+		}
+		components := wrappedComponents(management, nil)
+		helmReleases := map[string]*hcv2.HelmRelease{
+			"hmc":         {},
+			"cluster-api": {},
+			"k0smotron":   {},
+			"removed":     {},
+		}
+
+		Expect(teardownStage(components, helmReleases)).To(Equal([]string{"k0smotron", "removed"}))
+		delete(helmReleases, "k0smotron")
+		delete(helmReleases, "removed")
+		Expect(teardownStage(components, helmReleases)).To(Equal([]string{"cluster-api"}))
+		delete(helmReleases, "cluster-api")
+		Expect(teardownStage(components, helmReleases)).To(Equal([]string{"hmc"}))
+	})
+})
+
+var _ = Describe("Management components dependencies", func() {
+	management := &hmcmirantiscomv1alpha1.Management{
+		Spec: hmcmirantiscomv1alpha1.ManagementSpec{
+			Core: &hmcmirantiscomv1alpha1.Core{
+				HMC:  hmcmirantiscomv1alpha1.Component{Template: "hmc"},
+				CAPI: hmcmirantiscomv1alpha1.Component{Template: "cluster-api"},
+			},
+			Providers: []hmcmirantiscomv1alpha1.Component{
+				{Template: "cluster-api-provider-aws"},
+				{Template: "k0smotron"},
+			},
+		},
+	}
+
+	templates := func(sorted []component) []string {
+		var names []string
+		for _, c := range sorted {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	It("should order providers after their dependencies", func() {
+		components := wrappedComponents(management, nil)
+		components[2].addDependencies("k0smotron")
+
+		sorted, errs := sortComponents(components)
+		Expect(errs).To(BeEmpty())
+		Expect(templates(sorted)).To(Equal([]string{"hmc", "cluster-api", "k0smotron", "cluster-api-provider-aws"}))
+	})
+
+	It("should report missing dependencies and cycles", func() {
+		components := wrappedComponents(management, nil)
+		components[2].addDependencies("k0smotron")
+		components[3].addDependencies("cluster-api-provider-aws")
+
+		sorted, errs := sortComponents(components)
+		Expect(templates(sorted)).To(Equal([]string{"hmc", "cluster-api"}))
+		Expect(errs).To(HaveKey("k0smotron"))
+		Expect(errs).To(HaveKey("cluster-api-provider-aws"))
+
+		components = wrappedComponents(management, nil)
+		components[3].addDependencies("openstack")
+		sorted, errs = sortComponents(components)
+		Expect(templates(sorted)).To(Equal([]string{"hmc", "cluster-api", "cluster-api-provider-aws"}))
+		Expect(errs).To(HaveLen(1))
+		Expect(errs["k0smotron"]).To(MatchError(ContainSubstring("not in the Management spec")))
+	})
+})
+
+var _ = Describe("Management Release", func() {
+	It("should take the component Templates from the Release", func() {
+		management := &hmcmirantiscomv1alpha1.Management{
+			Spec: hmcmirantiscomv1alpha1.ManagementSpec{
+				Core: &hmcmirantiscomv1alpha1.Core{
+					HMC:  hmcmirantiscomv1alpha1.Component{Template: "hmc"},
+					CAPI: hmcmirantiscomv1alpha1.Component{},
+				},
+				Providers: []hmcmirantiscomv1alpha1.Component{
+					{Template: "k0smotron"},
+					{Name: "custom", Template: "custom-provider"},
+				},
+				Release: "hmc-0-0-2",
+			},
+		}
+		release := &hmcmirantiscomv1alpha1.Release{
+			Spec: hmcmirantiscomv1alpha1.ReleaseSpec{
+				Version: "0.0.2",
+				HMC:     hmcmirantiscomv1alpha1.ReleaseTemplate{Template: "hmc-0-0-2"},
+				CAPI:    hmcmirantiscomv1alpha1.ReleaseTemplate{Template: "cluster-api-0-0-2"},
+				Providers: []hmcmirantiscomv1alpha1.ReleaseProvider{
+					{Name: "k0smotron", Template: "k0smotron-0-0-2"},
+				},
+			},
+		}
+
+		components := wrappedComponents(management, release)
+		Expect(components).To(HaveLen(4))
+		for i, expected := range []struct{ name, template string }{
+			{"hmc", "hmc-0-0-2"},
+			{"cluster-api", "cluster-api-0-0-2"},
+			{"k0smotron", "k0smotron-0-0-2"},
+			{"custom", "custom-provider"},
+		} {
+			Expect(components[i].Name).To(Equal(expected.name))
+			Expect(components[i].Template).To(Equal(expected.template))
+		}
+		Expect(components[2].dependsOn).To(ConsistOf(HaveField("Name", "cluster-api")))
+	})
+})
+
+var _ = Describe("Management component values", func() {
+	It("should keep the defaults out of the release values and merge them into the effective values", func() {
+		template := &hmcmirantiscomv1alpha1.Template{
+			Status: hmcmirantiscomv1alpha1.TemplateStatus{
+				Config: &apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":{"enabled":false,"port":9443},"replicas":1,"args":["--a"]}`)},
+			},
+		}
+		c := component{
+			Component: hmcmirantiscomv1alpha1.Component{
+				Config: &apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":{"port":8443},"args":["--b"]}`)},
+			},
+			imposedValues: map[string]interface{}{
+				"admissionWebhook": map[string]interface{}{"enabled": true},
+			},
+		}
+
+		values, err := releaseValues(c, template, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Raw).To(MatchJSON(`{"admissionWebhook":{"enabled":true,"port":8443},"args":["--b"]}`))
+
+		effective, err := effectiveValues(template, values)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(effective.Raw).To(MatchJSON(`{"admissionWebhook":{"enabled":true,"port":8443},"replicas":1,"args":["--b"]}`))
+	})
+
+	It("should inject the global values only if the template supports them", func() {
+		global := &hmcmirantiscomv1alpha1.GlobalSettings{
+			RegistryMirrors: map[string]string{"docker.io": "registry.local/docker.io"},
+			Proxy:           &hmcmirantiscomv1alpha1.ProxySettings{HTTPSProxy: "http://proxy.local:3128"},
+		}
+		globalValues, err := global.HelmValues()
+		Expect(err).NotTo(HaveOccurred())
+
+		template := &hmcmirantiscomv1alpha1.Template{
+			Status: hmcmirantiscomv1alpha1.TemplateStatus{
+				Config: &apiextensionsv1.JSON{Raw: []byte(`{"global":{"hmc":{"trustedCAs":""}},"replicas":1}`)},
+			},
+		}
+		c := component{
+			Component: hmcmirantiscomv1alpha1.Component{
+				Config: &apiextensionsv1.JSON{Raw: []byte(`{"global":{"hmc":{"proxy":{"noProxy":"10.0.0.0/8"}}}}`)},
+			},
+		}
+
+		values, err := releaseValues(c, template, globalValues)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Raw).To(MatchJSON(`{"global":{"hmc":{"proxy":{"noProxy":"10.0.0.0/8"}}}}`))
+
+		template.Status.GlobalValues = true
+		values, err = releaseValues(c, template, globalValues)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Raw).To(MatchJSON(`{"global":{"hmc":{
+			"registryMirrors":{"docker.io":"registry.local/docker.io"},
+			"proxy":{"httpsProxy":"http://proxy.local:3128","noProxy":"10.0.0.0/8"}
+		}}}`))
+
+		globalValues, err = (*hmcmirantiscomv1alpha1.GlobalSettings)(nil).HelmValues()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(globalValues).To(BeNil())
+	})
+})
+
+var _ = Describe("HMC core component config", func() {
+	It("should preserve unknown values and omit the sections not set", func() {
+		values, err := helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":{"enabled":true},"controllerManager":{"manager":{"args":["--create-management=false"],"image":{"tag":"v0.0.1"}}}}`)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Validate()).To(Succeed())
+
+		config, err := values.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Raw).To(MatchJSON(`{
+			"admissionWebhook":{"enabled":true},
+			"controllerManager":{"manager":{"args":["--create-management=false"],"image":{"tag":"v0.0.1"}}}
+		}`))
+
+		values, err = helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"controllerManager":{"replicas":2}}`)})
+		Expect(err).NotTo(HaveOccurred())
+		config, err = values.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Raw).To(MatchJSON(`{"controllerManager":{"replicas":2}}`))
+	})
+
+	It("should set and remove the controller manager arguments", func() {
+		values, err := helm.ParseHMCValues(nil)
+		Expect(err).NotTo(HaveOccurred())
+		values.RemoveManagerArg("--insecure-registry")
+		Expect(values.ManagerArgs()).To(BeNil())
+
+		values.SetManagerArg("--default-registry-url", "oci://registry.local/charts")
+		values.SetManagerArg("--insecure-registry", "true")
+		values.SetManagerArg("--default-registry-url", "oci://registry.local/hmc/charts")
+		values.RemoveManagerArg("--insecure-registry")
+		config, err := values.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Raw).To(MatchJSON(`{"controllerManager":{"manager":{"args":["--default-registry-url=oci://registry.local/hmc/charts"]}}}`))
+	})
+
+	It("should reject unexpectedly shaped and invalid config", func() {
+		_, err := helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":"enabled"}`)})
+		Expect(err).To(HaveOccurred())
+
+		values, err := helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"controllerManager":{"manager":{"args":["--webhook-port=8443"]}}}`)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Validate()).To(MatchError(ContainSubstring("--webhook-port")))
+	})
+
+	It("should accept nil config", func() {
+		values, err := helm.ParseHMCValues(nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(values.Validate()).To(Succeed())
+	})
+
+	It("should default the admission webhook settings only if they are set", func() {
+		values, err := helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":{"enabled":true},"flux2":{"enabled":false}}`)})
+		Expect(err).NotTo(HaveOccurred())
+		values.Default()
+		config, err := values.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Raw).To(MatchJSON(`{
+			"admissionWebhook":{"enabled":true,"port":9443,"certDir":"/tmp/k8s-webhook-server/serving-certs/"},
+			"flux2":{"enabled":false}
+		}`))
+
+		values, err = helm.ParseHMCValues(&apiextensionsv1.JSON{Raw: []byte(`{"admissionWebhook":{"port":8443,"certDir":"/certs"}}`)})
+		Expect(err).NotTo(HaveOccurred())
+		values.Default()
+		Expect(values.AdmissionWebhook.Port).To(Equal(8443))
+		Expect(values.AdmissionWebhook.CertDir).To(Equal("/certs"))
+
+		values, err = helm.ParseHMCValues(nil)
+		Expect(err).NotTo(HaveOccurred())
+		values.Default()
+		config, err = values.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(config.Raw).To(MatchJSON(`{}`))
+	})
+})
+
+var _ = Describe("Management component HelmRelease", func() {
+	It("should apply the HelmRelease settings of the component", func() {
+		ctx := context.Background()
+		settings := &hmcmirantiscomv1alpha1.HelmReleaseSettings{
+			Timeout: &metav1.Duration{Duration: 10 * time.Minute},
+			Install: &hcv2.Install{Remediation: &hcv2.InstallRemediation{Retries: 3}},
+			Upgrade: &hcv2.Upgrade{CRDs: hcv2.CreateReplace},
+			DriftDetection: &hcv2.DriftDetection{
+				Mode: hcv2.DriftDetectionEnabled,
+			},
+		}
+		hr, _, err := helm.ReconcileHelmRelease(ctx, k8sClient, "settings-test", "default",
+			helm.WithReconcileInterval(time.Minute),
+			helm.WithSettings(settings),
+		)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hr.Spec.Interval.Duration).To(Equal(time.Minute))
+		Expect(hr.Spec.Timeout).To(Equal(settings.Timeout))
+		Expect(hr.Spec.Install.Remediation.Retries).To(Equal(3))
+		Expect(hr.Spec.Upgrade.CRDs).To(Equal(hcv2.CreateReplace))
+		Expect(hr.Spec.DriftDetection.Mode).To(Equal(hcv2.DriftDetectionEnabled))
+
+		By("Resetting the settings removed from the component")
+		hr, _, err = helm.ReconcileHelmRelease(ctx, k8sClient, "settings-test", "default", helm.WithSettings(nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hr.Spec.Interval.Duration).To(Equal(helm.DefaultReconcileInterval))
+		Expect(hr.Spec.Timeout).To(BeNil())
+		Expect(hr.Spec.DriftDetection).To(BeNil())
+
+		By("Propagating the reconcile request")
+		hr, _, err = helm.ReconcileHelmRelease(ctx, k8sClient, "settings-test", "default", helm.WithReconcileRequest("1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hr.Annotations).To(HaveKeyWithValue(fluxmeta.ReconcileRequestAnnotation, "1"))
+		Expect(hr.Annotations).To(HaveKeyWithValue(hcv2.ResetRequestAnnotation, "1"))
+		Expect(hr.Annotations).To(HaveKeyWithValue(hcv2.ForceRequestAnnotation, "1"))
+		hr, _, err = helm.ReconcileHelmRelease(ctx, k8sClient, "settings-test", "default", helm.WithReconcileRequest(""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hr.Annotations).To(HaveKeyWithValue(fluxmeta.ReconcileRequestAnnotation, "1"))
+		Expect(k8sClient.Delete(ctx, hr)).To(Succeed())
+	})
+})
+
+var _ = Describe("Management components status", func() {
+	helmRelease := func(generation, observedGeneration int64, ready *metav1.Condition) *hcv2.HelmRelease {
+		hr := &hcv2.HelmRelease{}
+		hr.Generation = generation
+		hr.Status.ObservedGeneration = observedGeneration
+		hr.Status.History = hcv2.Snapshots{{Version: 1, ChartVersion: "0.0.1", AppVersion: "v0.0.1"}}
+		if ready != nil {
+			hr.Status.Conditions = []metav1.Condition{*ready}
+		}
+		return hr
+	}
+	templateStatus := hmcmirantiscomv1alpha1.TemplateStatus{
+		Providers: hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}},
+	}
+
+	DescribeTable("should convert the HelmRelease readiness into the component status",
+		func(hr *hcv2.HelmRelease, err string, status metav1.ConditionStatus, success bool, errMsg string, providers []string) {
+			components := map[string]hmcmirantiscomv1alpha1.ComponentStatus{}
+			detectedProviders := hmcmirantiscomv1alpha1.Providers{}
+			updateComponentsStatus(components, &detectedProviders, "capa", "capa-0-0-1", templateStatus, hr, err)
+
+			Expect(components).To(HaveKey("capa"))
+			componentStatus := components["capa"]
+			Expect(componentStatus.Success).To(Equal(success))
+			Expect(componentStatus.Error).To(Equal(errMsg))
+			condition := apimeta.FindStatusCondition(componentStatus.Conditions, hmcmirantiscomv1alpha1.HelmReleaseReadyCondition)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(status))
+			Expect(detectedProviders.InfrastructureProviders).To(Equal(providers))
+		},
+		Entry("ready", helmRelease(1, 1, &metav1.Condition{
+			Type: fluxmeta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "InstallSucceeded", Message: "installed",
+		}), "", metav1.ConditionTrue, true, "", []string{"aws"}),
+		Entry("failed", helmRelease(1, 1, &metav1.Condition{
+			Type: fluxmeta.ReadyCondition, Status: metav1.ConditionFalse, Reason: "InstallFailed", Message: "timeout",
+		}), "", metav1.ConditionFalse, false, "timeout", nil),
+		Entry("progressing", helmRelease(2, 1, &metav1.Condition{
+			Type: fluxmeta.ReadyCondition, Status: metav1.ConditionTrue, Reason: "InstallSucceeded", Message: "installed",
+		}), "", metav1.ConditionUnknown, false, "", nil),
+		Entry("not reconciled", helmRelease(1, 0, nil), "", metav1.ConditionUnknown, false, "", nil),
+		Entry("missing HelmRelease", nil, "", metav1.ConditionUnknown, false, "", nil),
+		Entry("not installed", nil, "Template is not valid", metav1.ConditionFalse, false, "Template is not valid", nil),
+	)
+
+	It("should keep the applied Template and the condition transition time on failures", func() {
+		transitionTime := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+		components := map[string]hmcmirantiscomv1alpha1.ComponentStatus{
+			"capa": {
+				Template: "capa-0-0-1",
+				Conditions: []metav1.Condition{{
+					Type:               hmcmirantiscomv1alpha1.HelmReleaseReadyCondition,
+					Status:             metav1.ConditionFalse,
+					Reason:             hmcmirantiscomv1alpha1.FailedReason,
+					LastTransitionTime: transitionTime,
+				}},
+			},
+		}
+		updateComponentsStatus(components, &hmcmirantiscomv1alpha1.Providers{}, "capa", "capa-0-0-2", templateStatus, nil, "failed")
+		Expect(components["capa"].Template).To(Equal("capa-0-0-1"))
+		Expect(components["capa"].Conditions[0].LastTransitionTime).To(Equal(transitionTime))
+	})
+
+	DescribeTable("should aggregate the components status into the Management readiness",
+		func(statuses map[string]hmcmirantiscomv1alpha1.ComponentStatus, status metav1.ConditionStatus, reason, message string) {
+			condition := managementReadyCondition(statuses)
+			Expect(condition.Type).To(Equal(hmcmirantiscomv1alpha1.ReadyCondition))
+			Expect(condition.Status).To(Equal(status))
+			Expect(condition.Reason).To(Equal(reason))
+			Expect(condition.Message).To(Equal(message))
+		},
+		Entry("ready", map[string]hmcmirantiscomv1alpha1.ComponentStatus{
+			"hmc":         {Success: true},
+			"cluster-api": {Success: true},
+		}, metav1.ConditionTrue, hmcmirantiscomv1alpha1.SucceededReason, "All components are ready"),
+		Entry("progressing", map[string]hmcmirantiscomv1alpha1.ComponentStatus{
+			"hmc":         {Success: true},
+			"cluster-api": {},
+			"capa":        {},
+		}, metav1.ConditionUnknown, hmcmirantiscomv1alpha1.ProgressingReason, "Components are not yet ready: capa, cluster-api"),
+		Entry("failed", map[string]hmcmirantiscomv1alpha1.ComponentStatus{
+			"hmc":         {Success: true},
+			"cluster-api": {},
+			"capa":        {Error: "timeout"},
+		}, metav1.ConditionFalse, hmcmirantiscomv1alpha1.FailedReason, "Components failed: capa"),
+		Entry("no components", map[string]hmcmirantiscomv1alpha1.ComponentStatus{},
+			metav1.ConditionTrue, hmcmirantiscomv1alpha1.SucceededReason, "All components are ready"),
+	)
+})
+
+var _ = Describe("Management components removal", func() {
+	const namespace = "default"
+
+	ctx := context.Background()
+	aws := hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}}
+	var management *hmcmirantiscomv1alpha1.Management
+	var reconciler *ManagementReconciler
+
+	createTemplate := func(name string, providers hmcmirantiscomv1alpha1.Providers) *hmcmirantiscomv1alpha1.Template {
+		template := &hmcmirantiscomv1alpha1.Template{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: hmcmirantiscomv1alpha1.TemplateSpec{
+				Helm: hmcmirantiscomv1alpha1.HelmSpec{ChartName: name},
+			},
+		}
+		Expect(k8sClient.Create(ctx, template)).To(Succeed())
+		template.Status.Valid = true
+		template.Status.Providers = providers
+		Expect(k8sClient.Status().Update(ctx, template)).To(Succeed())
+		return template
+	}
+
+	BeforeEach(func() {
+		createTemplate("removal-capa", aws)
+		createTemplate("removal-capa-fork", aws)
+		createTemplate("removal-aws-cluster", aws)
+		Expect(k8sClient.Create(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "removal-test", Namespace: namespace},
+			Spec:       hmcmirantiscomv1alpha1.DeploymentSpec{Template: "removal-aws-cluster"},
+		})).To(Succeed())
+
+		management = &hmcmirantiscomv1alpha1.Management{
+			ObjectMeta: metav1.ObjectMeta{Name: "removal-test", Namespace: namespace},
+		}
+		Expect(k8sClient.Create(ctx, management)).To(Succeed())
+		reconciler = &ManagementReconciler{
+			Client:          k8sClient,
+			Scheme:          k8sClient.Scheme(),
+			SystemNamespace: namespace,
+		}
+		_, err := installerOrDefault(reconciler.Installer, k8sClient).Install(ctx, "removal-capa", namespace,
+			helm.WithOwnerReference(&metav1.OwnerReference{
+				APIVersion: hmcmirantiscomv1alpha1.GroupVersion.String(),
+				Kind:       hmcmirantiscomv1alpha1.ManagementKind,
+				Name:       management.Name,
+				UID:        management.UID,
+			}),
+			helm.WithChartRef(&hcv2.CrossNamespaceSourceReference{Kind: "HelmChart", Name: "removal-capa"}),
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		for _, obj := range []client.Object{
+			&hmcmirantiscomv1alpha1.Template{ObjectMeta: metav1.ObjectMeta{Name: "removal-capa", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Template{ObjectMeta: metav1.ObjectMeta{Name: "removal-capa-fork", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Template{ObjectMeta: metav1.ObjectMeta{Name: "removal-aws-cluster", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "removal-test", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Management{ObjectMeta: metav1.ObjectMeta{Name: "removal-test", Namespace: namespace}},
+			&hcv2.HelmRelease{ObjectMeta: metav1.ObjectMeta{Name: "removal-capa", Namespace: namespace}},
+		} {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+		}
+	})
+
+	helmReleaseExists := func() bool {
+		err := k8sClient.Get(ctx, types.NamespacedName{Name: "removal-capa", Namespace: namespace}, &hcv2.HelmRelease{})
+		if errors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	It("should block the removal of the providers used by Deployments", func() {
+		statuses := map[string]hmcmirantiscomv1alpha1.ComponentStatus{}
+		blocked, err := reconciler.pruneRemovedComponents(ctx, management, nil, statuses, hmcmirantiscomv1alpha1.Providers{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocked).To(BeTrue())
+		Expect(statuses["removal-capa"].Error).To(ContainSubstring(namespace + "/removal-test"))
+		Expect(helmReleaseExists()).To(BeTrue())
+
+		By("Removing the component once the Deployment is deleted")
+		Expect(k8sClient.Delete(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "removal-test", Namespace: namespace},
+		})).To(Succeed())
+		blocked, err = reconciler.pruneRemovedComponents(ctx, management, nil, map[string]hmcmirantiscomv1alpha1.ComponentStatus{}, hmcmirantiscomv1alpha1.Providers{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocked).To(BeFalse())
+		Expect(helmReleaseExists()).To(BeFalse())
+	})
+
+	It("should allow the removal of the providers offered by another component in the spec", func() {
+		// the other component is not ready yet, its Template offers the same providers
+		fork := &hmcmirantiscomv1alpha1.Template{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "removal-capa-fork", Namespace: namespace}, fork)).To(Succeed())
+		components := []component{{Component: hmcmirantiscomv1alpha1.Component{Template: "removal-capa-fork"}}}
+		components[0].setDefaultName("")
+
+		blocked, err := reconciler.pruneRemovedComponents(ctx, management, components,
+			map[string]hmcmirantiscomv1alpha1.ComponentStatus{}, templateProviders(map[string]*hmcmirantiscomv1alpha1.Template{
+				"removal-capa-fork": fork,
+			}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocked).To(BeFalse())
+		Expect(helmReleaseExists()).To(BeFalse())
+	})
+
+	It("should keep the components present in the spec", func() {
+		components := []component{{Component: hmcmirantiscomv1alpha1.Component{Template: "removal-capa"}}}
+		components[0].setDefaultName("")
+
+		blocked, err := reconciler.pruneRemovedComponents(ctx, management, components,
+			map[string]hmcmirantiscomv1alpha1.ComponentStatus{}, hmcmirantiscomv1alpha1.Providers{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(blocked).To(BeFalse())
+		Expect(helmReleaseExists()).To(BeTrue())
+	})
+})
+
+var _ = DescribeTable("Management providers",
+	func(a, b hmcmirantiscomv1alpha1.Providers, subtracted hmcmirantiscomv1alpha1.Providers, intersect bool) {
+		Expect(subtractProviders(a, b)).To(Equal(subtracted))
+		Expect(providersIntersect(a, b)).To(Equal(intersect))
+	},
+	Entry("disjoint",
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}},
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"azure"}},
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}}, false),
+	Entry("overlapping",
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws", "azure"}, ControlPlaneProviders: []string{"k0s"}},
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"azure"}},
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}, ControlPlaneProviders: []string{"k0s"}}, true),
+	Entry("same provider of another kind",
+		hmcmirantiscomv1alpha1.Providers{BootstrapProviders: []string{"k0s"}},
+		hmcmirantiscomv1alpha1.Providers{ControlPlaneProviders: []string{"k0s"}},
+		hmcmirantiscomv1alpha1.Providers{BootstrapProviders: []string{"k0s"}}, false),
+	Entry("empty",
+		hmcmirantiscomv1alpha1.Providers{},
+		hmcmirantiscomv1alpha1.Providers{InfrastructureProviders: []string{"aws"}},
+		hmcmirantiscomv1alpha1.Providers{}, false),
+)
@@ -16,41 +16,427 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/awsaccount"
 )
 
+const (
+	// awsControllerIdentityKind and awsControllerIdentityName refer to the
+	// CAPA identity with the credentials of the CAPA controller, which are
+	// used to assume the role if the credentials Secret is not set.
+	awsControllerIdentityKind = "AWSClusterControllerIdentity"
+	awsControllerIdentityName = "default"
+
+	// The keys of the credentials in the Secret, the same as expected by CAPA.
+	awsAccessKeyIDKey     = "AccessKeyID"
+	awsSecretAccessKeyKey = "SecretAccessKey"
+	awsSessionTokenKey    = "SessionToken"
+)
+
+var awsInfrastructureGroupVersion = schema.GroupVersion{Group: "infrastructure.cluster.x-k8s.io", Version: "v1beta2"}
+
 // AWSProviderReconciler reconciles a AWSProvider object
 type AWSProviderReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// SystemNamespace is the namespace HMC and CAPA are installed to. The
+	// credentials of the static CAPA identities are copied to it, as CAPA
+	// reads them from its own namespace.
+	SystemNamespace string
+	// Validator validates the credentials of the accounts, defaults to the
+	// AWS SDK with the regional endpoints.
+	Validator awsaccount.Validator
 }
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the AWSProvider object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.17.3/pkg/reconcile
-func (r *AWSProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+// Reconcile creates the CAPA identity objects of the AWSProvider and validates
+// its credentials. The credentials are validated periodically, so the status
+// reflects the current reachability of the regions.
+func (r *AWSProviderReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	l := log.FromContext(ctx).WithValues("AWSProviderController", req.NamespacedName)
+	l.Info("Reconciling AWSProvider")
+
+	provider := &hmc.AWSProvider{}
+	if err := r.Get(ctx, req.NamespacedName, provider); err != nil {
+		if apierrors.IsNotFound(err) {
+			l.Info("AWSProvider not found, ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !provider.DeletionTimestamp.IsZero() {
+		l.Info("Deleting AWSProvider")
+		return ctrl.Result{}, r.delete(ctx, provider)
+	}
+
+	if controllerutil.AddFinalizer(provider, hmc.AWSProviderFinalizer) {
+		if err := r.Update(ctx, provider); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update AWSProvider %s: %w", req.NamespacedName, err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	defer func() {
+		err = errors.Join(err, r.updateStatus(ctx, provider))
+	}()
+
+	creds, err := r.credentials(ctx, provider)
+	if err != nil {
+		apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+			Type:    hmc.AWSCredentialsValidCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, err
+	}
+
+	identityRef, err := r.reconcileIdentities(ctx, provider, creds)
+	if err != nil {
+		msg := err.Error()
+		if apimeta.IsNoMatchError(err) {
+			msg = "CAPA identity CRDs are not installed"
+		}
+		apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+			Type:    hmc.AWSIdentityReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: msg,
+		})
+		return ctrl.Result{}, err
+	}
+	provider.Status.IdentityRef = identityRef
+	apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+		Type:    hmc.AWSIdentityReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  hmc.SucceededReason,
+		Message: fmt.Sprintf("%s %s is created", identityRef.Kind, identityRef.Name),
+	})
+
+	r.validate(ctx, provider, creds)
+	return ctrl.Result{RequeueAfter: defaultReconcileInterval}, nil
+}
+
+// credentials returns the credentials of the account from the Secret and the
+// role of the AWSProvider.
+func (r *AWSProviderReconciler) credentials(ctx context.Context, provider *hmc.AWSProvider) (awsaccount.Credentials, error) {
+	creds := awsaccount.Credentials{
+		RoleARN:    provider.Spec.RoleARN,
+		ExternalID: provider.Spec.ExternalID,
+	}
+	if provider.Spec.CredentialsSecretRef == nil {
+		if creds.RoleARN == "" {
+			return creds, errors.New("either credentialsSecretRef or roleARN must be set")
+		}
+		return creds, nil
+	}
+	secret := &corev1.Secret{}
+	secretRef := types.NamespacedName{Namespace: provider.Namespace, Name: provider.Spec.CredentialsSecretRef.Name}
+	if err := r.Get(ctx, secretRef, secret); err != nil {
+		return creds, fmt.Errorf("failed to get credentials Secret %s: %w", secretRef, err)
+	}
+	creds.AccessKeyID = string(secret.Data[awsAccessKeyIDKey])
+	creds.SecretAccessKey = string(secret.Data[awsSecretAccessKeyKey])
+	creds.SessionToken = string(secret.Data[awsSessionTokenKey])
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("credentials Secret %s must contain the %s and %s keys",
+			secretRef, awsAccessKeyIDKey, awsSecretAccessKeyKey)
+	}
+	return creds, nil
+}
+
+// reconcileIdentities creates the CAPA identity objects of the AWSProvider
+// usable from its namespace and removes the ones no longer needed. It returns
+// the reference to the identity to be used by the AWSClusters.
+func (r *AWSProviderReconciler) reconcileIdentities(ctx context.Context, provider *hmc.AWSProvider, creds awsaccount.Credentials) (*corev1.TypedLocalObjectReference, error) {
+	name := provider.IdentityName()
+	allowedNamespaces := map[string]interface{}{
+		"list": []interface{}{provider.Namespace},
+	}
+
+	sourceKind, sourceName := awsControllerIdentityKind, awsControllerIdentityName
+	if creds.AccessKeyID != "" {
+		secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: r.SystemNamespace}}
+		if _, err := ctrl.CreateOrUpdate(ctx, r.Client, secret, func() error {
+			if err := claimForAWSProvider(secret, provider); err != nil {
+				return err
+			}
+			secret.Data = map[string][]byte{
+				awsAccessKeyIDKey:     []byte(creds.AccessKeyID),
+				awsSecretAccessKeyKey: []byte(creds.SecretAccessKey),
+			}
+			if creds.SessionToken != "" {
+				secret.Data[awsSessionTokenKey] = []byte(creds.SessionToken)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to reconcile credentials Secret %s/%s: %w", r.SystemNamespace, name, err)
+		}
+
+		identity := awsIdentity(hmc.AWSClusterStaticIdentityKind, name)
+		if _, err := ctrl.CreateOrUpdate(ctx, r.Client, identity, func() error {
+			if err := claimForAWSProvider(identity, provider); err != nil {
+				return err
+			}
+			return unstructured.SetNestedMap(identity.Object, map[string]interface{}{
+				"secretRef":         name,
+				"allowedNamespaces": allowedNamespaces,
+			}, "spec")
+		}); err != nil {
+			return nil, fmt.Errorf("failed to reconcile %s %s: %w", hmc.AWSClusterStaticIdentityKind, name, err)
+		}
+		sourceKind, sourceName = hmc.AWSClusterStaticIdentityKind, name
+	} else {
+		if err := r.deleteIgnoreMissing(ctx, provider,
+			awsIdentity(hmc.AWSClusterStaticIdentityKind, name),
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: r.SystemNamespace}},
+		); err != nil {
+			return nil, err
+		}
+	}
 
-	// TODO(user): your logic here
+	if creds.RoleARN == "" {
+		if err := r.deleteIgnoreMissing(ctx, provider, awsIdentity(hmc.AWSClusterRoleIdentityKind, name)); err != nil {
+			return nil, err
+		}
+		return awsIdentityRef(hmc.AWSClusterStaticIdentityKind, name), nil
+	}
+
+	identity := awsIdentity(hmc.AWSClusterRoleIdentityKind, name)
+	if _, err := ctrl.CreateOrUpdate(ctx, r.Client, identity, func() error {
+		if err := claimForAWSProvider(identity, provider); err != nil {
+			return err
+		}
+		spec := map[string]interface{}{
+			"roleARN":           creds.RoleARN,
+			"sessionName":       name,
+			"allowedNamespaces": allowedNamespaces,
+			"sourceIdentityRef": map[string]interface{}{
+				"kind": sourceKind,
+				"name": sourceName,
+			},
+		}
+		if creds.ExternalID != "" {
+			spec["externalID"] = creds.ExternalID
+		}
+		return unstructured.SetNestedMap(identity.Object, spec, "spec")
+	}); err != nil {
+		return nil, fmt.Errorf("failed to reconcile %s %s: %w", hmc.AWSClusterRoleIdentityKind, name, err)
+	}
+	return awsIdentityRef(hmc.AWSClusterRoleIdentityKind, name), nil
+}
+
+// validate validates the credentials with the first region and checks the
+// reachability of all the regions, reporting the results in the status. The
+// role assumed with the credentials of the CAPA controller is not validated.
+func (r *AWSProviderReconciler) validate(ctx context.Context, provider *hmc.AWSProvider, creds awsaccount.Credentials) {
+	validator := r.Validator
+	if validator == nil {
+		validator = &awsaccount.SDKValidator{}
+	}
+	if creds.AccessKeyID == "" {
+		// CAPA assumes the role with the credentials of its controller, which
+		// HMC has no access to, so validating with any other credentials
+		// would not reflect whether the clusters can use the account.
+		provider.Status.AccountID = ""
+		provider.Status.ARN = ""
+		provider.Status.Regions = nil
+		provider.Status.LastValidationTime = nil
+		apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+			Type:    hmc.AWSCredentialsValidCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  hmc.AWSNotValidatedReason,
+			Message: "Role is assumed with the credentials of the CAPA controller and is not validated",
+		})
+		return
+	}
+
+	now := metav1.Now()
+	provider.Status.LastValidationTime = &now
+
+	var identity *awsaccount.Identity
+	err := errors.New("no regions are allowed")
+	if len(provider.Spec.Regions) > 0 {
+		identity, err = validator.GetIdentity(ctx, creds, provider.Spec.Regions[0])
+	}
+	if err != nil {
+		provider.Status.AccountID = ""
+		provider.Status.ARN = ""
+		provider.Status.Regions = nil
+		apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+			Type:    hmc.AWSCredentialsValidCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: err.Error(),
+		})
+		return
+	}
+	provider.Status.AccountID = identity.AccountID
+	provider.Status.ARN = identity.ARN
+
+	provider.Status.Regions = make([]hmc.AWSRegionStatus, 0, len(provider.Spec.Regions))
+	var unreachable []string
+	for _, region := range provider.Spec.Regions {
+		status := hmc.AWSRegionStatus{Name: region, Reachable: true}
+		if err := validator.CheckRegion(ctx, creds, region); err != nil {
+			status.Reachable = false
+			status.Message = err.Error()
+			unreachable = append(unreachable, region)
+		}
+		provider.Status.Regions = append(provider.Status.Regions, status)
+	}
+	if len(unreachable) > 0 {
+		apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+			Type:    hmc.AWSCredentialsValidCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  hmc.FailedReason,
+			Message: fmt.Sprintf("regions are not reachable: %s", strings.Join(unreachable, ", ")),
+		})
+		return
+	}
+	apimeta.SetStatusCondition(provider.GetConditions(), metav1.Condition{
+		Type:    hmc.AWSCredentialsValidCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  hmc.SucceededReason,
+		Message: fmt.Sprintf("Account %s is validated", identity.AccountID),
+	})
+}
+
+func (r *AWSProviderReconciler) updateStatus(ctx context.Context, provider *hmc.AWSProvider) error {
+	provider.Status.ObservedGeneration = provider.Generation
+	condition := metav1.Condition{
+		Type:    hmc.ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  hmc.SucceededReason,
+		Message: "AWSProvider is ready",
+	}
+	var errs []string
+	for _, c := range provider.Status.Conditions {
+		if c.Type != hmc.ReadyCondition && c.Status == metav1.ConditionFalse {
+			errs = append(errs, c.Message)
+		}
+	}
+	if len(errs) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = hmc.FailedReason
+		condition.Message = strings.Join(errs, ". ")
+	}
+	apimeta.SetStatusCondition(provider.GetConditions(), condition)
+	if err := r.Status().Update(ctx, provider); err != nil {
+		return fmt.Errorf("failed to update status for AWSProvider %s/%s: %w", provider.Namespace, provider.Name, err)
+	}
+	return nil
+}
+
+// delete removes the CAPA identity objects of the AWSProvider and its finalizer.
+func (r *AWSProviderReconciler) delete(ctx context.Context, provider *hmc.AWSProvider) error {
+	name := provider.IdentityName()
+	if err := r.deleteIgnoreMissing(ctx, provider,
+		awsIdentity(hmc.AWSClusterRoleIdentityKind, name),
+		awsIdentity(hmc.AWSClusterStaticIdentityKind, name),
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: r.SystemNamespace}},
+	); err != nil {
+		return err
+	}
+	if controllerutil.RemoveFinalizer(provider, hmc.AWSProviderFinalizer) {
+		if err := r.Update(ctx, provider); err != nil {
+			return fmt.Errorf("failed to update AWSProvider %s/%s: %w", provider.Namespace, provider.Name, err)
+		}
+	}
+	return nil
+}
+
+// deleteIgnoreMissing deletes the objects created for the AWSProvider ignoring
+// the ones which do not exist, including the ones whose CRDs are not
+// installed. The objects not created for the AWSProvider are kept.
+func (r *AWSProviderReconciler) deleteIgnoreMissing(ctx context.Context, provider *hmc.AWSProvider, objs ...client.Object) error {
+	var errs error
+	for _, obj := range objs {
+		err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+		if err == nil {
+			if obj.GetLabels()[hmc.AWSProviderLabelKey] != provider.IdentityName() {
+				continue
+			}
+			err = r.Delete(ctx, obj)
+		}
+		if err == nil || apierrors.IsNotFound(err) || apimeta.IsNoMatchError(err) {
+			continue
+		}
+		errs = errors.Join(errs, fmt.Errorf("failed to delete %s: %w", client.ObjectKeyFromObject(obj), err))
+	}
+	return errs
+}
+
+// awsIdentity returns the cluster-scoped CAPA identity object.
+func awsIdentity(kind, name string) *unstructured.Unstructured {
+	identity := &unstructured.Unstructured{}
+	identity.SetGroupVersionKind(awsInfrastructureGroupVersion.WithKind(kind))
+	identity.SetName(name)
+	return identity
+}
+
+func awsIdentityRef(kind, name string) *corev1.TypedLocalObjectReference {
+	apiGroup := awsInfrastructureGroupVersion.Group
+	return &corev1.TypedLocalObjectReference{APIGroup: &apiGroup, Kind: kind, Name: name}
+}
 
-	return ctrl.Result{}, nil
+// claimForAWSProvider marks the object as managed by HMC for the AWSProvider.
+// An existing object created for another AWSProvider or not by HMC at all is
+// not taken over.
+func claimForAWSProvider(obj client.Object, provider *hmc.AWSProvider) error {
+	if obj.GetResourceVersion() != "" && obj.GetLabels()[hmc.AWSProviderLabelKey] != provider.IdentityName() {
+		return fmt.Errorf("%s already exists and is not managed for the AWSProvider", client.ObjectKeyFromObject(obj))
+	}
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[hmc.HMCManagedLabelKey] = "true"
+	labels[hmc.AWSProviderLabelKey] = provider.IdentityName()
+	obj.SetLabels(labels)
+	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AWSProviderReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&hmcmirantiscomv1alpha1.AWSProvider{}).
+		For(&hmc.AWSProvider{}).
+		Watches(&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, o client.Object) []ctrl.Request {
+				// the credentials are revalidated as soon as the Secret changes
+				providers := &hmc.AWSProviderList{}
+				if err := r.List(ctx, providers, client.InNamespace(o.GetNamespace())); err != nil {
+					return nil
+				}
+				var requests []ctrl.Request
+				for _, provider := range providers.Items {
+					if ref := provider.Spec.CredentialsSecretRef; ref != nil && ref.Name == o.GetName() {
+						requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&provider)})
+					}
+				}
+				return requests
+			}),
+			// only the metadata of the Secrets is watched, their data is not cached
+			builder.OnlyMetadata,
+		).
 		Complete(r)
 }
@@ -16,18 +16,46 @@ package controller
 
 import (
 	"context"
+	"errors"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
-	"k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
-	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/awsaccount"
 )
 
+// fakeAWSValidator is the awsaccount.Validator accepting the credentials with
+// the known access key and reaching the known regions.
+type fakeAWSValidator struct {
+	accessKeyID string
+	regions     []string
+}
+
+func (f *fakeAWSValidator) GetIdentity(_ context.Context, creds awsaccount.Credentials, _ string) (*awsaccount.Identity, error) {
+	if creds.AccessKeyID != f.accessKeyID {
+		return nil, errors.New("invalid client token")
+	}
+	return &awsaccount.Identity{AccountID: "123456789012", ARN: "arn:aws:iam::123456789012:user/hmc"}, nil
+}
+
+func (f *fakeAWSValidator) CheckRegion(_ context.Context, _ awsaccount.Credentials, region string) error {
+	for _, r := range f.regions {
+		if r == region {
+			return nil
+		}
+	}
+	return errors.New("region is not enabled")
+}
+
 var _ = Describe("AWSProvider Controller", func() {
 	Context("When reconciling a resource", func() {
 		const resourceName = "test-resource"
@@ -36,47 +64,163 @@ var _ = Describe("AWSProvider Controller", func() {
 
 		typeNamespacedName := types.NamespacedName{
 			Name:      resourceName,
-			Namespace: "default", // TODO(user):Modify as needed
+			Namespace: "default",
 		}
-		awsprovider := &hmcmirantiscomv1alpha1.AWSProvider{}
 
 		BeforeEach(func() {
+			By("creating the credentials Secret")
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "aws-credentials", Namespace: "default"},
+				Data: map[string][]byte{
+					"AccessKeyID":     []byte("AKIATEST"),
+					"SecretAccessKey": []byte("secret"),
+				},
+			}
+			Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, secret)
+
 			By("creating the custom resource for the Kind AWSProvider")
-			err := k8sClient.Get(ctx, typeNamespacedName, awsprovider)
-			if err != nil && errors.IsNotFound(err) {
-				resource := &hmcmirantiscomv1alpha1.AWSProvider{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      resourceName,
-						Namespace: "default",
-					},
-					// TODO(user): Specify other spec details if needed.
-				}
-				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			resource := &hmc.AWSProvider{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      resourceName,
+					Namespace: "default",
+				},
+				Spec: hmc.AWSProviderSpec{
+					CredentialsSecretRef: &corev1.LocalObjectReference{Name: secret.Name},
+					Regions:              []string{"us-east-1", "eu-west-1"},
+				},
 			}
+			Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 		})
 
-		AfterEach(func() {
-			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &hmcmirantiscomv1alpha1.AWSProvider{}
-			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+		It("should create the identity and report the account", func() {
+			controllerReconciler := &AWSProviderReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: "default",
+				Validator:       &fakeAWSValidator{accessKeyID: "AKIATEST", regions: []string{"us-east-1"}},
+			}
+
+			By("Reconciling the created resource")
+			for range 2 {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			provider := &hmc.AWSProvider{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, provider)).To(Succeed())
+			identityName := provider.IdentityName()
+			Expect(provider.Finalizers).To(ContainElement(hmc.AWSProviderFinalizer))
+			Expect(provider.Status.AccountID).To(Equal("123456789012"))
+			Expect(provider.Status.IdentityRef).NotTo(BeNil())
+			Expect(provider.Status.IdentityRef.Kind).To(Equal(hmc.AWSClusterStaticIdentityKind))
+			Expect(provider.Status.IdentityRef.Name).To(Equal(identityName))
+			Expect(provider.Status.Regions).To(Equal([]hmc.AWSRegionStatus{
+				{Name: "us-east-1", Reachable: true},
+				{Name: "eu-west-1", Reachable: false, Message: "region is not enabled"},
+			}))
+
+			identity := awsIdentity(hmc.AWSClusterStaticIdentityKind, identityName)
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(identity), identity)).To(Succeed())
+			secretRef, _, _ := unstructured.NestedString(identity.Object, "spec", "secretRef")
+			Expect(secretRef).To(Equal(identityName))
+			allowed, _, _ := unstructured.NestedStringSlice(identity.Object, "spec", "allowedNamespaces", "list")
+			Expect(allowed).To(Equal([]string{"default"}))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: identityName}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue("AccessKeyID", []byte("AKIATEST")))
+
+			By("Deleting the resource")
+			Expect(k8sClient.Delete(ctx, provider)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(identity), identity))).To(BeTrue())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret))).To(BeTrue())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, provider))).To(BeTrue())
+		})
+
+		It("should not validate the role assumed with the credentials of CAPA", func() {
+			controllerReconciler := &AWSProviderReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: "default",
+				Validator:       &fakeAWSValidator{regions: []string{"us-east-1", "eu-west-1"}},
+			}
+
+			provider := &hmc.AWSProvider{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, provider)).To(Succeed())
+			provider.Spec.CredentialsSecretRef = nil
+			provider.Spec.RoleARN = "arn:aws:iam::123456789012:role/hmc"
+			Expect(k8sClient.Update(ctx, provider)).To(Succeed())
+
+			for range 2 {
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, provider)).To(Succeed())
+			Expect(provider.Status.IdentityRef).NotTo(BeNil())
+			Expect(provider.Status.IdentityRef.Kind).To(Equal(hmc.AWSClusterRoleIdentityKind))
+			Expect(provider.Status.AccountID).To(BeEmpty())
+			Expect(provider.Status.Regions).To(BeEmpty())
+			valid := apimeta.FindStatusCondition(provider.Status.Conditions, hmc.AWSCredentialsValidCondition)
+			Expect(valid).NotTo(BeNil())
+			Expect(valid.Status).To(Equal(metav1.ConditionUnknown))
+			Expect(valid.Reason).To(Equal(hmc.AWSNotValidatedReason))
+			Expect(apimeta.IsStatusConditionTrue(provider.Status.Conditions, hmc.ReadyCondition)).To(BeTrue())
+
+			identity := awsIdentity(hmc.AWSClusterRoleIdentityKind, provider.IdentityName())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(identity), identity)).To(Succeed())
+			sourceKind, _, _ := unstructured.NestedString(identity.Object, "spec", "sourceIdentityRef", "kind")
+			Expect(sourceKind).To(Equal(awsControllerIdentityKind))
 
-			By("Cleanup the specific resource instance AWSProvider")
-			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			By("Deleting the resource")
+			Expect(k8sClient.Delete(ctx, provider)).To(Succeed())
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(identity), identity))).To(BeTrue())
 		})
-		It("should successfully reconcile the resource", func() {
-			By("Reconciling the created resource")
+
+		It("should not take over the objects not created for the AWSProvider", func() {
 			controllerReconciler := &AWSProviderReconciler{
-				Client: k8sClient,
-				Scheme: k8sClient.Scheme(),
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: "default",
+				Validator:       &fakeAWSValidator{accessKeyID: "AKIATEST", regions: []string{"us-east-1"}},
 			}
 
-			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
-				NamespacedName: typeNamespacedName,
-			})
+			provider := &hmc.AWSProvider{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, provider)).To(Succeed())
+
+			By("creating a Secret with the name of the identity")
+			foreign := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      provider.IdentityName(),
+					Namespace: "default",
+					Labels:    map[string]string{hmc.AWSProviderLabelKey: "hmc-aws-other"},
+				},
+				Data: map[string][]byte{"AccessKeyID": []byte("AKIAOTHER")},
+			}
+			Expect(k8sClient.Create(ctx, foreign)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, foreign)
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring("already exists and is not managed for the AWSProvider")))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(foreign), secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue("AccessKeyID", []byte("AKIAOTHER")))
+
+			By("Deleting the resource")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, provider)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, provider)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(foreign), secret)).To(Succeed())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, provider))).To(BeTrue())
 		})
 	})
 })
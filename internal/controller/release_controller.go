@@ -16,29 +16,45 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"strings"
 	"time"
 
 	hcv2 "github.com/fluxcd/helm-controller/api/v2"
 	"github.com/fluxcd/pkg/apis/meta"
+	fluxconditions "github.com/fluxcd/pkg/runtime/conditions"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	hmc "github.com/Mirantis/hmc/api/v1alpha1"
 	"github.com/Mirantis/hmc/internal/build"
 	"github.com/Mirantis/hmc/internal/helm"
+	"github.com/Mirantis/hmc/internal/templates"
 )
 
 const (
-	pollPeriod    = 10 * time.Minute
-	errPollPeriod = 10 * time.Second
+	defaultPollPeriod       = 10 * time.Minute
+	defaultErrPollPeriod    = 10 * time.Second
+	defaultMaxErrPollPeriod = 5 * time.Minute
+	pollJitter              = 0.1
 
 	hmcTemplatesReleaseName = "hmc-templates"
+	ociScheme               = "oci"
+	genericRegistryProvider = "generic"
+	pollerControllerName    = "release"
 )
 
 // Poller reconciles a Template object
@@ -47,27 +63,86 @@ type Poller struct {
 
 	CreateManagement bool
 	CreateTemplates  bool
+	// EmbeddedTemplates makes the Poller apply the Templates embedded into the
+	// binary instead of installing the hmc-templates chart.
+	EmbeddedTemplates bool
 
-	DefaultOCIRegistry        string
+	SystemNamespace string
+	ManagementName  string
+
+	// DefaultRegistryURL is the URL of the default HelmRepository, either an
+	// oci:// URL of an OCI registry or an http(s):// URL of a Helm repository.
+	DefaultRegistryURL        string
 	RegistryCredentialsSecret string
-	InsecureRegistry          bool
-	HMCTemplatesChartName     string
+	// RegistryCertSecret is the name of the Secret with the CA certificate
+	// (ca.crt) and/or the client certificate (tls.crt and tls.key) used to
+	// connect to the default registry.
+	RegistryCertSecret string
+	// RegistryProvider is the provider used to authenticate to the default OCI
+	// registry: generic, aws, azure or gcp.
+	RegistryProvider      string
+	InsecureRegistry      bool
+	HMCTemplatesChartName string
+	// Installer installs the hmc-templates release, defaults to the Flux
+	// helm-controller.
+	Installer helm.Installer
+
+	// PollPeriod is the period of the sync after a successful one.
+	PollPeriod time.Duration
+	// ErrPollPeriod is the delay of the sync after a failed one. The delay
+	// doubles with each consecutive failure up to MaxErrPollPeriod.
+	ErrPollPeriod time.Duration
+	// MaxErrPollPeriod caps the delay of the sync after failed ones.
+	MaxErrPollPeriod time.Duration
+
+	// trigger runs the sync immediately, it is notified on the changes of the
+	// default HelmRepository and the hmc-templates HelmChart.
+	trigger chan struct{}
+}
+
+// errBackoff returns the backoff of the sync after failures, with jitter applied
+// to each step.
+func (p *Poller) errBackoff() wait.Backoff {
+	backoff := wait.Backoff{
+		Duration: p.ErrPollPeriod,
+		Cap:      p.MaxErrPollPeriod,
+		Factor:   2,
+		Jitter:   pollJitter,
+		Steps:    math.MaxInt32,
+	}
+	if backoff.Duration <= 0 {
+		backoff.Duration = defaultErrPollPeriod
+	}
+	if backoff.Cap <= 0 {
+		backoff.Cap = defaultMaxErrPollPeriod
+	}
+	return backoff
 }
 
 func (p *Poller) Start(ctx context.Context) error {
+	pollPeriod := p.PollPeriod
+	if pollPeriod <= 0 {
+		pollPeriod = defaultPollPeriod
+	}
+	backoff := p.errBackoff()
 	timer := time.NewTimer(0)
+	defer timer.Stop()
 	for {
 		select {
 		case <-timer.C:
-			err := p.Tick(ctx)
-			if err != nil {
-				timer.Reset(errPollPeriod)
-			} else {
-				timer.Reset(pollPeriod)
+		case <-p.trigger:
+			if !timer.Stop() {
+				<-timer.C
 			}
 		case <-ctx.Done():
 			return nil
 		}
+		if err := p.Tick(ctx); err != nil {
+			timer.Reset(backoff.Step())
+		} else {
+			backoff = p.errBackoff()
+			timer.Reset(wait.Jitter(pollPeriod, pollJitter))
+		}
 	}
 }
 
@@ -77,22 +152,59 @@ func (p *Poller) Tick(ctx context.Context) error {
 	l.Info("Poll is run")
 	defer l.Info("Poll is finished")
 
-	err := p.reconcileDefaultHelmRepo(ctx)
+	chartVersion, err := p.sync(ctx)
+	if statusErr := p.recordStatus(ctx, chartVersion, err); statusErr != nil {
+		l.Error(statusErr, "failed to record the sync status")
+	}
+	return err
+}
+
+func (p *Poller) sync(ctx context.Context) (chartVersion string, err error) {
+	l := log.FromContext(ctx)
+
+	err = p.reconcileDefaultHelmRepo(ctx)
 	if err != nil {
 		l.Error(err, "failed to reconcile default HelmRepository")
-		return err
+		return "", err
 	}
-	err = p.reconcileHMCTemplates(ctx)
+	chartVersion, err = p.reconcileHMCTemplates(ctx)
 	if err != nil {
 		l.Error(err, "failed to reconcile HMC Templates")
-		return err
+		return "", err
 	}
 	err = p.ensureManagement(ctx)
 	if err != nil {
 		l.Error(err, "failed to ensure default Management object")
-		return err
+		return "", err
 	}
-	return nil
+	return chartVersion, nil
+}
+
+// recordStatus records the result of the sync in the Management status. Nothing
+// is recorded until the Management object exists.
+func (p *Poller) recordStatus(ctx context.Context, chartVersion string, syncErr error) error {
+	mgmt := &hmc.Management{}
+	if err := p.Get(ctx, client.ObjectKey{Namespace: p.SystemNamespace, Name: p.ManagementName}, mgmt); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch := client.MergeFrom(mgmt.DeepCopy())
+	status := &hmc.TemplatesSyncStatus{}
+	if mgmt.Status.Templates != nil {
+		status = mgmt.Status.Templates.DeepCopy()
+	}
+	now := metav1.Now()
+	status.LastAttemptTime = &now
+	if syncErr != nil {
+		status.Error = syncErr.Error()
+		status.ConsecutiveFailures++
+	} else {
+		status.LastSyncTime = &now
+		status.ChartVersion = chartVersion
+		status.Error = ""
+		status.ConsecutiveFailures = 0
+	}
+	mgmt.Status.Templates = status
+	return p.Status().Patch(ctx, mgmt, patch)
 }
 
 func (p *Poller) ensureManagement(ctx context.Context) error {
@@ -102,23 +214,23 @@ func (p *Poller) ensureManagement(ctx context.Context) error {
 	l := log.FromContext(ctx)
 	mgmtObj := &hmc.Management{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:       hmc.ManagementName,
-			Namespace:  hmc.ManagementNamespace,
+			Name:       p.ManagementName,
+			Namespace:  p.SystemNamespace,
 			Finalizers: []string{hmc.ManagementFinalizer},
 		},
 	}
 	err := p.Get(ctx, client.ObjectKey{
-		Name:      hmc.ManagementName,
-		Namespace: hmc.ManagementNamespace,
+		Name:      p.ManagementName,
+		Namespace: p.SystemNamespace,
 	}, mgmtObj)
 	if err != nil {
 		if !apierrors.IsNotFound(err) {
-			return fmt.Errorf("failed to get %s/%s Management object", hmc.ManagementNamespace, hmc.ManagementName)
+			return fmt.Errorf("failed to get %s/%s Management object", p.SystemNamespace, p.ManagementName)
 		}
 		mgmtObj.Spec.SetDefaults()
 		err := p.Create(ctx, mgmtObj)
 		if err != nil {
-			return fmt.Errorf("failed to create %s/%s Management object", hmc.ManagementNamespace, hmc.ManagementName)
+			return fmt.Errorf("failed to create %s/%s Management object", p.SystemNamespace, p.ManagementName)
 		}
 		l.Info("Successfully created Management object with default configuration")
 	}
@@ -130,42 +242,100 @@ func (p *Poller) reconcileDefaultHelmRepo(ctx context.Context) error {
 	helmRepo := &sourcev1.HelmRepository{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      defaultRepoName,
-			Namespace: hmc.TemplatesNamespace,
+			Namespace: p.SystemNamespace,
 		},
 	}
 	operation, err := ctrl.CreateOrUpdate(ctx, p.Client, helmRepo, func() error {
 		helmRepo.Spec = sourcev1.HelmRepositorySpec{
-			Type:     defaultRepoType,
-			URL:      p.DefaultOCIRegistry,
+			Type:     p.defaultRepoType(),
+			URL:      p.DefaultRegistryURL,
 			Interval: metav1.Duration{Duration: defaultReconcileInterval},
 			Insecure: p.InsecureRegistry,
+			Provider: p.RegistryProvider,
+		}
+		if helmRepo.Spec.Provider == "" {
+			helmRepo.Spec.Provider = genericRegistryProvider
 		}
 		if p.RegistryCredentialsSecret != "" {
 			helmRepo.Spec.SecretRef = &meta.LocalObjectReference{
 				Name: p.RegistryCredentialsSecret,
 			}
 		}
+		if p.RegistryCertSecret != "" {
+			helmRepo.Spec.CertSecretRef = &meta.LocalObjectReference{
+				Name: p.RegistryCertSecret,
+			}
+		}
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 	if operation == controllerutil.OperationResultCreated || operation == controllerutil.OperationResultUpdated {
-		l.Info(fmt.Sprintf("Successfully %s %s/%s HelmRepository", operation, hmc.TemplatesNamespace, defaultRepoName))
+		l.Info(fmt.Sprintf("Successfully %s %s/%s HelmRepository", operation, p.SystemNamespace, defaultRepoName))
 	}
 	return nil
 }
 
-func (p *Poller) reconcileHMCTemplates(ctx context.Context) error {
+// defaultRepoType returns the type of the default HelmRepository inferred from
+// the scheme of its URL.
+func (p *Poller) defaultRepoType() string {
+	if strings.HasPrefix(p.DefaultRegistryURL, ociScheme+"://") {
+		return sourcev1.HelmRepositoryTypeOCI
+	}
+	return sourcev1.HelmRepositoryTypeDefault
+}
+
+// validate checks the settings of the default HelmRepository.
+func (p *Poller) validate() error {
+	u, err := url.Parse(p.DefaultRegistryURL)
+	if err != nil {
+		return fmt.Errorf("invalid default registry URL %q: %w", p.DefaultRegistryURL, err)
+	}
+	var errs error
+	switch u.Scheme {
+	case ociScheme, "http", "https":
+	default:
+		errs = errors.Join(errs, fmt.Errorf("default registry URL %q must be an oci://, http:// or https:// URL",
+			p.DefaultRegistryURL))
+	}
+	if u.Host == "" {
+		errs = errors.Join(errs, fmt.Errorf("default registry URL %q has no host", p.DefaultRegistryURL))
+	}
+	isOCI := p.defaultRepoType() == sourcev1.HelmRepositoryTypeOCI
+	if p.InsecureRegistry && !isOCI {
+		errs = errors.Join(errs, errors.New("insecure registry is only supported for OCI registries, "+
+			"use an http:// URL for an HTTP Helm repository"))
+	}
+	switch p.RegistryProvider {
+	case "", genericRegistryProvider:
+	case "aws", "azure", "gcp":
+		if !isOCI {
+			errs = errors.Join(errs, fmt.Errorf("registry provider %s is only supported for OCI registries",
+				p.RegistryProvider))
+		}
+	default:
+		errs = errors.Join(errs, fmt.Errorf("unknown registry provider %q, must be one of generic, aws, azure or gcp",
+			p.RegistryProvider))
+	}
+	return errs
+}
+
+// reconcileHMCTemplates reconciles the default Templates and returns the
+// version of the hmc-templates chart in use.
+func (p *Poller) reconcileHMCTemplates(ctx context.Context) (string, error) {
 	l := log.FromContext(ctx)
 	if !p.CreateTemplates {
 		l.Info("Reconciling HMC Templates is skipped")
-		return nil
+		return "", nil
+	}
+	if p.EmbeddedTemplates {
+		return "", p.reconcileEmbeddedTemplates(ctx)
 	}
 	helmChart := &sourcev1.HelmChart{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      p.HMCTemplatesChartName,
-			Namespace: hmc.TemplatesNamespace,
+			Namespace: p.SystemNamespace,
 		},
 	}
 
@@ -186,28 +356,142 @@ func (p *Poller) reconcileHMCTemplates(ctx context.Context) error {
 		return nil
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 	if operation == controllerutil.OperationResultCreated || operation == controllerutil.OperationResultUpdated {
-		l.Info(fmt.Sprintf("Successfully %s %s/%s HelmChart", operation, hmc.TemplatesNamespace, p.HMCTemplatesChartName))
+		l.Info(fmt.Sprintf("Successfully %s %s/%s HelmChart", operation, p.SystemNamespace, p.HMCTemplatesChartName))
 	}
 
 	err, _ = helm.ArtifactReady(helmChart)
 	if err != nil {
-		return fmt.Errorf("HelmChart %s/%s Artifact is not ready: %w", hmc.TemplatesNamespace, p.HMCTemplatesChartName, err)
+		return "", fmt.Errorf("HelmChart %s/%s Artifact is not ready: %w", p.SystemNamespace, p.HMCTemplatesChartName, err)
 	}
 
 	chartRef := &hcv2.CrossNamespaceSourceReference{
-		Kind:      helmChart.Kind,
+		Kind:      sourcev1.HelmChartKind,
 		Name:      helmChart.Name,
 		Namespace: helmChart.Namespace,
 	}
-	_, operation, err = helm.ReconcileHelmRelease(ctx, p.Client, hmcTemplatesReleaseName, hmc.TemplatesNamespace, nil, nil, chartRef, defaultReconcileInterval, nil)
+	hr, err := installerOrDefault(p.Installer, p.Client).Install(ctx, hmcTemplatesReleaseName, p.SystemNamespace,
+		helm.WithChartRef(chartRef),
+		helm.WithReconcileInterval(defaultReconcileInterval),
+	)
+	if err != nil {
+		return "", err
+	}
+	l.V(1).Info("Reconciled HelmRelease", "name", hmcTemplatesReleaseName, "ready", fluxconditions.IsReady(hr))
+	return helmChart.Status.Artifact.Revision, nil
+}
+
+// reconcileEmbeddedTemplates applies the Templates embedded into the binary. The
+// charts of such Templates are pulled from the default HelmRepository, so no
+// chart has to be downloaded before the Templates exist.
+func (p *Poller) reconcileEmbeddedTemplates(ctx context.Context) error {
+	l := log.FromContext(ctx)
+	embedded, err := templates.Templates()
 	if err != nil {
 		return err
 	}
-	if operation == controllerutil.OperationResultCreated || operation == controllerutil.OperationResultUpdated {
-		l.Info(fmt.Sprintf("Successfully %s %s/%s HelmRelease", operation, hmc.TemplatesNamespace, hmcTemplatesReleaseName))
+	var errs error
+	for _, t := range embedded {
+		template := &hmc.Template{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      t.Name,
+				Namespace: p.SystemNamespace,
+			},
+		}
+		operation, err := ctrl.CreateOrUpdate(ctx, p.Client, template, func() error {
+			if template.Labels == nil {
+				template.Labels = make(map[string]string)
+			}
+			template.Labels[hmc.HMCManagedLabelKey] = "true"
+			template.Spec = t.Spec
+			return nil
+		})
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to reconcile Template %s/%s: %w", p.SystemNamespace, t.Name, err))
+			continue
+		}
+		if operation == controllerutil.OperationResultCreated || operation == controllerutil.OperationResultUpdated {
+			l.Info(fmt.Sprintf("Successfully %s %s/%s Template", operation, p.SystemNamespace, t.Name))
+		}
 	}
-	return nil
+	return errs
+}
+
+// Reconcile triggers the sync on the changes of the default HelmRepository and
+// the hmc-templates HelmChart.
+func (p *Poller) Reconcile(context.Context, ctrl.Request) (ctrl.Result, error) {
+	select {
+	case p.trigger <- struct{}{}:
+	default:
+		// the sync is already triggered
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager adds the Poller to the Manager and sets up the controller
+// triggering the sync.
+func (p *Poller) SetupWithManager(mgr ctrl.Manager) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	p.trigger = make(chan struct{}, 1)
+	if err := mgr.Add(p); err != nil {
+		return err
+	}
+	isDefaultSource := predicate.NewPredicateFuncs(func(o client.Object) bool {
+		if o.GetNamespace() != p.SystemNamespace {
+			return false
+		}
+		switch o.(type) {
+		case *sourcev1.HelmRepository:
+			return o.GetName() == defaultRepoName
+		case *sourcev1.HelmChart:
+			return o.GetName() == p.HMCTemplatesChartName
+		}
+		return false
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(pollerControllerName).
+		For(&sourcev1.HelmRepository{}, builder.WithPredicates(isDefaultSource, sourceChanged)).
+		Watches(&sourcev1.HelmChart{}, &handler.EnqueueRequestForObject{},
+			builder.WithPredicates(isDefaultSource, sourceChanged)).
+		Complete(p)
+}
+
+// sourceChanged passes the changes of the spec, the artifact or the readiness of a source.
+var sourceChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		if e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() {
+			return true
+		}
+		oldSource, ok := e.ObjectOld.(sourcev1.Source)
+		if !ok {
+			return true
+		}
+		newSource, ok := e.ObjectNew.(sourcev1.Source)
+		if !ok {
+			return true
+		}
+		if artifactRevision(oldSource) != artifactRevision(newSource) {
+			return true
+		}
+		oldGetter, ok := e.ObjectOld.(fluxconditions.Getter)
+		if !ok {
+			return true
+		}
+		newGetter, ok := e.ObjectNew.(fluxconditions.Getter)
+		if !ok {
+			return true
+		}
+		return fluxconditions.IsReady(oldGetter) != fluxconditions.IsReady(newGetter)
+	},
+}
+
+func artifactRevision(source sourcev1.Source) string {
+	if artifact := source.GetArtifact(); artifact != nil {
+		return artifact.Revision
+	}
+	return ""
 }
@@ -0,0 +1,126 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+var _ = Describe("Release Controller", func() {
+	Context("When syncing the default HelmRepository and Templates", func() {
+		const namespace = "poller-test"
+		const managementName = "hmc"
+
+		ctx := context.Background()
+		managementRef := types.NamespacedName{Name: managementName, Namespace: namespace}
+
+		BeforeEach(func() {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+			err := k8sClient.Create(ctx, ns)
+			if !apierrors.IsAlreadyExists(err) {
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		AfterEach(func() {
+			mgmt := &hmcmirantiscomv1alpha1.Management{}
+			Expect(k8sClient.Get(ctx, managementRef, mgmt)).To(Succeed())
+			mgmt.Finalizers = nil
+			Expect(k8sClient.Update(ctx, mgmt)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, mgmt)).To(Succeed())
+
+			helmRepo := &sourcev1.HelmRepository{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: defaultRepoName, Namespace: namespace}, helmRepo)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, helmRepo)).To(Succeed())
+		})
+
+		It("should record the sync status in the Management", func() {
+			poller := &Poller{
+				Client:             k8sClient,
+				CreateManagement:   true,
+				SystemNamespace:    namespace,
+				ManagementName:     managementName,
+				DefaultRegistryURL: "oci://test/charts",
+			}
+
+			By("Running the sync creating the Management")
+			Expect(poller.Tick(ctx)).To(Succeed())
+
+			mgmt := &hmcmirantiscomv1alpha1.Management{}
+			Expect(k8sClient.Get(ctx, managementRef, mgmt)).To(Succeed())
+			Expect(mgmt.Status.Templates).NotTo(BeNil())
+			Expect(mgmt.Status.Templates.LastSyncTime).NotTo(BeNil())
+			Expect(mgmt.Status.Templates.Error).To(BeEmpty())
+			lastSyncTime := mgmt.Status.Templates.LastSyncTime
+
+			helmRepo := &sourcev1.HelmRepository{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: defaultRepoName, Namespace: namespace}, helmRepo)).To(Succeed())
+			Expect(helmRepo.Spec.Type).To(Equal(sourcev1.HelmRepositoryTypeOCI))
+			Expect(helmRepo.Spec.Provider).To(Equal("generic"))
+
+			By("Recording failed syncs")
+			Expect(poller.recordStatus(ctx, "", errors.New("chart is not ready"))).To(Succeed())
+			Expect(poller.recordStatus(ctx, "", errors.New("chart is not ready"))).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, managementRef, mgmt)).To(Succeed())
+			Expect(mgmt.Status.Templates.Error).To(Equal("chart is not ready"))
+			Expect(mgmt.Status.Templates.ConsecutiveFailures).To(BeEquivalentTo(2))
+			Expect(mgmt.Status.Templates.LastSyncTime.Equal(lastSyncTime)).To(BeTrue())
+
+			By("Recording a successful sync")
+			Expect(poller.recordStatus(ctx, "0.1.0", nil)).To(Succeed())
+
+			Expect(k8sClient.Get(ctx, managementRef, mgmt)).To(Succeed())
+			Expect(mgmt.Status.Templates.Error).To(BeEmpty())
+			Expect(mgmt.Status.Templates.ConsecutiveFailures).To(BeZero())
+			Expect(mgmt.Status.Templates.ChartVersion).To(Equal("0.1.0"))
+		})
+	})
+
+	Context("When validating the default registry settings", func() {
+		It("should infer the repository type from the URL", func() {
+			Expect((&Poller{DefaultRegistryURL: "oci://registry.local/charts"}).defaultRepoType()).
+				To(Equal(sourcev1.HelmRepositoryTypeOCI))
+			Expect((&Poller{DefaultRegistryURL: "https://charts.example.com/hmc"}).defaultRepoType()).
+				To(Equal(sourcev1.HelmRepositoryTypeDefault))
+		})
+
+		It("should reject invalid settings", func() {
+			Expect((&Poller{
+				DefaultRegistryURL: "https://charts.example.com/hmc",
+				RegistryCertSecret: "hmc-charts-ca",
+				RegistryProvider:   "generic",
+			}).validate()).To(Succeed())
+			Expect((&Poller{DefaultRegistryURL: "ftp://charts.example.com"}).validate()).NotTo(Succeed())
+			Expect((&Poller{DefaultRegistryURL: "https://charts.example.com", InsecureRegistry: true}).validate()).
+				NotTo(Succeed())
+			Expect((&Poller{DefaultRegistryURL: "https://charts.example.com", RegistryProvider: "aws"}).validate()).
+				NotTo(Succeed())
+			Expect((&Poller{DefaultRegistryURL: "oci://registry.local/charts", RegistryProvider: "oracle"}).validate()).
+				NotTo(Succeed())
+		})
+	})
+})
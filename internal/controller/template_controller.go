@@ -17,14 +17,17 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	helmcontrollerv2 "github.com/fluxcd/helm-controller/api/v2"
 	v2 "github.com/fluxcd/helm-controller/api/v2"
 	sourcev1 "github.com/fluxcd/source-controller/api/v1"
 	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -32,28 +35,34 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	hmc "github.com/Mirantis/hmc/api/v1alpha1"
 	"github.com/Mirantis/hmc/internal/helm"
+	"github.com/Mirantis/hmc/pkg/templatechart"
 )
 
 const (
 	defaultRepoName = "hmc-templates"
-	defaultRepoType = "oci"
 
 	defaultReconcileInterval = 10 * time.Minute
-)
 
-var (
-	errNoProviderType = fmt.Errorf("template type is not supported: %s chart annotation must be one of [%s/%s/%s]",
-		hmc.ChartAnnotationType, hmc.TemplateTypeDeployment, hmc.TemplateTypeProvider, hmc.TemplateTypeCore)
+	catalogConfigMapSuffix = "-catalog"
+	// maxCatalogDocumentSize limits the size of README and CHANGELOG stored in the
+	// catalog ConfigMap, which can not exceed 1MiB in total.
+	maxCatalogDocumentSize = 256 * 1024
 )
 
 // TemplateReconciler reconciles a Template object
 type TemplateReconciler struct {
 	client.Client
-	Scheme                *runtime.Scheme
+	// APIReader reads the ConfigMaps not visible to the cache of the Client,
+	// which only contains the ones managed by HMC. Defaults to the Client.
+	APIReader client.Reader
+	Scheme    *runtime.Scheme
+	// Downloader downloads the charts of the Templates.
+	Downloader            *helm.Downloader
 	downloadHelmChartFunc func(context.Context, *sourcev1.Artifact) (*chart.Chart, error)
 }
 
@@ -113,7 +122,7 @@ func (r *TemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	artifact := hcChart.Status.Artifact
 
 	if r.downloadHelmChartFunc == nil {
-		r.downloadHelmChartFunc = helm.DownloadChartFromArtifact
+		r.downloadHelmChartFunc = r.Downloader.DownloadChartFromArtifact
 	}
 
 	l.Info("Downloading Helm chart")
@@ -145,55 +154,134 @@ func (r *TemplateReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 	template.Status.Config = &apiextensionsv1.JSON{Raw: rawValues}
+	template.Status.ValuesSchema = nil
+	if len(helmChart.Schema) > 0 {
+		if !json.Valid(helmChart.Schema) {
+			err = errors.New("values schema of the Helm chart is not a valid JSON")
+			l.Error(err, "Helm chart validation failed")
+			_ = r.updateStatus(ctx, template, err.Error())
+			return ctrl.Result{}, err
+		}
+		template.Status.ValuesSchema = &apiextensionsv1.JSON{Raw: helmChart.Schema}
+	}
 	l.Info("Chart validation completed successfully")
 
+	if err := r.reconcileCatalog(ctx, template, helmChart); err != nil {
+		l.Error(err, "Failed to reconcile Template catalog entry")
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, r.updateStatus(ctx, template, "")
 }
 
+// parseChartMetadata sets the HMC metadata of the chart in the status of the Template.
 func (r *TemplateReconciler) parseChartMetadata(template *hmc.Template, chart *chart.Chart) error {
-	if chart.Metadata == nil {
-		return fmt.Errorf("chart metadata is empty")
+	template.Status.Warnings = nil
+	metadata, err := templatechart.ParseMetadata(chart, &template.Spec)
+	if err != nil {
+		return err
 	}
-	// the value in spec has higher priority
-	templateType := template.Spec.Type
-	if templateType == "" {
-		templateType = hmc.TemplateType(chart.Metadata.Annotations[hmc.ChartAnnotationType])
-		switch templateType {
-		case hmc.TemplateTypeDeployment, hmc.TemplateTypeProvider, hmc.TemplateTypeCore:
-		default:
-			return errNoProviderType
-		}
+	template.Status.Type = metadata.Type
+	template.Status.DependsOn = metadata.DependsOn
+	template.Status.GlobalValues = metadata.GlobalValues
+	template.Status.Providers = metadata.Providers
+	template.Status.Warnings = metadata.Warnings
+	return nil
+}
+
+// reconcileCatalog publishes the chart metadata and documentation of the template
+// in a ConfigMap, so the templates can be listed without downloading the charts.
+func (r *TemplateReconciler) reconcileCatalog(ctx context.Context, template *hmc.Template, helmChart *chart.Chart) error {
+	maintainers, err := json.Marshal(helmChart.Metadata.Maintainers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chart maintainers: %w", err)
+	}
+	keywords, err := json.Marshal(helmChart.Metadata.Keywords)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chart keywords: %w", err)
 	}
-	template.Status.Type = templateType
 
-	// the value in spec has higher priority
-	if len(template.Spec.Providers.InfrastructureProviders) > 0 {
-		template.Status.Providers.InfrastructureProviders = template.Spec.Providers.InfrastructureProviders
-	} else {
-		infraProviders := chart.Metadata.Annotations[hmc.ChartAnnotationInfraProviders]
-		if infraProviders != "" {
-			template.Status.Providers.InfrastructureProviders = strings.Split(infraProviders, ",")
-		}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      template.Name + catalogConfigMapSuffix,
+			Namespace: template.Namespace,
+		},
 	}
-	if len(template.Spec.Providers.BootstrapProviders) > 0 {
-		template.Status.Providers.BootstrapProviders = template.Spec.Providers.BootstrapProviders
-	} else {
-		bootstrapProviders := chart.Metadata.Annotations[hmc.ChartAnnotationBootstrapProviders]
-		if bootstrapProviders != "" {
-			template.Status.Providers.BootstrapProviders = strings.Split(bootstrapProviders, ",")
+	mutate := func(cm *corev1.ConfigMap) error {
+		if cm.Labels == nil {
+			cm.Labels = make(map[string]string)
 		}
-	}
-	if len(template.Spec.Providers.ControlPlaneProviders) > 0 {
-		template.Status.Providers.ControlPlaneProviders = template.Spec.Providers.ControlPlaneProviders
-	} else {
-		cpProviders := chart.Metadata.Annotations[hmc.ChartAnnotationControlPlaneProviders]
-		if cpProviders != "" {
-			template.Status.Providers.ControlPlaneProviders = strings.Split(cpProviders, ",")
+		cm.Labels[hmc.HMCManagedLabelKey] = "true"
+		cm.Labels[hmc.TemplateCatalogLabelKey] = template.Name
+		// the Template controls the ConfigMap, so the catalog entry is restored
+		// when it is modified or deleted
+		if err := controllerutil.SetControllerReference(template, cm, r.Client.Scheme()); err != nil {
+			return err
+		}
+		cm.Data = map[string]string{
+			hmc.CatalogKeyType:        string(template.Status.Type),
+			hmc.CatalogKeyDescription: helmChart.Metadata.Description,
+			hmc.CatalogKeyVersion:     helmChart.Metadata.Version,
+			hmc.CatalogKeyAppVersion:  helmChart.Metadata.AppVersion,
+			hmc.CatalogKeyIcon:        helmChart.Metadata.Icon,
+			hmc.CatalogKeyKeywords:    string(keywords),
+			hmc.CatalogKeyMaintainers: string(maintainers),
+			hmc.CatalogKeyReadme:      chartDocument(helmChart, "README.md"),
+			hmc.CatalogKeyChangelog:   chartDocument(helmChart, "CHANGELOG.md"),
 		}
+		return nil
+	}
+	_, err = ctrl.CreateOrUpdate(ctx, r.Client, cm, func() error { return mutate(cm) })
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// the ConfigMap exists but is not labeled as managed by HMC, so it is not
+	// visible to the cache: it is read from the API server and adopted, unless
+	// it is controlled by another object
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	existing := &corev1.ConfigMap{}
+	key := client.ObjectKeyFromObject(cm)
+	if err := reader.Get(ctx, key, existing); err != nil {
+		return fmt.Errorf("failed to get ConfigMap %s: %w", key, err)
+	}
+	if err := mutate(existing); err != nil {
+		return fmt.Errorf("failed to adopt ConfigMap %s: %w", key, err)
+	}
+	if err := r.Update(ctx, existing); err != nil {
+		return fmt.Errorf("failed to adopt ConfigMap %s: %w", key, err)
 	}
 	return nil
 }
 
+// chartDocument returns the content of the top-level chart file with the given name,
+// matched case-insensitively. The content is truncated to fit into the catalog ConfigMap.
+func chartDocument(helmChart *chart.Chart, name string) string {
+	for _, f := range helmChart.Files {
+		if f == nil || !strings.EqualFold(f.Name, name) {
+			continue
+		}
+		return truncateUTF8(f.Data, maxCatalogDocumentSize)
+	}
+	return ""
+}
+
+// truncateUTF8 returns data as a string of at most size bytes without splitting
+// a multi-byte UTF-8 character.
+func truncateUTF8(data []byte, size int) string {
+	if len(data) <= size {
+		return string(data)
+	}
+	end := size
+	for end > 0 && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	return string(data[:end])
+}
+
 func (r *TemplateReconciler) updateStatus(ctx context.Context, template *hmc.Template, validationError string) error {
 	template.Status.ObservedGeneration = template.Generation
 	template.Status.ValidationError = validationError
@@ -265,5 +353,6 @@ func (r *TemplateReconciler) getHelmChartFromChartRef(ctx context.Context, chart
 func (r *TemplateReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&hmc.Template{}).
+		Owns(&corev1.ConfigMap{}).
 		Complete(r)
 }
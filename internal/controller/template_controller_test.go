@@ -22,9 +22,11 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
@@ -45,6 +47,7 @@ var _ = Describe("Template Controller", func() {
 					Version:    "0.1.0",
 					Name:       "test-chart",
 				},
+				Schema: []byte(`{"type":"object"}`),
 			}, nil
 		}
 
@@ -145,8 +148,149 @@ var _ = Describe("Template Controller", func() {
 				NamespacedName: typeNamespacedName,
 			})
 			Expect(err).NotTo(HaveOccurred())
-			// TODO(user): Add more specific assertions depending on your controller's reconciliation logic.
-			// Example: If you expect a certain status condition after reconciliation, verify it here.
+
+			By("Checking the Template catalog entry")
+			catalog := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{
+				Name:      resourceName + catalogConfigMapSuffix,
+				Namespace: typeNamespacedName.Namespace,
+			}, catalog)).To(Succeed())
+			Expect(catalog.Labels).To(HaveKeyWithValue(hmcmirantiscomv1alpha1.TemplateCatalogLabelKey, resourceName))
+			Expect(catalog.Data).To(HaveKeyWithValue(hmcmirantiscomv1alpha1.CatalogKeyVersion, "0.1.0"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, template)).To(Succeed())
+			Expect(metav1.IsControlledBy(catalog, template)).To(BeTrue())
+			Expect(template.Status.ValuesSchema).NotTo(BeNil())
+			Expect(template.Status.ValuesSchema.Raw).To(MatchJSON(`{"type":"object"}`))
+		})
+
+		It("should adopt the catalog ConfigMap not visible to the cache", func() {
+			controllerReconciler := &TemplateReconciler{
+				Client:                &managedConfigMapsClient{Client: k8sClient},
+				APIReader:             k8sClient,
+				Scheme:                k8sClient.Scheme(),
+				downloadHelmChartFunc: fakeDownloadHelmChartFunc,
+			}
+
+			By("creating the catalog ConfigMap not managed by HMC")
+			catalog := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      resourceName + catalogConfigMapSuffix,
+				Namespace: typeNamespacedName.Namespace,
+			}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, catalog.DeepCopy()))).To(Succeed())
+			catalog.Data = map[string]string{"stale": "true"}
+			Expect(k8sClient.Create(ctx, catalog)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, catalog)
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(catalog), catalog)).To(Succeed())
+			Expect(catalog.Labels).To(HaveKeyWithValue(hmcmirantiscomv1alpha1.HMCManagedLabelKey, "true"))
+			Expect(catalog.Data).To(HaveKeyWithValue(hmcmirantiscomv1alpha1.CatalogKeyVersion, "0.1.0"))
+			Expect(catalog.Data).NotTo(HaveKey("stale"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, template)).To(Succeed())
+			Expect(metav1.IsControlledBy(catalog, template)).To(BeTrue())
+		})
+
+		It("should not adopt the catalog ConfigMap controlled by another object", func() {
+			controllerReconciler := &TemplateReconciler{
+				Client:                &managedConfigMapsClient{Client: k8sClient},
+				APIReader:             k8sClient,
+				Scheme:                k8sClient.Scheme(),
+				downloadHelmChartFunc: fakeDownloadHelmChartFunc,
+			}
+
+			By("creating the catalog ConfigMap controlled by another object")
+			catalog := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+				Name:      resourceName + catalogConfigMapSuffix,
+				Namespace: typeNamespacedName.Namespace,
+			}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, catalog.DeepCopy()))).To(Succeed())
+			controller := true
+			catalog.OwnerReferences = []metav1.OwnerReference{{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Name:       "other",
+				UID:        types.UID("6f7c3b5e-0d7a-4f55-9a55-2c4a8f0e6f11"),
+				Controller: &controller,
+			}}
+			Expect(k8sClient.Create(ctx, catalog)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, catalog)
+
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring("failed to adopt ConfigMap")))
+
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(catalog), catalog)).To(Succeed())
+			Expect(catalog.Labels).NotTo(HaveKey(hmcmirantiscomv1alpha1.HMCManagedLabelKey))
 		})
 	})
 })
+
+// managedConfigMapsClient is the client not finding the ConfigMaps not managed
+// by HMC, as the cache of the manager.
+type managedConfigMapsClient struct {
+	client.Client
+}
+
+func (c *managedConfigMapsClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return c.Client.Get(ctx, key, obj, opts...)
+	}
+	found := &corev1.ConfigMap{}
+	if err := c.Client.Get(ctx, key, found, opts...); err != nil {
+		return err
+	}
+	if found.Labels[hmcmirantiscomv1alpha1.HMCManagedLabelKey] != "true" {
+		return errors.NewNotFound(corev1.Resource("configmaps"), key.Name)
+	}
+	found.DeepCopyInto(cm)
+	return nil
+}
+
+var _ = Describe("Template chart metadata", func() {
+	It("should normalize providers and report unknown ones as warnings", func() {
+		template := &hmcmirantiscomv1alpha1.Template{}
+		helmChart := &chart.Chart{
+			Metadata: &chart.Metadata{
+				Annotations: map[string]string{
+					hmcmirantiscomv1alpha1.ChartAnnotationType:                  "deployment",
+					hmcmirantiscomv1alpha1.ChartAnnotationInfraProviders:        " aws, aws,,unknown",
+					hmcmirantiscomv1alpha1.ChartAnnotationControlPlaneProviders: "k0smotron",
+				},
+			},
+		}
+
+		Expect((&TemplateReconciler{}).parseChartMetadata(template, helmChart)).To(Succeed())
+		Expect(template.Status.Type).To(Equal(hmcmirantiscomv1alpha1.TemplateTypeDeployment))
+		Expect(template.Status.Providers.InfrastructureProviders).To(Equal([]string{"aws", "unknown"}))
+		Expect(template.Status.Providers.ControlPlaneProviders).To(Equal([]string{"k0smotron"}))
+		Expect(template.Status.Warnings).To(ConsistOf(`unknown infrastructure provider "unknown"`))
+	})
+
+	It("should fail on unknown hmc.mirantis.com annotations", func() {
+		template := &hmcmirantiscomv1alpha1.Template{}
+		helmChart := &chart.Chart{
+			Metadata: &chart.Metadata{
+				Annotations: map[string]string{
+					hmcmirantiscomv1alpha1.ChartAnnotationType: "deployment",
+					"hmc.mirantis.com/controlplane-providers":  "k0smotron",
+				},
+			},
+		}
+
+		err := (&TemplateReconciler{}).parseChartMetadata(template, helmChart)
+		Expect(err).To(MatchError(ContainSubstring("hmc.mirantis.com/controlplane-providers")))
+	})
+})
+
+var _ = Describe("Template catalog documents", func() {
+	It("should truncate the documents at a UTF-8 character boundary", func() {
+		// "é" is encoded as two bytes
+		data := []byte("aé")
+		Expect(truncateUTF8(data, 3)).To(Equal("aé"))
+		Expect(truncateUTF8(data, 2)).To(Equal("a"))
+		Expect(truncateUTF8(data, 1)).To(Equal("a"))
+		Expect(truncateUTF8(data, 0)).To(Equal(""))
+	})
+})
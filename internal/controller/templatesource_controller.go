@@ -0,0 +1,522 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"helm.sh/helm/v3/pkg/repo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
+)
+
+// TemplateSourceReconciler reconciles a TemplateSource object
+type TemplateSourceReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	// SystemNamespace is the namespace HMC is installed to.
+	SystemNamespace string
+	// Downloader downloads the indexes of the repositories.
+	Downloader        *helm.Downloader
+	downloadIndexFunc func(context.Context, *sourcev1.Artifact) (*repo.IndexFile, error)
+}
+
+func (r *TemplateSourceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	l := log.FromContext(ctx).WithValues("TemplateSourceController", req.NamespacedName)
+	log.IntoContext(ctx, l)
+	l.Info("Reconciling TemplateSource")
+
+	source := &hmc.TemplateSource{}
+	if err := r.Get(ctx, req.NamespacedName, source); err != nil {
+		if apierrors.IsNotFound(err) {
+			l.Info("TemplateSource not found, ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		l.Error(err, "Failed to get TemplateSource")
+		return ctrl.Result{}, err
+	}
+	if !source.DeletionTimestamp.IsZero() {
+		l.Info("Deleting TemplateSource")
+		return r.delete(ctx, source)
+	}
+
+	if controllerutil.AddFinalizer(source, hmc.TemplateSourceFinalizer) {
+		if err := r.Update(ctx, source); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update TemplateSource %s: %w", req.NamespacedName, err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if source.Namespace != r.SystemNamespace {
+		err := fmt.Errorf("TemplateSource must be created in the %s namespace", r.SystemNamespace)
+		return ctrl.Result{}, r.updateStatus(ctx, source, nil, err)
+	}
+
+	helmRepo, err := r.reconcileHelmRepository(ctx, source)
+	if err != nil {
+		l.Error(err, "Failed to reconcile HelmRepository")
+		return ctrl.Result{}, errors.Join(err, r.updateStatus(ctx, source, nil, err))
+	}
+
+	charts := source.Spec.Charts
+	if source.Spec.Selector != nil {
+		// nothing is generated nor pruned until the index is available, the
+		// HelmRepository is watched for its updates
+		selected, err := r.selectCharts(ctx, source, helmRepo)
+		if err != nil {
+			if errors.Is(err, errIndexNotReady) {
+				l.Info("Repository index is not ready yet")
+				return ctrl.Result{}, r.updateStatus(ctx, source, source.Status.Templates, err)
+			}
+			l.Error(err, "Failed to select charts")
+			return ctrl.Result{}, errors.Join(err, r.updateStatus(ctx, source, source.Status.Templates, err))
+		}
+		charts = append(slices.Clone(charts), selected...)
+	}
+
+	if err := validateTemplateNames(charts); err != nil {
+		return ctrl.Result{}, r.updateStatus(ctx, source, nil, err)
+	}
+
+	var errs error
+	var templates []string
+	desiredTemplates := make([]string, 0, len(charts))
+	for _, chart := range charts {
+		desiredTemplates = append(desiredTemplates, chart.TemplateName())
+		if err := r.reconcileTemplate(ctx, source, chart); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		templates = append(templates, chart.TemplateName())
+	}
+	inUse, err := r.pruneTemplates(ctx, source, desiredTemplates)
+	if err != nil {
+		errs = errors.Join(errs, err)
+	}
+	if errs != nil {
+		l.Error(errs, "Failed to reconcile Templates")
+		return ctrl.Result{}, errors.Join(errs, r.updateStatus(ctx, source, templates, errs))
+	}
+	if len(inUse) > 0 {
+		l.Info("Removal of Templates is blocked by their users, retrying", "templates", inUse)
+		err := fmt.Errorf("templates no longer selected are still in use: %s", strings.Join(inUse, "; "))
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(ctx, source, templates, err)
+	}
+	return ctrl.Result{}, r.updateStatus(ctx, source, templates, nil)
+}
+
+// delete removes the Templates generated from the TemplateSource and its
+// finalizer. The deletion is blocked while any of the Templates is in use, the
+// remaining generated objects are removed by the garbage collector.
+func (r *TemplateSourceReconciler) delete(ctx context.Context, source *hmc.TemplateSource) (ctrl.Result, error) {
+	l := log.FromContext(ctx)
+
+	inUse, err := r.pruneTemplates(ctx, source, nil)
+	if err != nil {
+		l.Error(err, "Failed to remove Templates")
+		return ctrl.Result{}, errors.Join(err, r.updateStatus(ctx, source, source.Status.Templates, err))
+	}
+	if len(inUse) > 0 {
+		l.Info("Deletion of TemplateSource is blocked by the users of its Templates, retrying", "templates", inUse)
+		err := fmt.Errorf("deletion is blocked by the templates still in use: %s", strings.Join(inUse, "; "))
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, r.updateStatus(ctx, source, source.Status.Templates, err)
+	}
+
+	l.Info("Removing Finalizer", "finalizer", hmc.TemplateSourceFinalizer)
+	if controllerutil.RemoveFinalizer(source, hmc.TemplateSourceFinalizer) {
+		if err := r.Update(ctx, source); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update TemplateSource %s/%s: %w", source.Namespace, source.Name, err)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// validateTemplateNames checks the charts of the TemplateSource generate
+// Templates with distinct names.
+func validateTemplateNames(charts []hmc.TemplateSourceChart) error {
+	seen := make(map[string]struct{}, len(charts))
+	var errs error
+	for _, chart := range charts {
+		name := chart.TemplateName()
+		if _, ok := seen[name]; ok {
+			errs = errors.Join(errs, fmt.Errorf("template %s is generated from more than one chart", name))
+			continue
+		}
+		seen[name] = struct{}{}
+	}
+	return errs
+}
+
+// generatedObjectMeta sets the labels and the owner reference of the object generated from the TemplateSource.
+func generatedObjectMeta(obj client.Object, source *hmc.TemplateSource) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[hmc.HMCManagedLabelKey] = "true"
+	labels[hmc.TemplateSourceLabelKey] = source.Name
+	obj.SetLabels(labels)
+	obj.SetOwnerReferences([]metav1.OwnerReference{
+		{
+			APIVersion: hmc.GroupVersion.String(),
+			Kind:       hmc.TemplateSourceKind,
+			Name:       source.Name,
+			UID:        source.UID,
+		},
+	})
+}
+
+// checkGeneratedFrom returns an error if the existing object is not generated
+// from the TemplateSource, so such objects are never taken over.
+func checkGeneratedFrom(obj client.Object, kind string, source *hmc.TemplateSource) error {
+	if created := obj.GetCreationTimestamp(); created.IsZero() || isOwnedBy(obj, source) {
+		return nil
+	}
+	return fmt.Errorf("%s %s/%s already exists and is not managed by the TemplateSource",
+		kind, obj.GetNamespace(), obj.GetName())
+}
+
+func (r *TemplateSourceReconciler) reconcileHelmRepository(ctx context.Context, source *hmc.TemplateSource) (*sourcev1.HelmRepository, error) {
+	helmRepo := &sourcev1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      source.Name,
+			Namespace: source.Namespace,
+		},
+	}
+	_, err := ctrl.CreateOrUpdate(ctx, r.Client, helmRepo, func() error {
+		if err := checkGeneratedFrom(helmRepo, sourcev1.HelmRepositoryKind, source); err != nil {
+			return err
+		}
+		generatedObjectMeta(helmRepo, source)
+		helmRepo.Spec = sourcev1.HelmRepositorySpec{
+			Type:          source.Spec.Type,
+			URL:           source.Spec.URL,
+			SecretRef:     source.Spec.SecretRef,
+			CertSecretRef: source.Spec.CertSecretRef,
+			Insecure:      source.Spec.Insecure,
+			Interval:      templateSourceInterval(source),
+		}
+		return nil
+	})
+	return helmRepo, err
+}
+
+// errIndexNotReady is returned when the index of the HelmRepository is not fetched yet.
+var errIndexNotReady = errors.New("repository index is not ready yet")
+
+// selectCharts returns the chart versions of the repository index selected by
+// the selector of the TemplateSource. The Template of a selected version is
+// named after the chart and the version.
+func (r *TemplateSourceReconciler) selectCharts(ctx context.Context, source *hmc.TemplateSource, helmRepo *sourcev1.HelmRepository) ([]hmc.TemplateSourceChart, error) {
+	selector := source.Spec.Selector
+	namePattern := selector.Name
+	if namePattern == "" {
+		namePattern = "*"
+	}
+	if _, err := path.Match(namePattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid chart name pattern %q: %w", selector.Name, err)
+	}
+	var versionRange *semver.Constraints
+	if selector.Version != "" {
+		var err error
+		if versionRange, err = semver.NewConstraint(selector.Version); err != nil {
+			return nil, fmt.Errorf("invalid version range %q: %w", selector.Version, err)
+		}
+	}
+
+	if err := indexReady(helmRepo); err != nil {
+		return nil, err
+	}
+	if r.downloadIndexFunc == nil {
+		r.downloadIndexFunc = r.Downloader.DownloadIndexFromArtifact
+	}
+	index, err := r.downloadIndexFunc(ctx, helmRepo.Status.Artifact)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index of HelmRepository %s/%s: %w", helmRepo.Namespace, helmRepo.Name, err)
+	}
+
+	var charts []hmc.TemplateSourceChart
+	for name, versions := range index.Entries {
+		if ok, _ := path.Match(namePattern, name); !ok {
+			continue
+		}
+		for _, v := range versions {
+			version, err := semver.NewVersion(v.Version)
+			if err != nil {
+				continue
+			}
+			if versionRange != nil {
+				if !versionRange.Check(version) {
+					continue
+				}
+			} else if version.Prerelease() != "" {
+				continue
+			}
+			charts = append(charts, hmc.TemplateSourceChart{
+				Name:     name,
+				Version:  v.Version,
+				Template: versionedTemplateName(name, v.Version),
+			})
+		}
+	}
+	slices.SortFunc(charts, func(a, b hmc.TemplateSourceChart) int {
+		return strings.Compare(a.Template, b.Template)
+	})
+	return charts, nil
+}
+
+// indexReady returns errIndexNotReady until the HelmRepository has fetched the
+// index of its current spec.
+func indexReady(helmRepo *sourcev1.HelmRepository) error {
+	ready := apimeta.FindStatusCondition(helmRepo.Status.Conditions, hmc.ReadyCondition)
+	if ready == nil || ready.ObservedGeneration != helmRepo.Generation || helmRepo.Status.Artifact == nil {
+		return errIndexNotReady
+	}
+	if ready.Status != metav1.ConditionTrue {
+		return fmt.Errorf("%w: %s", errIndexNotReady, ready.Message)
+	}
+	return nil
+}
+
+// versionedTemplateName returns the name of the Template of the chart version,
+// e.g. aws-standalone-cp-0-1-0 for the version 0.1.0 of aws-standalone-cp.
+func versionedTemplateName(chart, version string) string {
+	return strings.ToLower(chart + "-" + strings.NewReplacer(".", "-", "+", "-").Replace(version))
+}
+
+// reconcileTemplate generates the HelmChart and the Template for the chart of the TemplateSource.
+func (r *TemplateSourceReconciler) reconcileTemplate(ctx context.Context, source *hmc.TemplateSource, chart hmc.TemplateSourceChart) error {
+	templateName := chart.TemplateName()
+	helmChart := &sourcev1.HelmChart{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      source.Name + "-" + templateName,
+			Namespace: source.Namespace,
+		},
+	}
+	_, err := ctrl.CreateOrUpdate(ctx, r.Client, helmChart, func() error {
+		if err := checkGeneratedFrom(helmChart, sourcev1.HelmChartKind, source); err != nil {
+			return err
+		}
+		generatedObjectMeta(helmChart, source)
+		helmChart.Spec = sourcev1.HelmChartSpec{
+			Chart:   chart.Name,
+			Version: chart.Version,
+			SourceRef: sourcev1.LocalHelmChartSourceReference{
+				Kind: sourcev1.HelmRepositoryKind,
+				Name: source.Name,
+			},
+			Interval: templateSourceInterval(source),
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile HelmChart %s/%s: %w", helmChart.Namespace, helmChart.Name, err)
+	}
+
+	template := &hmc.Template{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      templateName,
+			Namespace: source.Namespace,
+		},
+	}
+	_, err = ctrl.CreateOrUpdate(ctx, r.Client, template, func() error {
+		if err := checkGeneratedFrom(template, hmc.TemplateKind, source); err != nil {
+			return err
+		}
+		generatedObjectMeta(template, source)
+		template.Spec.Helm = hmc.HelmSpec{
+			ChartRef: &hcv2.CrossNamespaceSourceReference{
+				Kind:      sourcev1.HelmChartKind,
+				Name:      helmChart.Name,
+				Namespace: helmChart.Namespace,
+			},
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reconcile Template %s/%s: %w", template.Namespace, template.Name, err)
+	}
+	return nil
+}
+
+// pruneTemplates deletes the Templates and HelmCharts generated from the
+// TemplateSource which are not desired. The Templates still used by Deployments
+// or Management components are kept, their users are returned instead.
+func (r *TemplateSourceReconciler) pruneTemplates(ctx context.Context, source *hmc.TemplateSource, desiredTemplates []string) (inUse []string, err error) {
+	l := log.FromContext(ctx)
+
+	selector := client.MatchingLabels{hmc.TemplateSourceLabelKey: source.Name}
+
+	templates := &hmc.TemplateList{}
+	if err := r.List(ctx, templates, client.InNamespace(source.Namespace), selector); err != nil {
+		return nil, fmt.Errorf("failed to list Templates: %w", err)
+	}
+	var users map[string][]string
+	var errs error
+	for i := range templates.Items {
+		template := &templates.Items[i]
+		if slices.Contains(desiredTemplates, template.Name) || !isOwnedBy(template, source) {
+			continue
+		}
+		if users == nil {
+			if users, err = r.templateUsers(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if len(users[template.Name]) > 0 {
+			desiredTemplates = append(desiredTemplates, template.Name)
+			inUse = append(inUse, fmt.Sprintf("%s used by %s", template.Name, strings.Join(users[template.Name], ", ")))
+			continue
+		}
+		l.Info("Removing Template which is no longer generated from the TemplateSource", "name", template.Name)
+		if err := r.Delete(ctx, template); client.IgnoreNotFound(err) != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to delete Template %s/%s: %w", template.Namespace, template.Name, err))
+		}
+	}
+
+	desiredCharts := make([]string, 0, len(desiredTemplates))
+	for _, name := range desiredTemplates {
+		desiredCharts = append(desiredCharts, source.Name+"-"+name)
+	}
+	helmCharts := &sourcev1.HelmChartList{}
+	if err := r.List(ctx, helmCharts, client.InNamespace(source.Namespace), selector); err != nil {
+		return inUse, errors.Join(errs, fmt.Errorf("failed to list HelmCharts: %w", err))
+	}
+	for i := range helmCharts.Items {
+		helmChart := &helmCharts.Items[i]
+		if slices.Contains(desiredCharts, helmChart.Name) || !isOwnedBy(helmChart, source) {
+			continue
+		}
+		if err := r.Delete(ctx, helmChart); client.IgnoreNotFound(err) != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to delete HelmChart %s/%s: %w", helmChart.Namespace, helmChart.Name, err))
+		}
+	}
+	return inUse, errs
+}
+
+// templateUsers returns the Deployments and the Management components using
+// the Templates by the Template names. The components use both the Templates
+// of the spec and the Templates they are currently installed from.
+func (r *TemplateSourceReconciler) templateUsers(ctx context.Context) (map[string][]string, error) {
+	users := make(map[string][]string)
+	addUser := func(template, user string) {
+		if template != "" && !slices.Contains(users[template], user) {
+			users[template] = append(users[template], user)
+		}
+	}
+
+	deployments := &hmc.DeploymentList{}
+	if err := r.List(ctx, deployments); err != nil {
+		return nil, fmt.Errorf("failed to list Deployments: %w", err)
+	}
+	for _, deployment := range deployments.Items {
+		user := "Deployment " + deployment.Namespace + "/" + deployment.Name
+		addUser(deployment.Spec.Template, user)
+		for _, svc := range deployment.Spec.Services {
+			addUser(svc.Template, user)
+		}
+	}
+
+	managements := &hmc.ManagementList{}
+	if err := r.List(ctx, managements); err != nil {
+		return nil, fmt.Errorf("failed to list Managements: %w", err)
+	}
+	for i := range managements.Items {
+		mgmt := &managements.Items[i]
+		var release *hmc.Release
+		if mgmt.Spec.Release != "" {
+			release = &hmc.Release{}
+			err := r.Get(ctx, types.NamespacedName{Namespace: r.SystemNamespace, Name: mgmt.Spec.Release}, release)
+			if err != nil {
+				if !apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("failed to get Release %s/%s: %w", r.SystemNamespace, mgmt.Spec.Release, err)
+				}
+				release = nil
+			}
+		}
+		for _, c := range wrappedComponents(mgmt, release) {
+			addUser(c.Template, "Management component "+c.Name)
+		}
+		for name, status := range mgmt.Status.Components {
+			addUser(status.Template, "Management component "+name)
+		}
+	}
+	return users, nil
+}
+
+func (r *TemplateSourceReconciler) updateStatus(ctx context.Context, source *hmc.TemplateSource, templates []string, err error) error {
+	source.Status.ObservedGeneration = source.Generation
+	source.Status.Templates = templates
+	condition := metav1.Condition{
+		Type:    hmc.ReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  hmc.SucceededReason,
+		Message: "Templates are generated",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = hmc.FailedReason
+		condition.Message = err.Error()
+	}
+	apimeta.SetStatusCondition(source.GetConditions(), condition)
+	if err := r.Status().Update(ctx, source); err != nil {
+		return fmt.Errorf("failed to update status for TemplateSource %s/%s: %w", source.Namespace, source.Name, err)
+	}
+	return nil
+}
+
+func templateSourceInterval(source *hmc.TemplateSource) metav1.Duration {
+	if source.Spec.Interval != nil {
+		return *source.Spec.Interval
+	}
+	return metav1.Duration{Duration: defaultReconcileInterval}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TemplateSourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	enqueueTemplateSource := handler.EnqueueRequestsFromMapFunc(func(_ context.Context, o client.Object) []ctrl.Request {
+		name, ok := o.GetLabels()[hmc.TemplateSourceLabelKey]
+		if !ok {
+			return nil
+		}
+		return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: o.GetNamespace(), Name: name}}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&hmc.TemplateSource{}).
+		Watches(&hmc.Template{}, enqueueTemplateSource).
+		// the charts of the selector are resolved again once the index is updated
+		Watches(&sourcev1.HelmRepository{}, enqueueTemplateSource).
+		Complete(r)
+}
@@ -0,0 +1,412 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	hmcmirantiscomv1alpha1 "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+var _ = Describe("TemplateSource Controller", func() {
+	Context("When reconciling a resource", func() {
+		const resourceName = "test-source"
+		const namespace = "default"
+
+		ctx := context.Background()
+
+		typeNamespacedName := types.NamespacedName{
+			Name:      resourceName,
+			Namespace: namespace,
+		}
+
+		BeforeEach(func() {
+			By("creating the custom resource for the Kind TemplateSource")
+			source := &hmcmirantiscomv1alpha1.TemplateSource{}
+			err := k8sClient.Get(ctx, typeNamespacedName, source)
+			if err != nil && errors.IsNotFound(err) {
+				resource := &hmcmirantiscomv1alpha1.TemplateSource{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      resourceName,
+						Namespace: namespace,
+					},
+					Spec: hmcmirantiscomv1alpha1.TemplateSourceSpec{
+						Type: hmcmirantiscomv1alpha1.TemplateSourceTypeOCI,
+						URL:  "oci://test/templates",
+						Charts: []hmcmirantiscomv1alpha1.TemplateSourceChart{
+							{Name: "first-chart", Version: "0.1.0"},
+							{Name: "second-chart", Template: "second-template"},
+						},
+					},
+				}
+				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			resource := &hmcmirantiscomv1alpha1.TemplateSource{}
+			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Cleanup the specific resource instance TemplateSource")
+			resource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+		})
+
+		It("should generate and prune the Templates", func() {
+			controllerReconciler := &TemplateSourceReconciler{
+				Client:          k8sClient,
+				Scheme:          k8sClient.Scheme(),
+				SystemNamespace: namespace,
+			}
+
+			By("Reconciling the created resource")
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			helmRepo := &sourcev1.HelmRepository{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, helmRepo)).To(Succeed())
+			Expect(helmRepo.Spec.URL).To(Equal("oci://test/templates"))
+
+			helmChart := &sourcev1.HelmChart{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: resourceName + "-first-chart"}, helmChart)).To(Succeed())
+			Expect(helmChart.Spec.Chart).To(Equal("first-chart"))
+			Expect(helmChart.Spec.Version).To(Equal("0.1.0"))
+
+			template := &hmcmirantiscomv1alpha1.Template{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "second-template"}, template)).To(Succeed())
+			Expect(template.Labels).To(HaveKeyWithValue(hmcmirantiscomv1alpha1.TemplateSourceLabelKey, resourceName))
+			Expect(template.Spec.Helm.ChartRef.Name).To(Equal(resourceName + "-second-template"))
+
+			By("Removing a chart from the TemplateSource")
+			source := &hmcmirantiscomv1alpha1.TemplateSource{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, source)).To(Succeed())
+			source.Spec.Charts = source.Spec.Charts[:1]
+			Expect(k8sClient.Update(ctx, source)).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+				NamespacedName: typeNamespacedName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "second-template"}, template)
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, source)).To(Succeed())
+			Expect(source.Status.Templates).To(Equal([]string{"first-chart"}))
+		})
+	})
+})
+
+var _ = Describe("TemplateSource Templates removal", func() {
+	const namespace = "default"
+
+	ctx := context.Background()
+	sourceRef := types.NamespacedName{Name: "in-use-source", Namespace: namespace}
+	var reconciler *TemplateSourceReconciler
+
+	BeforeEach(func() {
+		reconciler = &TemplateSourceReconciler{
+			Client:          k8sClient,
+			Scheme:          k8sClient.Scheme(),
+			SystemNamespace: namespace,
+		}
+		Expect(k8sClient.Create(ctx, &hmcmirantiscomv1alpha1.TemplateSource{
+			ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name, Namespace: namespace},
+			Spec: hmcmirantiscomv1alpha1.TemplateSourceSpec{
+				Type: hmcmirantiscomv1alpha1.TemplateSourceTypeOCI,
+				URL:  "oci://test/templates",
+				Charts: []hmcmirantiscomv1alpha1.TemplateSourceChart{
+					{Name: "kept-chart"},
+					{Name: "used-chart"},
+				},
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		if err := k8sClient.Get(ctx, sourceRef, source); err == nil {
+			source.Finalizers = nil
+			Expect(k8sClient.Update(ctx, source)).To(Succeed())
+		}
+		for _, obj := range []client.Object{
+			&hmcmirantiscomv1alpha1.TemplateSource{ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name, Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "in-use-deployment", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Template{ObjectMeta: metav1.ObjectMeta{Name: "kept-chart", Namespace: namespace}},
+			&hmcmirantiscomv1alpha1.Template{ObjectMeta: metav1.ObjectMeta{Name: "used-chart", Namespace: namespace}},
+			&sourcev1.HelmChart{ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name + "-kept-chart", Namespace: namespace}},
+			&sourcev1.HelmChart{ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name + "-used-chart", Namespace: namespace}},
+			&sourcev1.HelmRepository{ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name, Namespace: namespace}},
+		} {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, obj))).To(Succeed())
+		}
+	})
+
+	reconcileSource := func() {
+		for range 2 {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	It("should keep the Templates used by Deployments", func() {
+		reconcileSource()
+		Expect(k8sClient.Create(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "in-use-deployment", Namespace: namespace},
+			Spec:       hmcmirantiscomv1alpha1.DeploymentSpec{Template: "used-chart"},
+		})).To(Succeed())
+
+		By("Removing the used chart from the TemplateSource")
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		source.Spec.Charts = source.Spec.Charts[:1]
+		Expect(k8sClient.Update(ctx, source)).To(Succeed())
+
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "used-chart"}, &hmcmirantiscomv1alpha1.Template{})).To(Succeed())
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: sourceRef.Name + "-used-chart"}, &sourcev1.HelmChart{})).To(Succeed())
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		ready := apimeta.FindStatusCondition(source.Status.Conditions, hmcmirantiscomv1alpha1.ReadyCondition)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Message).To(ContainSubstring("used-chart used by Deployment default/in-use-deployment"))
+
+		By("Removing the Template once the Deployment is deleted")
+		Expect(k8sClient.Delete(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "in-use-deployment", Namespace: namespace},
+		})).To(Succeed())
+		result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "used-chart"}, &hmcmirantiscomv1alpha1.Template{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should reject charts generating Templates with the same name", func() {
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		source.Spec.Charts[1].Template = "kept-chart"
+		Expect(k8sClient.Update(ctx, source)).To(Succeed())
+
+		reconcileSource()
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		ready := apimeta.FindStatusCondition(source.Status.Conditions, hmcmirantiscomv1alpha1.ReadyCondition)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Message).To(ContainSubstring("template kept-chart is generated from more than one chart"))
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "kept-chart"}, &hmcmirantiscomv1alpha1.Template{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should block the deletion while the Templates are in use", func() {
+		reconcileSource()
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		Expect(source.Finalizers).To(ContainElement(hmcmirantiscomv1alpha1.TemplateSourceFinalizer))
+		Expect(k8sClient.Create(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "in-use-deployment", Namespace: namespace},
+			Spec:       hmcmirantiscomv1alpha1.DeploymentSpec{Template: "used-chart"},
+		})).To(Succeed())
+
+		By("Deleting the TemplateSource")
+		Expect(k8sClient.Delete(ctx, source)).To(Succeed())
+		result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(BeZero())
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		Expect(source.Finalizers).To(ContainElement(hmcmirantiscomv1alpha1.TemplateSourceFinalizer))
+		ready := apimeta.FindStatusCondition(source.Status.Conditions, hmcmirantiscomv1alpha1.ReadyCondition)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Message).To(ContainSubstring("used-chart used by Deployment default/in-use-deployment"))
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "used-chart"}, &hmcmirantiscomv1alpha1.Template{})).To(Succeed())
+		err = k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "kept-chart"}, &hmcmirantiscomv1alpha1.Template{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+
+		By("Releasing the TemplateSource once the Deployment is deleted")
+		Expect(k8sClient.Delete(ctx, &hmcmirantiscomv1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "in-use-deployment", Namespace: namespace},
+		})).To(Succeed())
+		result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		err = k8sClient.Get(ctx, sourceRef, source)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("TemplateSource selector", func() {
+	const namespace = "default"
+
+	ctx := context.Background()
+	sourceRef := types.NamespacedName{Name: "selector-source", Namespace: namespace}
+	var reconciler *TemplateSourceReconciler
+	var index *repo.IndexFile
+
+	// newIndex returns the index of the chart versions.
+	newIndex := func(versions ...[2]string) *repo.IndexFile {
+		index := repo.NewIndexFile()
+		for _, v := range versions {
+			md := &chart.Metadata{APIVersion: chart.APIVersionV2, Name: v[0], Version: v[1]}
+			Expect(index.MustAdd(md, v[0]+"-"+v[1]+".tgz", "https://test/charts", "")).To(Succeed())
+		}
+		return index
+	}
+
+	reconcileSource := func() {
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: sourceRef})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		index = newIndex(
+			[2]string{"aws-cluster", "0.0.1"},
+			[2]string{"aws-cluster", "0.1.0"},
+			[2]string{"aws-cluster", "0.2.0"},
+			[2]string{"aws-cluster", "0.3.0-rc.1"},
+			[2]string{"azure-cluster", "0.1.0"},
+		)
+		reconciler = &TemplateSourceReconciler{
+			Client:          k8sClient,
+			Scheme:          k8sClient.Scheme(),
+			SystemNamespace: namespace,
+			downloadIndexFunc: func(context.Context, *sourcev1.Artifact) (*repo.IndexFile, error) {
+				return index, nil
+			},
+		}
+		Expect(k8sClient.Create(ctx, &hmcmirantiscomv1alpha1.TemplateSource{
+			ObjectMeta: metav1.ObjectMeta{Name: sourceRef.Name, Namespace: namespace},
+			Spec: hmcmirantiscomv1alpha1.TemplateSourceSpec{
+				Type: hmcmirantiscomv1alpha1.TemplateSourceTypeDefault,
+				URL:  "https://test/charts",
+				Selector: &hmcmirantiscomv1alpha1.TemplateSourceSelector{
+					Name:    "aws-*",
+					Version: ">=0.1.0",
+				},
+			},
+		})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		source.Finalizers = nil
+		Expect(k8sClient.Update(ctx, source)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, source)).To(Succeed())
+		generated := client.MatchingLabels{hmcmirantiscomv1alpha1.TemplateSourceLabelKey: sourceRef.Name}
+		Expect(k8sClient.DeleteAllOf(ctx, &hmcmirantiscomv1alpha1.Template{}, client.InNamespace(namespace), generated)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &sourcev1.HelmChart{}, client.InNamespace(namespace), generated)).To(Succeed())
+		Expect(k8sClient.DeleteAllOf(ctx, &sourcev1.HelmRepository{}, client.InNamespace(namespace), generated)).To(Succeed())
+	})
+
+	It("should generate the Templates of the selected chart versions of the index", func() {
+		reconcileSource()
+		reconcileSource()
+
+		By("Waiting for the index of the HelmRepository")
+		source := &hmcmirantiscomv1alpha1.TemplateSource{}
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		ready := apimeta.FindStatusCondition(source.Status.Conditions, hmcmirantiscomv1alpha1.ReadyCondition)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Message).To(Equal("repository index is not ready yet"))
+
+		helmRepo := &sourcev1.HelmRepository{}
+		Expect(k8sClient.Get(ctx, sourceRef, helmRepo)).To(Succeed())
+		helmRepo.Status.Artifact = &sourcev1.Artifact{
+			Path:           "helmrepository/default/selector-source/index.yaml",
+			URL:            "http://source-controller/helmrepository/default/selector-source/index.yaml",
+			Revision:       "sha256:0",
+			LastUpdateTime: metav1.Now(),
+		}
+		apimeta.SetStatusCondition(&helmRepo.Status.Conditions, metav1.Condition{
+			Type:               hmcmirantiscomv1alpha1.ReadyCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             hmcmirantiscomv1alpha1.SucceededReason,
+			ObservedGeneration: helmRepo.Generation,
+		})
+		Expect(k8sClient.Status().Update(ctx, helmRepo)).To(Succeed())
+
+		reconcileSource()
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		Expect(source.Status.Templates).To(Equal([]string{"aws-cluster-0-1-0", "aws-cluster-0-2-0"}))
+		helmChart := &sourcev1.HelmChart{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: sourceRef.Name + "-aws-cluster-0-1-0"}, helmChart)).To(Succeed())
+		Expect(helmChart.Spec.Chart).To(Equal("aws-cluster"))
+		Expect(helmChart.Spec.Version).To(Equal("0.1.0"))
+
+		By("Pruning the Templates of the versions removed from the index")
+		index = newIndex(
+			[2]string{"aws-cluster", "0.2.0"},
+			[2]string{"azure-cluster", "0.1.0"},
+		)
+		reconcileSource()
+		Expect(k8sClient.Get(ctx, sourceRef, source)).To(Succeed())
+		Expect(source.Status.Templates).To(Equal([]string{"aws-cluster-0-2-0"}))
+		err := k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "aws-cluster-0-1-0"}, &hmcmirantiscomv1alpha1.Template{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Template users", func() {
+	It("should collect the Templates of the Management components", func() {
+		ctx := context.Background()
+		reconciler := &TemplateSourceReconciler{Client: k8sClient, SystemNamespace: "default"}
+		mgmt := &hmcmirantiscomv1alpha1.Management{
+			ObjectMeta: metav1.ObjectMeta{Name: "template-users", Namespace: "default"},
+			Spec: hmcmirantiscomv1alpha1.ManagementSpec{
+				Core: &hmcmirantiscomv1alpha1.Core{
+					HMC:  hmcmirantiscomv1alpha1.Component{Template: "users-hmc"},
+					CAPI: hmcmirantiscomv1alpha1.Component{Template: "users-capi"},
+				},
+				Providers: []hmcmirantiscomv1alpha1.Component{{Template: "users-capa"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mgmt)).To(Succeed())
+		mgmt.Status.Components = map[string]hmcmirantiscomv1alpha1.ComponentStatus{
+			"users-capa": {Template: "users-capa-0-0-1"},
+		}
+		Expect(k8sClient.Status().Update(ctx, mgmt)).To(Succeed())
+
+		users, err := reconciler.templateUsers(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(users).To(HaveKeyWithValue("users-hmc", []string{"Management component users-hmc"}))
+		Expect(users).To(HaveKeyWithValue("users-capi", []string{"Management component users-capi"}))
+		Expect(users).To(HaveKeyWithValue("users-capa", []string{"Management component users-capa"}))
+		Expect(users).To(HaveKeyWithValue("users-capa-0-0-1", []string{"Management component users-capa"}))
+		Expect(k8sClient.Delete(ctx, mgmt)).To(Succeed())
+	})
+})
@@ -0,0 +1,339 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-retryablehttp"
+	godigest "github.com/opencontainers/go-digest"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultMaxChartSize is the default maximum size of a chart archive.
+	DefaultMaxChartSize = 10 << 20
+	// MaxIndexSize is the maximum size of a Helm repository index.
+	MaxIndexSize = 100 << 20
+	// DefaultDownloadTimeout is the default timeout of a single download request.
+	DefaultDownloadTimeout = time.Minute
+	// DefaultDownloadRetries is the default number of retries of a failed download request.
+	DefaultDownloadRetries = 4
+	// DefaultDownloadRetryWaitMin is the default minimum wait between the retries.
+	DefaultDownloadRetryWaitMin = time.Second
+	// DefaultDownloadRetryWaitMax is the default maximum wait between the retries.
+	DefaultDownloadRetryWaitMax = 30 * time.Second
+)
+
+// DownloadOptions configures the Downloader. The zero value uses the defaults.
+type DownloadOptions struct {
+	// MaxSize is the maximum size of a chart archive in bytes.
+	MaxSize int64
+	// Timeout is the timeout of a single download request, including reading
+	// the response body.
+	Timeout time.Duration
+	// Retries is the number of retries of a failed download request. Negative
+	// value disables the retries.
+	Retries int
+	// RetryWaitMin and RetryWaitMax bound the exponential backoff between the retries.
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	// CAFile is the path of the PEM bundle of the CA certificates trusted in
+	// addition to the system ones.
+	CAFile string
+	// ProxyURL is the URL of the HTTP proxy. The proxy is taken from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables if not set.
+	ProxyURL string
+}
+
+// Downloader downloads the chart archives of the source artifacts. The nil
+// Downloader uses the default options.
+type Downloader struct {
+	client    *retryablehttp.Client
+	transport *http.Transport
+	opts      DownloadOptions
+
+	// the basic auth credentials are only sent to the authHost
+	authHost string
+	username string
+	password string
+}
+
+// defaultDownloader is the Downloader with the default options used by the
+// nil Downloader. The default options need no validation.
+var defaultDownloader = newDownloader(DownloadOptions{}.withDefaults(), cleanhttp.DefaultPooledTransport())
+
+// errChartTooLarge is returned when the chart archive exceeds the maximum size.
+var errChartTooLarge = errors.New("chart archive exceeds the maximum size")
+
+// withDefaults returns the options with the defaults of the unset ones.
+func (opts DownloadOptions) withDefaults() DownloadOptions {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxChartSize
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultDownloadTimeout
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultDownloadRetries
+	} else if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryWaitMin <= 0 {
+		opts.RetryWaitMin = DefaultDownloadRetryWaitMin
+	}
+	if opts.RetryWaitMax <= 0 {
+		opts.RetryWaitMax = DefaultDownloadRetryWaitMax
+	}
+	return opts
+}
+
+// NewDownloader returns the Downloader configured by the options.
+func NewDownloader(opts DownloadOptions) (*Downloader, error) {
+	opts = opts.withDefaults()
+	if opts.RetryWaitMax < opts.RetryWaitMin {
+		return nil, fmt.Errorf("maximum retry wait %s is less than the minimum %s", opts.RetryWaitMax, opts.RetryWaitMin)
+	}
+
+	transport := cleanhttp.DefaultPooledTransport()
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", opts.ProxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no CA certificates found in %s", opts.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return newDownloader(opts, transport), nil
+}
+
+// newDownloader returns the Downloader of the validated options with the defaults.
+func newDownloader(opts DownloadOptions, transport *http.Transport) *Downloader {
+	client := retryablehttp.NewClient()
+	client.HTTPClient = &http.Client{Transport: transport, Timeout: opts.Timeout}
+	client.RetryMax = opts.Retries
+	client.RetryWaitMin = opts.RetryWaitMin
+	client.RetryWaitMax = opts.RetryWaitMax
+	client.Logger = nil
+	return &Downloader{client: client, transport: transport, opts: opts}
+}
+
+// withTransport returns a copy of the Downloader using the transport.
+func (d *Downloader) withTransport(transport *http.Transport) *Downloader {
+	c := newDownloader(d.opts, transport)
+	c.authHost, c.username, c.password = d.authHost, d.username, d.password
+	return c
+}
+
+// authorize sets the basic auth credentials of the request sent to the authHost.
+func (d *Downloader) authorize(req *http.Request) {
+	if d.username != "" && req.URL.Host == d.authHost {
+		req.SetBasicAuth(d.username, d.password)
+	}
+}
+
+// DownloadChartFromArtifact downloads and loads the chart archive of the artifact.
+func (d *Downloader) DownloadChartFromArtifact(ctx context.Context, artifact *sourcev1.Artifact) (*chart.Chart, error) {
+	return d.DownloadChart(ctx, artifact.URL, artifact.Digest)
+}
+
+// DownloadChart downloads and loads the chart archive. The archive is streamed
+// to the chart loader, its size is limited and its digest is verified on the
+// fly if provided.
+func (d *Downloader) DownloadChart(ctx context.Context, chartURL, digest string) (_ *chart.Chart, err error) {
+	if d == nil {
+		d = defaultDownloader
+	}
+	l := log.FromContext(ctx, "chart", chartURL)
+	start := time.Now()
+	reason := ""
+	defer func() {
+		observeDownload(time.Since(start), reason)
+	}()
+
+	var verifier godigest.Verifier
+	// verify data integrity if digest is provided
+	if digest != "" {
+		dig, err := godigest.Parse(digest)
+		if err != nil {
+			reason = downloadFailureDigest
+			return nil, fmt.Errorf("failed to parse digest %s: %w", digest, err)
+		}
+		verifier = dig.Verifier()
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, chartURL, nil)
+	if err != nil {
+		reason = downloadFailureRequest
+		return nil, err
+	}
+	d.authorize(req.Request)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		reason = downloadFailureRequest
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			l.Error(err, "Error closing response body after chart download")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		reason = downloadFailureStatus
+		return nil, fmt.Errorf("chart download request failed: %s", resp.Status)
+	}
+	if resp.ContentLength > d.opts.MaxSize {
+		reason = downloadFailureSize
+		return nil, fmt.Errorf("%w of %d bytes: %d bytes", errChartTooLarge, d.opts.MaxSize, resp.ContentLength)
+	}
+
+	body := &countingReader{r: resp.Body, limit: d.opts.MaxSize}
+	var reader io.Reader = body
+	if verifier != nil {
+		reader = io.TeeReader(body, verifier)
+	}
+	helmChart, loadErr := loader.LoadArchive(reader)
+	// the loader may stop before the end of the archive, the rest is read to
+	// complete the digest
+	_, copyErr := io.Copy(io.Discard, reader)
+	addDownloadedBytes(body.n)
+	switch {
+	case errors.Is(loadErr, errChartTooLarge) || errors.Is(copyErr, errChartTooLarge):
+		reason = downloadFailureSize
+		return nil, fmt.Errorf("%w of %d bytes", errChartTooLarge, d.opts.MaxSize)
+	case copyErr != nil:
+		reason = downloadFailureRequest
+		return nil, fmt.Errorf("failed to download chart: %w", copyErr)
+	case verifier != nil && !verifier.Verified():
+		reason = downloadFailureDigest
+		return nil, fmt.Errorf("verification for digest %s failed", digest)
+	case loadErr != nil:
+		reason = downloadFailureLoad
+		return nil, fmt.Errorf("failed to load archive for chart %s, %w", chartURL, loadErr)
+	}
+	return helmChart, nil
+}
+
+// DownloadIndexFromArtifact downloads and loads the Helm repository index of the artifact.
+func (d *Downloader) DownloadIndexFromArtifact(ctx context.Context, artifact *sourcev1.Artifact) (*repo.IndexFile, error) {
+	return d.DownloadIndex(ctx, artifact.URL, artifact.Digest)
+}
+
+// DownloadIndex downloads and loads the Helm repository index, its size is
+// limited by MaxIndexSize and its digest is verified if provided.
+func (d *Downloader) DownloadIndex(ctx context.Context, indexURL, digest string) (_ *repo.IndexFile, err error) {
+	if d == nil {
+		d = defaultDownloader
+	}
+	l := log.FromContext(ctx, "index", indexURL)
+
+	var verifier godigest.Verifier
+	if digest != "" {
+		dig, err := godigest.Parse(digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse digest %s: %w", digest, err)
+		}
+		verifier = dig.Verifier()
+	}
+
+	req, err := retryablehttp.NewRequestWithContext(ctx, http.MethodGet, indexURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	d.authorize(req.Request)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			l.Error(err, "Error closing response body after index download")
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("index download request failed: %s", resp.Status)
+	}
+	if resp.ContentLength > MaxIndexSize {
+		return nil, fmt.Errorf("index exceeds the maximum size of %d bytes: %d bytes", MaxIndexSize, resp.ContentLength)
+	}
+
+	data, err := io.ReadAll(&countingReader{r: resp.Body, limit: MaxIndexSize})
+	if errors.Is(err, errChartTooLarge) {
+		return nil, fmt.Errorf("index exceeds the maximum size of %d bytes", MaxIndexSize)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index: %w", err)
+	}
+	if verifier != nil {
+		_, _ = verifier.Write(data)
+		if !verifier.Verified() {
+			return nil, fmt.Errorf("verification for digest %s failed", digest)
+		}
+	}
+
+	index := &repo.IndexFile{}
+	if err := yaml.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to load index %s: %w", indexURL, err)
+	}
+	if index.APIVersion == "" {
+		return nil, fmt.Errorf("failed to load index %s: %w", indexURL, repo.ErrNoAPIVersion)
+	}
+	index.SortEntries()
+	return index, nil
+}
+
+// countingReader counts the bytes read and fails once more than limit bytes are read.
+type countingReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.n > c.limit {
+		return n, errChartTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,254 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// testChartArchive returns the archive of a chart with a ConfigMap.
+func testChartArchive() []byte {
+	path, err := chartutil.Save(&chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "test", Version: "0.1.0"},
+		Templates: []*chart.File{{
+			Name: "templates/configmap.yaml",
+			Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n"),
+		}},
+	}, GinkgoT().TempDir())
+	Expect(err).NotTo(HaveOccurred())
+	data, err := os.ReadFile(path)
+	Expect(err).NotTo(HaveOccurred())
+	return data
+}
+
+// downloads returns the number of the downloads observed with the result.
+func downloads(result string) uint64 {
+	m := &dto.Metric{}
+	Expect(chartDownloadDuration.WithLabelValues(result).(prometheus.Histogram).Write(m)).To(Succeed())
+	return m.GetHistogram().GetSampleCount()
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Chart downloader", func() {
+	ctx := context.Background()
+
+	var data []byte
+	var requests *atomic.Int32
+	// handler serves the request after the failed ones
+	var handler http.HandlerFunc
+	var url string
+
+	newDownloader := func(opts DownloadOptions) *Downloader {
+		opts.RetryWaitMin = time.Millisecond
+		opts.RetryWaitMax = time.Millisecond
+		d, err := NewDownloader(opts)
+		Expect(err).NotTo(HaveOccurred())
+		return d
+	}
+
+	// streamed writes the archive without the Content-Length header.
+	streamed := func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(data[:1])
+		w.(http.Flusher).Flush()
+		_, _ = w.Write(data[1:])
+	}
+
+	BeforeEach(func() {
+		data = testChartArchive()
+		requests = &atomic.Int32{}
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write(data)
+		}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			handler(w, r)
+		}))
+		DeferCleanup(server.Close)
+		url = server.URL + "/test-0.1.0.tgz"
+	})
+
+	It("should download and verify the chart", func() {
+		bytes := testutil.ToFloat64(chartDownloadBytes)
+		succeeded := downloads("success")
+
+		c, err := newDownloader(DownloadOptions{}).DownloadChart(ctx, url, sha256Digest(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Name()).To(Equal("test"))
+		Expect(testutil.ToFloat64(chartDownloadBytes) - bytes).To(BeEquivalentTo(len(data)))
+		Expect(downloads("success") - succeeded).To(BeEquivalentTo(1))
+	})
+
+	It("should download with the default options if the Downloader is nil", func() {
+		var d *Downloader
+		c, err := d.DownloadChart(ctx, url, sha256Digest(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Name()).To(Equal("test"))
+	})
+
+	DescribeTable("should limit the size of the archive",
+		func(stream bool) {
+			if stream {
+				handler = streamed
+			}
+			failures := testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureSize))
+			failed := downloads("failure")
+
+			_, err := newDownloader(DownloadOptions{MaxSize: int64(len(data) - 1)}).DownloadChart(ctx, url, sha256Digest(data))
+			Expect(err).To(MatchError(errChartTooLarge))
+			Expect(testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureSize)) - failures).To(BeEquivalentTo(1))
+			Expect(downloads("failure") - failed).To(BeEquivalentTo(1))
+
+			By("Accepting the archive of the maximum size")
+			_, err = newDownloader(DownloadOptions{MaxSize: int64(len(data))}).DownloadChart(ctx, url, sha256Digest(data))
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("by the Content-Length", false),
+		Entry("while streaming", true),
+	)
+
+	It("should report the size from the Content-Length before reading the archive", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Length", strconv.Itoa(DefaultMaxChartSize+1))
+			w.WriteHeader(http.StatusOK)
+		}
+		_, err := newDownloader(DownloadOptions{}).DownloadChart(ctx, url, "")
+		Expect(err).To(MatchError(ContainSubstring(strconv.Itoa(DefaultMaxChartSize+1) + " bytes")))
+	})
+
+	DescribeTable("should verify the digest of the archive",
+		func(stream bool) {
+			if stream {
+				handler = streamed
+			}
+			failures := testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureDigest))
+
+			_, err := newDownloader(DownloadOptions{}).DownloadChart(ctx, url, sha256Digest([]byte("other")))
+			Expect(err).To(MatchError(ContainSubstring("verification for digest")))
+			Expect(testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureDigest)) - failures).To(BeEquivalentTo(1))
+		},
+		Entry("of the known size", false),
+		Entry("streamed", true),
+	)
+
+	It("should reject the invalid digests", func() {
+		_, err := newDownloader(DownloadOptions{}).DownloadChart(ctx, url, "sha256:invalid")
+		Expect(err).To(MatchError(ContainSubstring("failed to parse digest")))
+		Expect(requests.Load()).To(BeZero())
+	})
+
+	It("should fail on the unexpected status without retries", func() {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}
+		failures := testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureStatus))
+
+		_, err := newDownloader(DownloadOptions{}).DownloadChart(ctx, url, "")
+		Expect(err).To(MatchError("chart download request failed: 404 Not Found"))
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+		Expect(testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureStatus)) - failures).To(BeEquivalentTo(1))
+	})
+
+	It("should retry the failed requests", func() {
+		handler = func(w http.ResponseWriter, _ *http.Request) {
+			if requests.Load() <= 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+		_, err := newDownloader(DownloadOptions{Retries: 2}).DownloadChart(ctx, url, sha256Digest(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+
+		By("Giving up once the retries are exhausted")
+		requests.Store(0)
+		failures := testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureRequest))
+		_, err = newDownloader(DownloadOptions{Retries: 1}).DownloadChart(ctx, url, "")
+		Expect(err).To(MatchError(ContainSubstring("giving up after 2 attempt(s)")))
+		Expect(requests.Load()).To(BeEquivalentTo(2))
+		Expect(testutil.ToFloat64(chartDownloadFailures.WithLabelValues(downloadFailureRequest)) - failures).To(BeEquivalentTo(1))
+
+		By("Disabling the retries")
+		requests.Store(0)
+		_, err = newDownloader(DownloadOptions{Retries: -1}).DownloadChart(ctx, url, "")
+		Expect(err).To(HaveOccurred())
+		Expect(requests.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should reject the invalid options", func() {
+		_, err := NewDownloader(DownloadOptions{RetryWaitMin: time.Minute, RetryWaitMax: time.Second})
+		Expect(err).To(MatchError("maximum retry wait 1s is less than the minimum 1m0s"))
+		_, err = NewDownloader(DownloadOptions{CAFile: "missing.pem"})
+		Expect(err).To(MatchError(ContainSubstring("failed to read CA file")))
+	})
+})
+
+var _ = Describe("Index downloader", func() {
+	ctx := context.Background()
+
+	data := []byte("apiVersion: v1\nentries:\n  test:\n  - name: test\n    version: 0.1.0\n  - name: test\n    version: 0.2.0\n")
+	var url string
+	var d *Downloader
+
+	BeforeEach(func() {
+		var err error
+		d, err = NewDownloader(DownloadOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/invalid.yaml" {
+				_, _ = w.Write([]byte("entries: {}\n"))
+				return
+			}
+			_, _ = w.Write(data)
+		}))
+		DeferCleanup(server.Close)
+		url = server.URL
+	})
+
+	It("should download and verify the index", func() {
+		index, err := d.DownloadIndex(ctx, url+"/index.yaml", sha256Digest(data))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(index.Entries).To(HaveKey("test"))
+		Expect(index.Entries["test"][0].Version).To(Equal("0.2.0"))
+
+		_, err = d.DownloadIndex(ctx, url+"/index.yaml", sha256Digest([]byte("other")))
+		Expect(err).To(MatchError(ContainSubstring("verification for digest")))
+	})
+
+	It("should reject the index without the API version", func() {
+		_, err := d.DownloadIndex(ctx, url+"/invalid.yaml", "")
+		Expect(err).To(MatchError(ContainSubstring("no API version specified")))
+	})
+})
@@ -0,0 +1,206 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const (
+	DefaultAdmissionWebhookPort    = 9443
+	DefaultAdmissionWebhookCertDir = "/tmp/k8s-webhook-server/serving-certs/"
+)
+
+// reservedManagerArgs are the controller manager arguments set by the HMC chart.
+var reservedManagerArgs = []string{"--enable-webhook", "--webhook-port", "--webhook-cert-dir", "--system-namespace", "--helm-engine"}
+
+// HMCValues represents the values of the HMC core component chart known to HMC.
+// Values not known to HMC are preserved as is. The sections not set are omitted,
+// so the defaults of the chart apply.
+type HMCValues struct {
+	// AdmissionWebhook configures the HMC admission webhook.
+	AdmissionWebhook *AdmissionWebhookValues `json:"admissionWebhook,omitempty"`
+	// ControllerManager configures the HMC controller manager.
+	ControllerManager *ControllerManagerValues `json:"controllerManager,omitempty"`
+	// CertManager toggles the cert-manager subchart.
+	CertManager *SubchartValues `json:"cert-manager,omitempty"`
+	// Flux2 toggles the flux2 subchart.
+	Flux2 *SubchartValues `json:"flux2,omitempty"`
+
+	raw map[string]interface{}
+}
+
+// AdmissionWebhookValues configures the HMC admission webhook.
+type AdmissionWebhookValues struct {
+	// Enabled indicates whether the admission webhook is enabled.
+	Enabled *bool `json:"enabled,omitempty"`
+	// Port is the port the admission webhook listens on.
+	Port int `json:"port,omitempty"`
+	// CertDir is the directory containing the admission webhook serving certificates.
+	CertDir string `json:"certDir,omitempty"`
+}
+
+// ControllerManagerValues configures the HMC controller manager.
+type ControllerManagerValues struct {
+	Manager *ManagerValues `json:"manager,omitempty"`
+}
+
+// ManagerValues configures the manager container of the HMC controller manager.
+type ManagerValues struct {
+	// Args are the arguments of the manager.
+	Args []string `json:"args,omitempty"`
+}
+
+// SubchartValues toggles a subchart of the HMC chart.
+type SubchartValues struct {
+	// Enabled indicates whether the subchart is installed.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// ParseHMCValues parses the config of the HMC core component.
+func ParseHMCValues(config *apiextensionsv1.JSON) (*HMCValues, error) {
+	values := &HMCValues{raw: make(map[string]interface{})}
+	if config == nil || len(config.Raw) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(config.Raw, &values.raw); err != nil {
+		return nil, fmt.Errorf("failed to parse HMC config: %w", err)
+	}
+	if values.raw == nil {
+		// the config is null
+		values.raw = make(map[string]interface{})
+	}
+	if err := json.Unmarshal(config.Raw, values); err != nil {
+		return nil, fmt.Errorf("failed to parse HMC config: %w", err)
+	}
+	return values, nil
+}
+
+// Default sets the default port and certificates directory of the admission
+// webhook if its section is set. The sections not set are left to the defaults
+// of the chart.
+func (v *HMCValues) Default() {
+	if v.AdmissionWebhook == nil {
+		return
+	}
+	if v.AdmissionWebhook.Port == 0 {
+		v.AdmissionWebhook.Port = DefaultAdmissionWebhookPort
+	}
+	if v.AdmissionWebhook.CertDir == "" {
+		v.AdmissionWebhook.CertDir = DefaultAdmissionWebhookCertDir
+	}
+}
+
+// Validate checks the values known to HMC.
+func (v *HMCValues) Validate() error {
+	var errs error
+	if v.AdmissionWebhook != nil {
+		if port := v.AdmissionWebhook.Port; port < 0 || port > 65535 {
+			errs = errors.Join(errs, fmt.Errorf("admissionWebhook.port %d is out of range", port))
+		}
+	}
+	for _, arg := range v.ManagerArgs() {
+		if !strings.HasPrefix(arg, "--") {
+			errs = errors.Join(errs, fmt.Errorf("controllerManager.manager.args: %q is not a flag", arg))
+			continue
+		}
+		name, _, _ := strings.Cut(arg, "=")
+		for _, reserved := range reservedManagerArgs {
+			if name == reserved {
+				errs = errors.Join(errs, fmt.Errorf("controllerManager.manager.args: %s is set by the HMC chart", name))
+			}
+		}
+	}
+	return errs
+}
+
+// ManagerArgs returns the arguments of the controller manager, nil if not set.
+func (v *HMCValues) ManagerArgs() []string {
+	if v.ControllerManager == nil || v.ControllerManager.Manager == nil {
+		return nil
+	}
+	return v.ControllerManager.Manager.Args
+}
+
+// SetManagerArgs sets the arguments of the controller manager.
+func (v *HMCValues) SetManagerArgs(args []string) {
+	if v.ControllerManager == nil {
+		v.ControllerManager = &ControllerManagerValues{}
+	}
+	if v.ControllerManager.Manager == nil {
+		v.ControllerManager.Manager = &ManagerValues{}
+	}
+	v.ControllerManager.Manager.Args = args
+}
+
+// SetManagerArg sets the controller manager argument in the --name=value form,
+// replacing the previous value of the argument if any.
+func (v *HMCValues) SetManagerArg(name, value string) {
+	arg := name + "=" + value
+	args := v.ManagerArgs()
+	for i, a := range args {
+		if n, _, _ := strings.Cut(a, "="); n == name {
+			args[i] = arg
+			return
+		}
+	}
+	v.SetManagerArgs(append(args, arg))
+}
+
+// RemoveManagerArg removes the controller manager argument if it is set.
+func (v *HMCValues) RemoveManagerArg(name string) {
+	args := v.ManagerArgs()
+	if args == nil {
+		return
+	}
+	kept := args[:0]
+	for _, a := range args {
+		if n, _, _ := strings.Cut(a, "="); n != name {
+			kept = append(kept, a)
+		}
+	}
+	v.ControllerManager.Manager.Args = kept
+}
+
+// Values returns the values known to HMC merged over the values not known to HMC.
+func (v *HMCValues) Values() (map[string]interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal HMC config: %w", err)
+	}
+	known := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &known); err != nil {
+		return nil, fmt.Errorf("failed to marshal HMC config: %w", err)
+	}
+	return MergeValues(v.raw, known), nil
+}
+
+// JSON returns the values as the config of the HMC core component.
+func (v *HMCValues) JSON() (*apiextensionsv1.JSON, error) {
+	values, err := v.Values()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal HMC config: %w", err)
+	}
+	return &apiextensionsv1.JSON{Raw: raw}, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+const (
+	// EngineFlux installs the releases with the Flux helm-controller.
+	EngineFlux = "flux"
+	// EngineNative installs the releases directly with the Helm SDK.
+	EngineNative = "native"
+)
+
+// Installer installs, upgrades and uninstalls the releases of the Management
+// components and the Deployments. The desired state of a release is described
+// by the HelmRelease built from the ReleaseOptions, the same HelmRelease type
+// reports the state of the release in its Ready condition and history
+// regardless of the implementation.
+type Installer interface {
+	// Install installs or upgrades the release and returns its state.
+	Install(ctx context.Context, name, namespace string, opts ...ReleaseOption) (*hcv2.HelmRelease, error)
+	// Get returns the state of the release. A NotFound error is returned if
+	// the release is not installed.
+	Get(ctx context.Context, name, namespace string) (*hcv2.HelmRelease, error)
+	// List returns the state of the releases installed by HMC in the namespace.
+	List(ctx context.Context, namespace string) ([]hcv2.HelmRelease, error)
+	// Uninstall uninstalls the release. It is not an error if the release is
+	// not installed.
+	Uninstall(ctx context.Context, name, namespace string) error
+}
+
+// FluxInstaller is the Installer creating HelmRelease objects reconciled by
+// the Flux helm-controller.
+type FluxInstaller struct {
+	Client client.Client
+}
+
+func (f *FluxInstaller) Install(ctx context.Context, name, namespace string, opts ...ReleaseOption) (*hcv2.HelmRelease, error) {
+	hr, _, err := ReconcileHelmRelease(ctx, f.Client, name, namespace, opts...)
+	return hr, err
+}
+
+func (f *FluxInstaller) Get(ctx context.Context, name, namespace string) (*hcv2.HelmRelease, error) {
+	hr := &hcv2.HelmRelease{}
+	if err := f.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, hr); err != nil {
+		return nil, err
+	}
+	return hr, nil
+}
+
+func (f *FluxInstaller) List(ctx context.Context, namespace string) ([]hcv2.HelmRelease, error) {
+	helmReleases := &hcv2.HelmReleaseList{}
+	if err := f.Client.List(ctx, helmReleases,
+		client.InNamespace(namespace),
+		client.MatchingLabels{hmc.HMCManagedLabelKey: "true"},
+	); err != nil {
+		return nil, fmt.Errorf("failed to list HelmReleases: %w", err)
+	}
+	return helmReleases.Items, nil
+}
+
+func (f *FluxInstaller) Uninstall(ctx context.Context, name, namespace string) error {
+	return DeleteHelmRelease(ctx, f.Client, name, namespace)
+}
@@ -0,0 +1,66 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// The reasons of the failed chart downloads.
+const (
+	downloadFailureRequest = "request"
+	downloadFailureStatus  = "status"
+	downloadFailureSize    = "size"
+	downloadFailureDigest  = "digest"
+	downloadFailureLoad    = "load"
+)
+
+var (
+	chartDownloadBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "hmc_chart_download_bytes_total",
+		Help: "Total number of bytes of the downloaded chart archives.",
+	})
+	chartDownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "hmc_chart_download_duration_seconds",
+		Help:    "Duration of the chart downloads, including the retries and the loading of the archive.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"result"})
+	chartDownloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "hmc_chart_download_failures_total",
+		Help: "Total number of the failed chart downloads by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(chartDownloadBytes, chartDownloadDuration, chartDownloadFailures)
+}
+
+func addDownloadedBytes(n int64) {
+	chartDownloadBytes.Add(float64(n))
+}
+
+// observeDownload records the duration of the download and its failure
+// reason, the empty reason means the download succeeded.
+func observeDownload(duration time.Duration, reason string) {
+	result := "success"
+	if reason != "" {
+		result = "failure"
+		chartDownloadFailures.WithLabelValues(reason).Inc()
+	}
+	chartDownloadDuration.WithLabelValues(result).Observe(duration.Seconds())
+}
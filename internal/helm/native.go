@@ -0,0 +1,478 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/fluxcd/pkg/apis/meta"
+	fluxconditions "github.com/fluxcd/pkg/runtime/conditions"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+const (
+	// releaseDigestLabel is the label of the Helm release with the digest of
+	// the chart, the values and the reconcile request it is installed from.
+	releaseDigestLabel = "hmc.mirantis.com/digest"
+	// releaseOwnerLabel is the label of the Helm release with the UID of its owner.
+	releaseOwnerLabel = "hmc.mirantis.com/owner"
+	// releaseDependsOnLabel is the label of the Helm release with the names of
+	// the releases it depends on separated by underscores.
+	releaseDependsOnLabel = "hmc.mirantis.com/depends-on"
+	// releaseWaitingLabel is the label of the deployed Helm release whose
+	// resources are not yet ready.
+	releaseWaitingLabel = "hmc.mirantis.com/waiting"
+	// removedLabelValue removes the label of the Helm release on upgrade.
+	removedLabelValue = "null"
+)
+
+// NativeInstaller is the Installer running the Helm actions directly with the
+// Helm SDK, so the Flux helm-controller is not required. The charts of the
+// HelmCharts are pulled directly from the Helm repositories of their
+// HelmRepository sources, without the artifacts of the Flux source-controller.
+//
+// The release is installed or upgraded only when its chart, values or reconcile
+// request change. The Helm actions do not wait for the resources of the
+// release, their readiness is checked on the following calls instead, so the
+// reconciliation is not blocked until the timeout. The failed releases are
+// retried up to the remediation retries of the install or upgrade settings.
+// Post renderers, drift detection, tests and the releases into remote clusters
+// or other namespaces are not supported.
+type NativeInstaller struct {
+	Client     client.Client
+	Config     *rest.Config
+	RESTMapper apimeta.RESTMapper
+	Puller     *ChartPuller
+
+	// actionConfigFunc overrides the Helm action configuration of the
+	// namespace, such as the storage and the Kubernetes client in tests.
+	actionConfigFunc func(namespace string) (*action.Configuration, error)
+}
+
+func (n *NativeInstaller) actionConfig(ctx context.Context, namespace string) (*action.Configuration, error) {
+	if n.actionConfigFunc != nil {
+		return n.actionConfigFunc(namespace)
+	}
+	l := log.FromContext(ctx)
+	actionConfig := new(action.Configuration)
+	getter := NewMemoryRESTClientGetter(n.Config, n.RESTMapper)
+	if err := actionConfig.Init(getter, namespace, "secret", l.V(1).Info); err != nil {
+		return nil, fmt.Errorf("failed to initialize Helm client: %w", err)
+	}
+	return actionConfig, nil
+}
+
+func (n *NativeInstaller) Install(ctx context.Context, name, namespace string, opts ...ReleaseOption) (*hcv2.HelmRelease, error) {
+	hr := &hcv2.HelmRelease{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	setReleaseSpec(hr, opts)
+	if err := checkNativeSupport(hr); err != nil {
+		return nil, err
+	}
+
+	actionConfig, err := n.actionConfig(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range hr.Spec.DependsOn {
+		depNamespace := dep.Namespace
+		if depNamespace == "" {
+			depNamespace = namespace
+		}
+		depHR, err := n.Get(ctx, dep.Name, depNamespace)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		if err != nil || !fluxconditions.IsReady(depHR) {
+			fluxconditions.MarkFalse(hr, meta.ReadyCondition, hcv2.DependencyNotReadyReason,
+				"dependency '%s/%s' is not ready", depNamespace, dep.Name)
+			return hr, nil
+		}
+	}
+
+	remote, err := n.Puller.Resolve(ctx, hr.Spec.ChartRef, namespace)
+	if err != nil {
+		return nil, err
+	}
+	digest := releaseDigest(remote.Revision, hr)
+
+	history, err := action.NewHistory(actionConfig).Run(name)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("failed to get history of the release %s/%s: %w", namespace, name, err)
+	}
+	releaseutil.Reverse(history, releaseutil.SortByRevision)
+	if len(history) > 0 {
+		latest := history[0]
+		if latest.Info.Status.IsPending() {
+			timeout := hr.GetTimeout().Duration
+			if time.Since(latest.Info.LastDeployed.Time) < timeout {
+				setReleaseStatus(hr, latest)
+				return hr, nil
+			}
+			// the operation was interrupted, e.g. by a restart of the controller
+			latest.SetStatus(release.StatusFailed, fmt.Sprintf("operation timed out after %s", timeout))
+			if err := actionConfig.Releases.Update(latest); err != nil {
+				return nil, fmt.Errorf("failed to unlock the release %s/%s: %w", namespace, name, err)
+			}
+		}
+		if latest.Labels[releaseDigestLabel] == digest {
+			if latest.Info.Status == release.StatusDeployed {
+				return n.checkReady(ctx, actionConfig, hr, latest)
+			}
+			if retriesExhausted(hr, history, digest) {
+				setReleaseStatus(hr, latest)
+				return hr, nil
+			}
+		}
+	}
+
+	hcChart, err := remote.Pull(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labels := releaseLabels(hr, digest, len(history) > 0)
+	var runErr error
+	if len(history) == 0 {
+		install := action.NewInstall(actionConfig)
+		settings := hr.GetInstall()
+		install.ReleaseName = name
+		install.Namespace = namespace
+		install.Timeout = settings.GetTimeout(hr.GetTimeout()).Duration
+		install.DisableHooks = settings.DisableHooks
+		install.DisableOpenAPIValidation = settings.DisableOpenAPIValidation
+		install.Replace = settings.Replace
+		install.CreateNamespace = settings.CreateNamespace
+		install.SkipCRDs = settings.SkipCRDs || settings.CRDs == hcv2.Skip
+		install.Labels = labels
+		_, runErr = install.RunWithContext(ctx, hcChart, hr.GetValues())
+	} else {
+		upgrade := action.NewUpgrade(actionConfig)
+		settings := hr.GetUpgrade()
+		upgrade.Namespace = namespace
+		upgrade.Timeout = settings.GetTimeout(hr.GetTimeout()).Duration
+		upgrade.DisableHooks = settings.DisableHooks
+		upgrade.DisableOpenAPIValidation = settings.DisableOpenAPIValidation
+		upgrade.Force = settings.Force
+		upgrade.CleanupOnFail = settings.CleanupOnFail
+		upgrade.ReuseValues = settings.PreserveValues
+		upgrade.MaxHistory = hr.GetMaxHistory()
+		upgrade.Labels = labels
+		_, runErr = upgrade.RunWithContext(ctx, name, hcChart, hr.GetValues())
+	}
+
+	latest, err := action.NewGet(actionConfig).Run(name)
+	if err != nil {
+		return nil, errors.Join(runErr, fmt.Errorf("failed to get the release %s/%s: %w", namespace, name, err))
+	}
+	if runErr != nil {
+		setReleaseStatus(hr, latest)
+		if latest.Info.Status != release.StatusFailed {
+			// the action failed before the release was stored
+			fluxconditions.MarkFalse(hr, meta.ReadyCondition, hcv2.UpgradeFailedReason, "%s", runErr.Error())
+		}
+		return hr, nil
+	}
+	return n.checkReady(ctx, actionConfig, hr, latest)
+}
+
+// checkReady reports the state of the deployed release waiting for its
+// resources to become ready. The release is marked as failed if the resources
+// are not ready within the timeout, so it is retried as any failed release.
+func (n *NativeInstaller) checkReady(ctx context.Context, actionConfig *action.Configuration, hr *hcv2.HelmRelease, rel *release.Release) (*hcv2.HelmRelease, error) {
+	if rel.Labels[releaseWaitingLabel] == "" {
+		setReleaseStatus(hr, rel)
+		return hr, nil
+	}
+	ready, err := resourcesReady(ctx, actionConfig, rel, waitForJobs(hr, rel))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check the resources of the release %s/%s: %w", rel.Namespace, rel.Name, err)
+	}
+	switch timeout := releaseTimeout(hr, rel); {
+	case ready:
+		delete(rel.Labels, releaseWaitingLabel)
+	case time.Since(rel.Info.LastDeployed.Time) >= timeout:
+		rel.SetStatus(release.StatusFailed, fmt.Sprintf("resources are not ready after %s", timeout))
+	default:
+		setReleaseStatus(hr, rel)
+		return hr, nil
+	}
+	if err := actionConfig.Releases.Update(rel); err != nil {
+		return nil, fmt.Errorf("failed to update the release %s/%s: %w", rel.Namespace, rel.Name, err)
+	}
+	setReleaseStatus(hr, rel)
+	return hr, nil
+}
+
+// resourcesReady returns true if the resources of the release are ready, as
+// checked by Helm when waiting for the release.
+func resourcesReady(ctx context.Context, actionConfig *action.Configuration, rel *release.Release, checkJobs bool) (bool, error) {
+	resources, err := actionConfig.KubeClient.Build(bytes.NewBufferString(rel.Manifest), false)
+	if err != nil || len(resources) == 0 {
+		return err == nil, err
+	}
+	clientSet, err := actionConfig.KubernetesClientSet()
+	if err != nil {
+		return false, err
+	}
+	checker := kube.NewReadyChecker(clientSet, actionConfig.Log, kube.PausedAsReady(true), kube.CheckJobs(checkJobs))
+	for _, resource := range resources {
+		if ready, err := checker.IsReady(ctx, resource); err != nil || !ready {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// releaseTimeout returns the timeout of the action the release is deployed with.
+func releaseTimeout(hr *hcv2.HelmRelease, rel *release.Release) time.Duration {
+	if rel.Version == 1 {
+		return hr.GetInstall().GetTimeout(hr.GetTimeout()).Duration
+	}
+	return hr.GetUpgrade().GetTimeout(hr.GetTimeout()).Duration
+}
+
+// waitForJobs returns true if the Jobs of the release must be completed for
+// the release to be ready.
+func waitForJobs(hr *hcv2.HelmRelease, rel *release.Release) bool {
+	if rel.Version == 1 {
+		return !hr.GetInstall().DisableWaitForJobs
+	}
+	return !hr.GetUpgrade().DisableWaitForJobs
+}
+
+func (n *NativeInstaller) Get(ctx context.Context, name, namespace string) (*hcv2.HelmRelease, error) {
+	actionConfig, err := n.actionConfig(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := action.NewGet(actionConfig).Run(name)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, apierrors.NewNotFound(hcv2.GroupVersion.WithResource("helmreleases").GroupResource(), name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the release %s/%s: %w", namespace, name, err)
+	}
+	return releaseToHelmRelease(rel), nil
+}
+
+func (n *NativeInstaller) List(ctx context.Context, namespace string) ([]hcv2.HelmRelease, error) {
+	actionConfig, err := n.actionConfig(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	list := action.NewList(actionConfig)
+	list.All = true
+	list.SetStateMask()
+	list.Selector = hmc.HMCManagedLabelKey + "=true"
+	releases, err := list.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list releases: %w", err)
+	}
+	result := make([]hcv2.HelmRelease, 0, len(releases))
+	for _, rel := range releases {
+		result = append(result, *releaseToHelmRelease(rel))
+	}
+	return result, nil
+}
+
+func (n *NativeInstaller) Uninstall(ctx context.Context, name, namespace string) error {
+	actionConfig, err := n.actionConfig(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	_, err = action.NewUninstall(actionConfig).Run(name)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return fmt.Errorf("failed to uninstall the release %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// checkNativeSupport returns an error if the HelmRelease requires the features
+// of the Flux helm-controller not supported by the native Helm engine.
+func checkNativeSupport(hr *hcv2.HelmRelease) error {
+	var unsupported []string
+	if len(hr.Spec.PostRenderers) > 0 {
+		unsupported = append(unsupported, "post renderers")
+	}
+	if hr.Spec.DriftDetection != nil && hr.Spec.DriftDetection.Mode != "" &&
+		hr.Spec.DriftDetection.Mode != hcv2.DriftDetectionDisabled {
+		unsupported = append(unsupported, "drift detection")
+	}
+	if hr.Spec.Test != nil && hr.Spec.Test.Enable {
+		unsupported = append(unsupported, "tests")
+	}
+	if hr.Spec.KubeConfig != nil {
+		unsupported = append(unsupported, "remote clusters")
+	}
+	if hr.Spec.TargetNamespace != "" || hr.Spec.StorageNamespace != "" {
+		unsupported = append(unsupported, "target and storage namespaces")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%s not supported by the native Helm engine", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// releaseDigest returns the digest of the chart revision, the values and the
+// reconcile request the release is installed from, truncated to fit into a
+// label value.
+func releaseDigest(chartRevision string, hr *hcv2.HelmRelease) string {
+	h := sha256.New()
+	h.Write([]byte(chartRevision))
+	h.Write([]byte{0})
+	if hr.Spec.Values != nil {
+		h.Write(hr.Spec.Values.Raw)
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(hr.Annotations[meta.ReconcileRequestAnnotation]))
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// retriesExhausted returns true if the release failed with the same digest
+// more times than allowed by the remediation retries. The upgrade remediation
+// applies once the release has been deployed, the install remediation before.
+func retriesExhausted(hr *hcv2.HelmRelease, history []*release.Release, digest string) bool {
+	retries := hr.GetInstall().GetRemediation().GetRetries()
+	for _, rel := range history {
+		if rel.Info.Status == release.StatusDeployed || rel.Info.Status == release.StatusSuperseded {
+			retries = hr.GetUpgrade().GetRemediation().GetRetries()
+			break
+		}
+	}
+	if retries < 0 {
+		return false
+	}
+	failures := 0
+	for _, rel := range history {
+		if rel.Info.Status != release.StatusFailed || rel.Labels[releaseDigestLabel] != digest {
+			break
+		}
+		failures++
+	}
+	return failures > retries
+}
+
+// releaseLabels returns the labels of the Helm release recording the data of
+// the HelmRelease needed to restore it from the release. On upgrade the labels
+// are merged with the previous ones, so the labels not set are removed.
+func releaseLabels(hr *hcv2.HelmRelease, digest string, upgrade bool) map[string]string {
+	labels := map[string]string{
+		hmc.HMCManagedLabelKey: "true",
+		releaseDigestLabel:     digest,
+	}
+	if upgrade {
+		labels[releaseOwnerLabel] = removedLabelValue
+		labels[releaseDependsOnLabel] = removedLabelValue
+		labels[releaseWaitingLabel] = removedLabelValue
+	}
+	if (!upgrade && !hr.GetInstall().DisableWait) || (upgrade && !hr.GetUpgrade().DisableWait) {
+		labels[releaseWaitingLabel] = "true"
+	}
+	if len(hr.OwnerReferences) > 0 {
+		labels[releaseOwnerLabel] = string(hr.OwnerReferences[0].UID)
+	}
+	deps := make([]string, 0, len(hr.Spec.DependsOn))
+	for _, dep := range hr.Spec.DependsOn {
+		deps = append(deps, dep.Name)
+	}
+	// the names exceeding the length of a label value can not be stored, such
+	// dependencies are only known from the spec of the owner
+	if value := strings.Join(deps, "_"); value != "" && len(validation.IsValidLabelValue(value)) == 0 {
+		labels[releaseDependsOnLabel] = value
+	}
+	return labels
+}
+
+// releaseToHelmRelease restores the HelmRelease from the Helm release.
+func releaseToHelmRelease(rel *release.Release) *hcv2.HelmRelease {
+	hr := &hcv2.HelmRelease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rel.Name,
+			Namespace: rel.Namespace,
+			Labels:    map[string]string{hmc.HMCManagedLabelKey: rel.Labels[hmc.HMCManagedLabelKey]},
+		},
+		Spec: hcv2.HelmReleaseSpec{ReleaseName: rel.Name},
+	}
+	if owner := rel.Labels[releaseOwnerLabel]; owner != "" {
+		hr.OwnerReferences = []metav1.OwnerReference{{UID: types.UID(owner)}}
+	}
+	if deps := rel.Labels[releaseDependsOnLabel]; deps != "" {
+		for _, dep := range strings.Split(deps, "_") {
+			hr.Spec.DependsOn = append(hr.Spec.DependsOn, meta.NamespacedObjectReference{Name: dep})
+		}
+	}
+	setReleaseStatus(hr, rel)
+	return hr
+}
+
+// setReleaseStatus reports the state of the Helm release in the history and
+// the Ready condition of the HelmRelease.
+func setReleaseStatus(hr *hcv2.HelmRelease, rel *release.Release) {
+	snapshot := &hcv2.Snapshot{
+		Name:          rel.Name,
+		Namespace:     rel.Namespace,
+		Version:       rel.Version,
+		Status:        rel.Info.Status.String(),
+		FirstDeployed: metav1.NewTime(rel.Info.FirstDeployed.Time),
+		LastDeployed:  metav1.NewTime(rel.Info.LastDeployed.Time),
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		snapshot.ChartName = rel.Chart.Metadata.Name
+		snapshot.ChartVersion = rel.Chart.Metadata.Version
+		snapshot.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	hr.Status.History = hcv2.Snapshots{snapshot}
+	hr.Status.ObservedGeneration = hr.Generation
+
+	succeeded, failed := hcv2.UpgradeSucceededReason, hcv2.UpgradeFailedReason
+	if rel.Version == 1 {
+		succeeded, failed = hcv2.InstallSucceededReason, hcv2.InstallFailedReason
+	}
+	switch {
+	case rel.Info.Status == release.StatusDeployed && rel.Labels[releaseWaitingLabel] != "":
+		fluxconditions.MarkUnknown(hr, meta.ReadyCondition, meta.ProgressingReason,
+			"Helm release %s of version %d is waiting for the resources to become ready", rel.Name, rel.Version)
+	case rel.Info.Status == release.StatusDeployed:
+		fluxconditions.MarkTrue(hr, meta.ReadyCondition, succeeded, "Helm release %s of version %d is deployed",
+			rel.Name, rel.Version)
+	case rel.Info.Status.IsPending():
+		fluxconditions.MarkUnknown(hr, meta.ReadyCondition, meta.ProgressingReason, "Helm release %s is %s",
+			rel.Name, rel.Info.Status)
+	default:
+		fluxconditions.MarkFalse(hr, meta.ReadyCondition, failed, "Helm release %s is %s: %s",
+			rel.Name, rel.Info.Status, rel.Info.Description)
+	}
+}
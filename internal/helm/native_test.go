@@ -0,0 +1,384 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/fluxcd/pkg/apis/meta"
+	fluxconditions "github.com/fluxcd/pkg/runtime/conditions"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/kube"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	helmtime "helm.sh/helm/v3/pkg/time"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+const testNamespace = "default"
+
+// podKubeClient is the fake Kubernetes client of Helm, which builds the
+// manifests of the releases into a single Pod when they are not validated,
+// as done by the readiness check. The manifests built by the Helm actions are
+// empty, so no resources are created.
+type podKubeClient struct {
+	kubefake.PrintingKubeClient
+}
+
+func (c *podKubeClient) Build(_ io.Reader, validate bool) (kube.ResourceList, error) {
+	if validate {
+		return kube.ResourceList{}, nil
+	}
+	pod := &corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+	}
+	return kube.ResourceList{{Name: pod.Name, Namespace: pod.Namespace, Object: pod}}, nil
+}
+
+// podServer returns the API server serving the Pod of the podKubeClient,
+// which is ready if podReady is true.
+func podServer(podReady *atomic.Bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/"+testNamespace+"/pods/test" {
+			http.NotFound(w, r)
+			return
+		}
+		status := corev1.ConditionFalse
+		if podReady.Load() {
+			status = corev1.ConditionTrue
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+			Status:     corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}},
+		})
+	}))
+}
+
+// repositoryServer returns the server of the HTTP Helm repository of the test
+// chart archive and its HelmRepository and HelmChart.
+func repositoryServer() (*httptest.Server, *sourcev1.HelmRepository, *sourcev1.HelmChart) {
+	data := testChartArchive()
+	index := testIndex(sha256Digest(data), "test-0.1.0.tgz")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.yaml":
+			_, _ = w.Write(index)
+		case "/test-0.1.0.tgz":
+			_, _ = w.Write(data)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	helmRepo := &sourcev1.HelmRepository{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace, UID: "test-repository"},
+		Spec:       sourcev1.HelmRepositorySpec{URL: server.URL},
+	}
+	helmChart := &sourcev1.HelmChart{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+		Spec: sourcev1.HelmChartSpec{
+			Chart:     "test",
+			SourceRef: sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.HelmRepositoryKind, Name: "test"},
+		},
+	}
+	return server, helmRepo, helmChart
+}
+
+// testIndex returns the index of the repository with the test chart of the
+// digest at the URL.
+func testIndex(digest, chartURL string) []byte {
+	return []byte(fmt.Sprintf(`apiVersion: v1
+entries:
+  test:
+  - apiVersion: v2
+    name: test
+    version: 0.1.0
+    digest: %s
+    urls:
+    - %s
+`, strings.TrimPrefix(digest, "sha256:"), chartURL))
+}
+
+var _ = Describe("Native installer", func() {
+	ctx := context.Background()
+	chartRef := &hcv2.CrossNamespaceSourceReference{Kind: sourcev1.HelmChartKind, Name: "test"}
+
+	var installer *NativeInstaller
+	var actionConfig *action.Configuration
+	var podReady *atomic.Bool
+
+	BeforeEach(func() {
+		charts, helmRepo, helmChart := repositoryServer()
+		DeferCleanup(charts.Close)
+		podReady = &atomic.Bool{}
+		apiServer := podServer(podReady)
+		DeferCleanup(apiServer.Close)
+
+		scheme := runtime.NewScheme()
+		Expect(sourcev1.AddToScheme(scheme)).To(Succeed())
+
+		memory := driver.NewMemory()
+		memory.SetNamespace(testNamespace)
+		actionConfig = &action.Configuration{
+			RESTClientGetter: NewMemoryRESTClientGetter(&rest.Config{Host: apiServer.URL}, nil),
+			Releases:         storage.Init(memory),
+			KubeClient:       &podKubeClient{PrintingKubeClient: kubefake.PrintingKubeClient{Out: io.Discard}},
+			Capabilities:     chartutil.DefaultCapabilities,
+			Log:              func(string, ...interface{}) {},
+		}
+		k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(helmRepo, helmChart).Build()
+		installer = &NativeInstaller{
+			Client: k8sClient,
+			Puller: &ChartPuller{Client: k8sClient},
+			actionConfigFunc: func(string) (*action.Configuration, error) {
+				return actionConfig, nil
+			},
+		}
+	})
+
+	It("should report the release as progressing until its resources are ready", func() {
+		hr, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsUnknown(hr, meta.ReadyCondition)).To(BeTrue())
+		Expect(fluxconditions.GetMessage(hr, meta.ReadyCondition)).To(ContainSubstring("waiting for the resources"))
+
+		hr, err = installer.Get(ctx, "test", testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsUnknown(hr, meta.ReadyCondition)).To(BeTrue())
+
+		podReady.Store(true)
+		hr, err = installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsReady(hr)).To(BeTrue())
+		Expect(fluxconditions.GetReason(hr, meta.ReadyCondition)).To(Equal(hcv2.InstallSucceededReason))
+
+		rel, err := actionConfig.Releases.Last("test")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Version).To(Equal(1))
+		Expect(rel.Labels).NotTo(HaveKey(releaseWaitingLabel))
+
+		hr, err = installer.Get(ctx, "test", testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsReady(hr)).To(BeTrue())
+	})
+
+	It("should not wait for the resources if the wait is disabled", func() {
+		hr, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef),
+			WithInstall(&hcv2.Install{DisableWait: true}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsReady(hr)).To(BeTrue())
+	})
+
+	It("should upgrade the release when the values change", func() {
+		podReady.Store(true)
+		_, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef))
+		Expect(err).NotTo(HaveOccurred())
+
+		podReady.Store(false)
+		values := &apiextensionsv1.JSON{Raw: []byte(`{"replicas":2}`)}
+		hr, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef), WithValues(values))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsUnknown(hr, meta.ReadyCondition)).To(BeTrue())
+		Expect(hr.Status.History.Latest().Version).To(Equal(2))
+
+		podReady.Store(true)
+		hr, err = installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef), WithValues(values))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsReady(hr)).To(BeTrue())
+		Expect(fluxconditions.GetReason(hr, meta.ReadyCondition)).To(Equal(hcv2.UpgradeSucceededReason))
+		Expect(hr.Status.History.Latest().Version).To(Equal(2))
+	})
+
+	It("should fail the release if its resources are not ready in time", func() {
+		opts := []ReleaseOption{WithChartRef(chartRef), WithTimeout(&metav1.Duration{Duration: time.Nanosecond})}
+		hr, err := installer.Install(ctx, "test", testNamespace, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsFalse(hr, meta.ReadyCondition)).To(BeTrue())
+		Expect(fluxconditions.GetReason(hr, meta.ReadyCondition)).To(Equal(hcv2.InstallFailedReason))
+		Expect(fluxconditions.GetMessage(hr, meta.ReadyCondition)).To(ContainSubstring("resources are not ready after 1ns"))
+
+		By("Keeping the failed release once the retries are exhausted")
+		podReady.Store(true)
+		hr, err = installer.Install(ctx, "test", testNamespace, opts...)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.IsFalse(hr, meta.ReadyCondition)).To(BeTrue())
+		Expect(hr.Status.History.Latest().Version).To(Equal(1))
+	})
+
+	It("should wait for the dependencies", func() {
+		hr, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef),
+			WithDependsOn([]meta.NamespacedObjectReference{{Name: "missing"}}))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fluxconditions.GetReason(hr, meta.ReadyCondition)).To(Equal(hcv2.DependencyNotReadyReason))
+		_, err = actionConfig.Releases.Last("test")
+		Expect(err).To(MatchError(driver.ErrReleaseNotFound))
+	})
+
+	It("should reject the features not supported by the engine", func() {
+		_, err := installer.Install(ctx, "test", testNamespace, WithChartRef(chartRef),
+			WithTest(&hcv2.Test{Enable: true}))
+		Expect(err).To(MatchError("tests not supported by the native Helm engine"))
+	})
+})
+
+// testRelease returns the release of the version with the status and the digest.
+func testRelease(version int, status release.Status, digest string) *release.Release {
+	return &release.Release{
+		Name:      "test",
+		Namespace: testNamespace,
+		Version:   version,
+		Info:      &release.Info{Status: status, LastDeployed: helmtime.Now()},
+		Labels:    map[string]string{releaseDigestLabel: digest},
+	}
+}
+
+var _ = DescribeTable("Native installer retries",
+	func(install, upgrade int, history []*release.Release, expected bool) {
+		hr := &hcv2.HelmRelease{Spec: hcv2.HelmReleaseSpec{
+			Install: &hcv2.Install{Remediation: &hcv2.InstallRemediation{Retries: install}},
+			Upgrade: &hcv2.Upgrade{Remediation: &hcv2.UpgradeRemediation{Retries: upgrade}},
+		}}
+		Expect(retriesExhausted(hr, history, "new")).To(Equal(expected))
+	},
+	Entry("no failures", 0, 0, []*release.Release{testRelease(1, release.StatusDeployed, "new")}, false),
+	Entry("install failed without retries", 0, 3,
+		[]*release.Release{testRelease(1, release.StatusFailed, "new")}, true),
+	Entry("install failed with retries left", 1, 0,
+		[]*release.Release{testRelease(1, release.StatusFailed, "new")}, false),
+	Entry("install retries exhausted", 1, 0, []*release.Release{
+		testRelease(2, release.StatusFailed, "new"),
+		testRelease(1, release.StatusFailed, "new"),
+	}, true),
+	Entry("upgrade failed with retries left", 0, 1, []*release.Release{
+		testRelease(2, release.StatusFailed, "new"),
+		testRelease(1, release.StatusSuperseded, "old"),
+	}, false),
+	Entry("upgrade retries exhausted", 3, 1, []*release.Release{
+		testRelease(3, release.StatusFailed, "new"),
+		testRelease(2, release.StatusFailed, "new"),
+		testRelease(1, release.StatusDeployed, "old"),
+	}, true),
+	Entry("failures of other digests", 0, 0, []*release.Release{
+		testRelease(2, release.StatusFailed, "old"),
+		testRelease(1, release.StatusDeployed, "old"),
+	}, false),
+	Entry("unlimited retries", -1, -1, []*release.Release{testRelease(1, release.StatusFailed, "new")}, false),
+)
+
+var _ = Describe("Native installer release data", func() {
+	hr := func() *hcv2.HelmRelease {
+		return &hcv2.HelmRelease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "test",
+				Namespace:       testNamespace,
+				OwnerReferences: []metav1.OwnerReference{{UID: "owner-uid"}},
+			},
+			Spec: hcv2.HelmReleaseSpec{
+				Values:    &apiextensionsv1.JSON{Raw: []byte(`{"replicas":1}`)},
+				DependsOn: []meta.NamespacedObjectReference{{Name: "hmc"}, {Name: "cluster-api"}},
+			},
+		}
+	}
+
+	It("should change the digest with the chart revision, the values and the reconcile request", func() {
+		digest := releaseDigest("sha256:a", hr())
+		Expect(digest).To(HaveLen(32))
+		Expect(releaseDigest("sha256:a", hr())).To(Equal(digest))
+		Expect(releaseDigest("sha256:b", hr())).NotTo(Equal(digest))
+
+		changed := hr()
+		changed.Spec.Values = &apiextensionsv1.JSON{Raw: []byte(`{"replicas":2}`)}
+		Expect(releaseDigest("sha256:a", changed)).NotTo(Equal(digest))
+
+		requested := hr()
+		requested.Annotations = map[string]string{meta.ReconcileRequestAnnotation: "now"}
+		Expect(releaseDigest("sha256:a", requested)).NotTo(Equal(digest))
+	})
+
+	It("should record the owner and the dependencies in the labels", func() {
+		Expect(releaseLabels(hr(), "digest", false)).To(Equal(map[string]string{
+			hmc.HMCManagedLabelKey: "true",
+			releaseDigestLabel:     "digest",
+			releaseOwnerLabel:      "owner-uid",
+			releaseDependsOnLabel:  "hmc_cluster-api",
+			releaseWaitingLabel:    "true",
+		}))
+
+		By("Removing the labels not set on upgrade")
+		orphan := hr()
+		orphan.OwnerReferences = nil
+		orphan.Spec.DependsOn = []meta.NamespacedObjectReference{{Name: strings.Repeat("a", 64)}}
+		orphan.Spec.Upgrade = &hcv2.Upgrade{DisableWait: true}
+		Expect(releaseLabels(orphan, "digest", true)).To(Equal(map[string]string{
+			hmc.HMCManagedLabelKey: "true",
+			releaseDigestLabel:     "digest",
+			releaseOwnerLabel:      removedLabelValue,
+			releaseDependsOnLabel:  removedLabelValue,
+			releaseWaitingLabel:    removedLabelValue,
+		}))
+	})
+
+	It("should restore the HelmRelease from the release", func() {
+		rel := testRelease(2, release.StatusDeployed, "digest")
+		rel.Labels = releaseLabels(hr(), "digest", false)
+		rel.Chart = &chart.Chart{Metadata: &chart.Metadata{Name: "test", Version: "0.1.0"}}
+
+		restored := releaseToHelmRelease(rel)
+		Expect(restored.Name).To(Equal("test"))
+		Expect(restored.Namespace).To(Equal(testNamespace))
+		Expect(restored.Labels).To(Equal(map[string]string{hmc.HMCManagedLabelKey: "true"}))
+		Expect(restored.OwnerReferences).To(Equal([]metav1.OwnerReference{{UID: "owner-uid"}}))
+		Expect(restored.Spec.DependsOn).To(Equal(hr().Spec.DependsOn))
+		Expect(restored.Status.History.Latest().ChartName).To(Equal("test"))
+		Expect(restored.Status.History.Latest().Version).To(Equal(2))
+		Expect(fluxconditions.IsUnknown(restored, meta.ReadyCondition)).To(BeTrue())
+
+		delete(rel.Labels, releaseWaitingLabel)
+		restored = releaseToHelmRelease(rel)
+		Expect(fluxconditions.IsReady(restored)).To(BeTrue())
+		Expect(fluxconditions.GetReason(restored, meta.ReadyCondition)).To(Equal(hcv2.UpgradeSucceededReason))
+
+		rel.Info.Status = release.StatusFailed
+		rel.Info.Description = "boom"
+		restored = releaseToHelmRelease(rel)
+		Expect(fluxconditions.IsFalse(restored, meta.ReadyCondition)).To(BeTrue())
+		Expect(fluxconditions.GetMessage(restored, meta.ReadyCondition)).To(Equal("Helm release test is failed: boom"))
+	})
+})
@@ -0,0 +1,384 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	orasregistry "oras.land/oras-go/pkg/registry"
+	orasremote "oras.land/oras-go/pkg/registry/remote"
+	orasauth "oras.land/oras-go/pkg/registry/remote/auth"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultIndexInterval is the interval at which the cached index of a
+// HelmRepository without interval is downloaded again.
+const defaultIndexInterval = 10 * time.Minute
+
+// ChartPuller pulls the charts of the HelmCharts directly from the Helm
+// repositories of their HelmRepository sources, so the artifacts of the Flux
+// source-controller are not needed. The HTTP/S repositories are accessed with
+// the Downloader and the OCI registries with the Helm registry client, using
+// the username and password of the SecretRef and the ca.crt, tls.crt and
+// tls.key of the CertSecretRef of the HelmRepository.
+type ChartPuller struct {
+	Client     client.Client
+	Downloader *Downloader
+
+	mu      sync.Mutex
+	indexes map[types.UID]*cachedIndex
+}
+
+// cachedIndex is the index of a HelmRepository downloaded at the generation.
+type cachedIndex struct {
+	index      *repo.IndexFile
+	generation int64
+	expires    time.Time
+}
+
+// RemoteChart is a chart version resolved in its Helm repository.
+type RemoteChart struct {
+	Name    string
+	Version string
+	// Ref is the URL of the chart archive or the reference of the OCI artifact.
+	Ref string
+	// Revision identifies the content of the chart: the digest of the chart
+	// archive or of the OCI manifest, or the URL of the chart archive if the
+	// index of the repository provides no digest.
+	Revision string
+
+	pull func(ctx context.Context) (*chart.Chart, error)
+}
+
+// Pull downloads and loads the chart.
+func (c *RemoteChart) Pull(ctx context.Context) (*chart.Chart, error) {
+	return c.pull(ctx)
+}
+
+// Resolve returns the chart version of the HelmChart in the Helm repository
+// of its HelmRepository source.
+func (p *ChartPuller) Resolve(ctx context.Context, ref *hcv2.CrossNamespaceSourceReference, namespace string) (*RemoteChart, error) {
+	if ref == nil || ref.Kind != sourcev1.HelmChartKind {
+		return nil, errors.New("only HelmChart sources are supported by the native Helm engine")
+	}
+	key := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+	if key.Namespace == "" {
+		key.Namespace = namespace
+	}
+	helmChart := &sourcev1.HelmChart{}
+	if err := p.Client.Get(ctx, key, helmChart); err != nil {
+		return nil, fmt.Errorf("failed to get HelmChart %s: %w", key, err)
+	}
+	if helmChart.Spec.SourceRef.Kind != sourcev1.HelmRepositoryKind {
+		return nil, fmt.Errorf("HelmChart %s: only HelmRepository sources are supported by the native Helm engine", key)
+	}
+	repoKey := types.NamespacedName{Namespace: helmChart.Namespace, Name: helmChart.Spec.SourceRef.Name}
+	helmRepo := &sourcev1.HelmRepository{}
+	if err := p.Client.Get(ctx, repoKey, helmRepo); err != nil {
+		return nil, fmt.Errorf("failed to get HelmRepository %s: %w", repoKey, err)
+	}
+	d, err := p.repositoryDownloader(ctx, helmRepo)
+	if err != nil {
+		return nil, fmt.Errorf("HelmRepository %s: %w", repoKey, err)
+	}
+
+	var remote *RemoteChart
+	if helmRepo.Spec.Type == sourcev1.HelmRepositoryTypeOCI {
+		remote, err = resolveOCIChart(ctx, d, helmRepo, helmChart.Spec.Chart, helmChart.Spec.Version)
+	} else {
+		remote, err = p.resolveChart(ctx, d, helmRepo, helmChart.Spec.Chart, helmChart.Spec.Version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve chart %s of HelmChart %s: %w", helmChart.Spec.Chart, key, err)
+	}
+	return remote, nil
+}
+
+// resolveChart returns the chart version of the HTTP/S Helm repository. The
+// credentials are only sent to the host of the chart archive if it is the host
+// of the repository or if the HelmRepository allows passing them.
+func (p *ChartPuller) resolveChart(ctx context.Context, d *Downloader, helmRepo *sourcev1.HelmRepository, name, version string) (*RemoteChart, error) {
+	index, err := p.index(ctx, d, helmRepo)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := index.Get(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(cv.URLs) == 0 {
+		return nil, fmt.Errorf("chart %s %s has no URL", name, cv.Version)
+	}
+	chartURL, err := repo.ResolveReferenceURL(helmRepo.Spec.URL, cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+	if helmRepo.Spec.PassCredentials {
+		u, err := url.Parse(chartURL)
+		if err != nil {
+			return nil, err
+		}
+		c := *d
+		c.authHost = u.Host
+		d = &c
+	}
+	remote := &RemoteChart{Name: name, Version: cv.Version, Ref: chartURL, Revision: chartURL}
+	digest := ""
+	if cv.Digest != "" {
+		digest = "sha256:" + cv.Digest
+		remote.Revision = digest
+	}
+	remote.pull = func(ctx context.Context) (*chart.Chart, error) {
+		return d.DownloadChart(ctx, chartURL, digest)
+	}
+	return remote, nil
+}
+
+// index returns the index of the HTTP/S Helm repository, which is cached for
+// the interval of the HelmRepository.
+func (p *ChartPuller) index(ctx context.Context, d *Downloader, helmRepo *sourcev1.HelmRepository) (*repo.IndexFile, error) {
+	p.mu.Lock()
+	cached := p.indexes[helmRepo.UID]
+	p.mu.Unlock()
+	if cached != nil && cached.generation == helmRepo.Generation && time.Now().Before(cached.expires) {
+		return cached.index, nil
+	}
+
+	index, err := d.DownloadIndex(ctx, strings.TrimSuffix(helmRepo.Spec.URL, "/")+"/index.yaml", "")
+	if err != nil {
+		return nil, err
+	}
+	interval := helmRepo.Spec.Interval.Duration
+	if interval <= 0 {
+		interval = defaultIndexInterval
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.indexes == nil {
+		p.indexes = make(map[types.UID]*cachedIndex)
+	}
+	p.indexes[helmRepo.UID] = &cachedIndex{index: index, generation: helmRepo.Generation, expires: time.Now().Add(interval)}
+	return index, nil
+}
+
+// resolveOCIChart returns the chart version of the OCI registry. The tags of
+// the chart are listed unless the version is an exact version.
+func resolveOCIChart(ctx context.Context, d *Downloader, helmRepo *sourcev1.HelmRepository, name, version string) (*RemoteChart, error) {
+	repository := strings.TrimSuffix(strings.TrimPrefix(helmRepo.Spec.URL, registry.OCIScheme+"://"), "/") + "/" + name
+	httpClient := &http.Client{Transport: d.transport, Timeout: d.opts.Timeout}
+	plainHTTP := helmRepo.Spec.Insecure
+
+	tag, err := ociTag(ctx, httpClient, d, repository, version, plainHTTP)
+	if err != nil {
+		return nil, err
+	}
+	ref := repository + ":" + strings.ReplaceAll(tag, "+", "_")
+	resolver := docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(
+			docker.WithClient(httpClient),
+			docker.WithPlainHTTP(func(string) (bool, error) { return plainHTTP, nil }),
+			docker.WithAuthorizer(docker.NewDockerAuthorizer(
+				docker.WithAuthClient(httpClient),
+				docker.WithAuthCreds(func(string) (string, string, error) { return d.username, d.password, nil }),
+			)),
+		),
+	})
+	_, desc, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteChart{
+		Name:     name,
+		Version:  tag,
+		Ref:      registry.OCIScheme + "://" + ref,
+		Revision: desc.Digest.String(),
+		pull: func(context.Context) (*chart.Chart, error) {
+			return pullOCIChart(resolver, ref, plainHTTP, d.opts.MaxSize)
+		},
+	}, nil
+}
+
+// ociTag returns the exact version or the highest tag of the repository
+// matching the version range, which defaults to the latest version.
+func ociTag(ctx context.Context, httpClient *http.Client, d *Downloader, repository, version string, plainHTTP bool) (string, error) {
+	if v, err := semver.StrictNewVersion(version); err == nil {
+		return v.String(), nil
+	}
+	if version == "" {
+		version = "*"
+	}
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return "", fmt.Errorf("invalid version range %q: %w", version, err)
+	}
+	reference, err := orasregistry.ParseReference(repository)
+	if err != nil {
+		return "", err
+	}
+	authClient := &orasauth.Client{Client: httpClient}
+	if d.username != "" {
+		authClient.Credential = func(context.Context, string) (orasauth.Credential, error) {
+			return orasauth.Credential{Username: d.username, Password: d.password}, nil
+		}
+	}
+	tags, err := orasregistry.Tags(ctx, &orasremote.Repository{Client: authClient, Reference: reference, PlainHTTP: plainHTTP})
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+	var latest *semver.Version
+	for _, tag := range tags {
+		v, err := semver.StrictNewVersion(strings.ReplaceAll(tag, "_", "+"))
+		if err != nil || !constraint.Check(v) {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("no tag matches the version %s", version)
+	}
+	return latest.String(), nil
+}
+
+// pullOCIChart pulls and loads the chart of the OCI reference.
+func pullOCIChart(resolver remotes.Resolver, ref string, plainHTTP bool, maxSize int64) (*chart.Chart, error) {
+	opts := []registry.ClientOption{registry.ClientOptWriter(io.Discard), registry.ClientOptResolver(resolver)}
+	if plainHTTP {
+		opts = append(opts, registry.ClientOptPlainHTTP())
+	}
+	registryClient, err := registry.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := registryClient.Pull(ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull chart %s: %w", ref, err)
+	}
+	if result.Chart.Size > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes: %d bytes", errChartTooLarge, maxSize, result.Chart.Size)
+	}
+	return loader.LoadArchive(bytes.NewReader(result.Chart.Data))
+}
+
+// repositoryDownloader returns the Downloader sending the credentials of the
+// HelmRepository to its host and trusting its CA bundle and presenting its
+// client certificate.
+func (p *ChartPuller) repositoryDownloader(ctx context.Context, helmRepo *sourcev1.HelmRepository) (*Downloader, error) {
+	d := p.Downloader
+	if d == nil {
+		d = defaultDownloader
+	}
+	u, err := url.Parse(helmRepo.Spec.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if helmRepo.Spec.CertSecretRef != nil {
+		secret, err := p.secret(ctx, helmRepo.Namespace, helmRepo.Spec.CertSecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := repositoryTLSConfig(d.transport.TLSClientConfig, secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificates in Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		transport := d.transport.Clone()
+		transport.TLSClientConfig = tlsConfig
+		d = d.withTransport(transport)
+	}
+
+	if helmRepo.Spec.SecretRef != nil {
+		secret, err := p.secret(ctx, helmRepo.Namespace, helmRepo.Spec.SecretRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		username, password := string(secret.Data["username"]), string(secret.Data["password"])
+		if username == "" || password == "" {
+			return nil, fmt.Errorf("Secret %s/%s must contain the username and password", secret.Namespace, secret.Name)
+		}
+		c := *d
+		c.authHost, c.username, c.password = u.Host, username, password
+		d = &c
+	}
+	return d, nil
+}
+
+func (p *ChartPuller) secret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := p.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, fmt.Errorf("failed to get Secret %s/%s: %w", namespace, name, err)
+	}
+	return secret, nil
+}
+
+// repositoryTLSConfig returns the TLS configuration trusting the CA bundle
+// (ca.crt) in addition to the CAs of the base configuration and presenting
+// the client certificate (tls.crt and tls.key) of the Secret.
+func repositoryTLSConfig(base *tls.Config, secret *corev1.Secret) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	if ca := secret.Data["ca.crt"]; len(ca) > 0 {
+		pool := tlsConfig.RootCAs
+		if pool == nil {
+			var err error
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		} else {
+			pool = pool.Clone()
+		}
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no CA certificates found in ca.crt")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	cert, key := secret.Data["tls.crt"], secret.Data["tls.key"]
+	switch {
+	case len(cert) > 0 && len(key) > 0:
+		keyPair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{keyPair}
+	case len(cert) > 0 || len(key) > 0:
+		return nil, errors.New("both tls.crt and tls.key must be set")
+	}
+	return tlsConfig, nil
+}
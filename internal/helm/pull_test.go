@@ -0,0 +1,208 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	hcv2 "github.com/fluxcd/helm-controller/api/v2"
+	"github.com/fluxcd/pkg/apis/meta"
+	sourcev1 "github.com/fluxcd/source-controller/api/v1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	godigest "github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"helm.sh/helm/v3/pkg/registry"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// ociRegistry returns the server of an OCI registry with the versions of the
+// test chart in the charts/test repository.
+func ociRegistry(versions ...string) *httptest.Server {
+	chartData := testChartArchive()
+	configData := []byte(`{"name":"test","version":"0.1.0"}`)
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config: ocispec.Descriptor{
+			MediaType: registry.ConfigMediaType,
+			Digest:    godigest.FromBytes(configData),
+			Size:      int64(len(configData)),
+		},
+		Layers: []ocispec.Descriptor{{
+			MediaType: registry.ChartLayerMediaType,
+			Digest:    godigest.FromBytes(chartData),
+			Size:      int64(len(chartData)),
+		}},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	blobs := map[string][]byte{
+		sha256Digest(configData): configData,
+		sha256Digest(chartData):  chartData,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/charts/test/")
+		switch {
+		case r.URL.Path == "/v2/":
+		case path == "tags/list":
+			_ = json.NewEncoder(w).Encode(map[string]any{"name": "charts/test", "tags": versions})
+		case strings.HasPrefix(path, "manifests/"):
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", sha256Digest(manifest))
+			w.Header().Set("Content-Length", strconv.Itoa(len(manifest)))
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(manifest)
+			}
+		case strings.HasPrefix(path, "blobs/") && blobs[strings.TrimPrefix(path, "blobs/")] != nil:
+			_, _ = w.Write(blobs[strings.TrimPrefix(path, "blobs/")])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+var _ = Describe("Chart puller", func() {
+	ctx := context.Background()
+	chartRef := &hcv2.CrossNamespaceSourceReference{Kind: sourcev1.HelmChartKind, Name: "test"}
+
+	newPuller := func(objs ...client.Object) *ChartPuller {
+		scheme := runtime.NewScheme()
+		Expect(sourcev1.AddToScheme(scheme)).To(Succeed())
+		Expect(corev1.AddToScheme(scheme)).To(Succeed())
+		return &ChartPuller{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()}
+	}
+
+	It("should pull the chart of the HTTP repository with its credentials", func() {
+		data := testChartArchive()
+		var indexRequests atomic.Int32
+		var foreignAuth atomic.Bool
+		// foreign serves the chart archive from another host
+		foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _, ok := r.BasicAuth()
+			foreignAuth.Store(ok)
+			_, _ = w.Write(data)
+		}))
+		DeferCleanup(foreign.Close)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			indexRequests.Add(1)
+			_, _ = w.Write(testIndex(sha256Digest(data), foreign.URL+"/test-0.1.0.tgz"))
+		}))
+		DeferCleanup(server.Close)
+
+		helmRepo := &sourcev1.HelmRepository{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace, UID: "test-repository"},
+			Spec: sourcev1.HelmRepositorySpec{
+				URL:       server.URL,
+				SecretRef: &meta.LocalObjectReference{Name: "test-credentials"},
+			},
+		}
+		helmChart := &sourcev1.HelmChart{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+			Spec: sourcev1.HelmChartSpec{
+				Chart:     "test",
+				Version:   "0.1.x",
+				SourceRef: sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.HelmRepositoryKind, Name: "test"},
+			},
+		}
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-credentials", Namespace: testNamespace},
+			Data:       map[string][]byte{"username": []byte("user"), "password": []byte("secret")},
+		}
+		puller := newPuller(helmRepo, helmChart, secret)
+
+		remote, err := puller.Resolve(ctx, chartRef, testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Version).To(Equal("0.1.0"))
+		Expect(remote.Revision).To(Equal(sha256Digest(data)))
+		c, err := remote.Pull(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Name()).To(Equal("test"))
+		Expect(foreignAuth.Load()).To(BeFalse())
+
+		By("Caching the index of the repository")
+		_, err = puller.Resolve(ctx, chartRef, testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexRequests.Load()).To(BeEquivalentTo(1))
+
+		By("Passing the credentials to the host of the chart if allowed")
+		helmRepo.Spec.PassCredentials = true
+		helmRepo.Generation++
+		Expect(puller.Client.Update(ctx, helmRepo)).To(Succeed())
+		remote, err = puller.Resolve(ctx, chartRef, testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexRequests.Load()).To(BeEquivalentTo(2))
+		_, err = remote.Pull(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(foreignAuth.Load()).To(BeTrue())
+	})
+
+	It("should pull the latest chart version of the OCI registry in the range", func() {
+		server := ociRegistry("0.1.0", "0.2.0", "1.0.0")
+		DeferCleanup(server.Close)
+		helmRepo := &sourcev1.HelmRepository{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+			Spec: sourcev1.HelmRepositorySpec{
+				Type:     sourcev1.HelmRepositoryTypeOCI,
+				URL:      "oci://" + strings.TrimPrefix(server.URL, "http://") + "/charts",
+				Insecure: true,
+			},
+		}
+		helmChart := &sourcev1.HelmChart{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+			Spec: sourcev1.HelmChartSpec{
+				Chart:     "test",
+				Version:   "<1.0.0",
+				SourceRef: sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.HelmRepositoryKind, Name: "test"},
+			},
+		}
+
+		remote, err := newPuller(helmRepo, helmChart).Resolve(ctx, chartRef, testNamespace)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remote.Version).To(Equal("0.2.0"))
+		Expect(remote.Ref).To(HaveSuffix("/charts/test:0.2.0"))
+		Expect(remote.Revision).To(HavePrefix("sha256:"))
+		c, err := remote.Pull(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Name()).To(Equal("test"))
+	})
+
+	It("should reject the HelmCharts of other sources", func() {
+		helmChart := &sourcev1.HelmChart{
+			ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: testNamespace},
+			Spec: sourcev1.HelmChartSpec{
+				Chart:     "test",
+				SourceRef: sourcev1.LocalHelmChartSourceReference{Kind: sourcev1.GitRepositoryKind, Name: "test"},
+			},
+		}
+		_, err := newPuller(helmChart).Resolve(ctx, chartRef, testNamespace)
+		Expect(err).To(MatchError(ContainSubstring("only HelmRepository sources are supported")))
+	})
+})
@@ -28,16 +28,171 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
+// DefaultReconcileInterval is the interval of the HelmRelease reconciliation
+// used unless WithReconcileInterval is given.
+const DefaultReconcileInterval = 10 * time.Minute
+
+// ReleaseOption configures the HelmRelease reconciled by ReconcileHelmRelease.
+// The options are applied in order over the spec built from scratch, so the
+// settings not set by the options are reset to the Flux defaults.
+type ReleaseOption func(*hcv2.HelmRelease)
+
+// WithValues sets the values of the release.
+func WithValues(values *apiextensionsv1.JSON) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Values = values
+	}
+}
+
+// WithOwnerReference sets the owner of the HelmRelease.
+func WithOwnerReference(ownerReference *metav1.OwnerReference) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		if ownerReference != nil {
+			hr.OwnerReferences = []metav1.OwnerReference{*ownerReference}
+		}
+	}
+}
+
+// WithChartRef sets the reference to the source of the chart.
+func WithChartRef(chartRef *hcv2.CrossNamespaceSourceReference) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.ChartRef = chartRef
+	}
+}
+
+// WithReconcileInterval sets the interval of the HelmRelease reconciliation.
+func WithReconcileInterval(interval time.Duration) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Interval = metav1.Duration{Duration: interval}
+	}
+}
+
+// WithDependsOn sets the HelmReleases that must be ready before the release
+// is reconciled.
+func WithDependsOn(dependsOn []meta.NamespacedObjectReference) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.DependsOn = dependsOn
+	}
+}
+
+// WithTimeout sets the time to wait for any individual Kubernetes operation
+// during the Helm actions.
+func WithTimeout(timeout *metav1.Duration) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Timeout = timeout
+	}
+}
+
+// WithInstall sets the configuration of the Helm install action, such as the
+// remediation retries and the CRDs policy.
+func WithInstall(install *hcv2.Install) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Install = install
+	}
+}
+
+// WithUpgrade sets the configuration of the Helm upgrade action, such as the
+// remediation strategy and the CRDs policy.
+func WithUpgrade(upgrade *hcv2.Upgrade) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Upgrade = upgrade
+	}
+}
+
+// WithTest sets the configuration of the Helm test action.
+func WithTest(test *hcv2.Test) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.Test = test
+	}
+}
+
+// WithDriftDetection sets the drift detection of the release resources.
+func WithDriftDetection(driftDetection *hcv2.DriftDetection) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.DriftDetection = driftDetection
+	}
+}
+
+// WithPostRenderers sets the post renderers applied to the rendered manifests.
+func WithPostRenderers(postRenderers []hcv2.PostRenderer) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.PostRenderers = postRenderers
+	}
+}
+
+// WithKubeConfig installs the release into the remote cluster with the
+// kubeconfig stored in the key of the Secret in the namespace of the
+// HelmRelease, such as the kubeconfig Secret of a Cluster API cluster.
+func WithKubeConfig(secretName, key string) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.KubeConfig = &meta.KubeConfigReference{
+			SecretRef: meta.SecretKeyReference{Name: secretName, Key: key},
+		}
+	}
+}
+
+// WithTargetNamespace sets the namespace the release resources are installed
+// to, the namespace of the HelmRelease is used if not set.
+func WithTargetNamespace(namespace string) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.TargetNamespace = namespace
+	}
+}
+
+// WithStorageNamespace sets the namespace the Helm storage of the release is
+// kept in, the namespace of the HelmRelease is used if not set.
+func WithStorageNamespace(namespace string) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		hr.Spec.StorageNamespace = namespace
+	}
+}
+
+// WithReconcileRequest requests the reconciliation of the HelmRelease by Flux
+// with the token, resetting its failure counts and forcing the release. The
+// annotations are set only if the token is not empty, so the previous requests
+// already handled by Flux are kept.
+func WithReconcileRequest(token string) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		if token == "" {
+			return
+		}
+		if hr.Annotations == nil {
+			hr.Annotations = make(map[string]string)
+		}
+		hr.Annotations[meta.ReconcileRequestAnnotation] = token
+		hr.Annotations[hcv2.ResetRequestAnnotation] = token
+		hr.Annotations[hcv2.ForceRequestAnnotation] = token
+	}
+}
+
+// WithSettings applies the HelmRelease settings given in the spec of a
+// Management component or a Deployment. Nil settings are ignored.
+func WithSettings(settings *hmc.HelmReleaseSettings) ReleaseOption {
+	return func(hr *hcv2.HelmRelease) {
+		if settings == nil {
+			return
+		}
+		for _, opt := range []ReleaseOption{
+			WithTimeout(settings.Timeout),
+			WithInstall(settings.Install),
+			WithUpgrade(settings.Upgrade),
+			WithTest(settings.Test),
+			WithDriftDetection(settings.DriftDetection),
+			WithPostRenderers(settings.PostRenderers),
+		} {
+			opt(hr)
+		}
+	}
+}
+
+// ReconcileHelmRelease creates or updates the HelmRelease with the given name
+// configured by the options.
 func ReconcileHelmRelease(
 	ctx context.Context,
 	cl client.Client,
 	name string,
 	namespace string,
-	values *apiextensionsv1.JSON,
-	ownerReference *metav1.OwnerReference,
-	chartRef *hcv2.CrossNamespaceSourceReference,
-	reconcileInterval time.Duration,
-	dependsOn []meta.NamespacedObjectReference,
+	opts ...ReleaseOption,
 ) (*hcv2.HelmRelease, controllerutil.OperationResult, error) {
 	helmRelease := &hcv2.HelmRelease{
 		ObjectMeta: metav1.ObjectMeta{
@@ -47,20 +202,7 @@ func ReconcileHelmRelease(
 	}
 
 	operation, err := ctrl.CreateOrUpdate(ctx, cl, helmRelease, func() error {
-		if helmRelease.Labels == nil {
-			helmRelease.Labels = make(map[string]string)
-		}
-		helmRelease.Labels[hmc.HMCManagedLabelKey] = "true"
-		if ownerReference != nil {
-			helmRelease.OwnerReferences = []metav1.OwnerReference{*ownerReference}
-		}
-		helmRelease.Spec = hcv2.HelmReleaseSpec{
-			ChartRef:    chartRef,
-			Interval:    metav1.Duration{Duration: reconcileInterval},
-			ReleaseName: name,
-			Values:      values,
-			DependsOn:   dependsOn,
-		}
+		setReleaseSpec(helmRelease, opts)
 		return nil
 	})
 	if err != nil {
@@ -69,6 +211,22 @@ func ReconcileHelmRelease(
 	return helmRelease, operation, nil
 }
 
+// setReleaseSpec marks the HelmRelease as managed by HMC and sets its spec
+// from scratch with the options applied.
+func setReleaseSpec(hr *hcv2.HelmRelease, opts []ReleaseOption) {
+	if hr.Labels == nil {
+		hr.Labels = make(map[string]string)
+	}
+	hr.Labels[hmc.HMCManagedLabelKey] = "true"
+	hr.Spec = hcv2.HelmReleaseSpec{
+		Interval:    metav1.Duration{Duration: DefaultReconcileInterval},
+		ReleaseName: hr.Name,
+	}
+	for _, opt := range opts {
+		opt(hr)
+	}
+}
+
 func DeleteHelmRelease(ctx context.Context, cl client.Client, name string, namespace string) error {
 	err := cl.Delete(ctx, &hcv2.HelmRelease{
 		ObjectMeta: metav1.ObjectMeta{
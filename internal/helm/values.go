@@ -0,0 +1,42 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package helm
+
+// MergeValues deep merges the given values into a new map. Values of the latter
+// maps take precedence: nested maps are merged recursively, all the other
+// values, including lists, are replaced. The given maps are not modified.
+func MergeValues(values ...map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, v := range values {
+		mergeInto(result, v)
+	}
+	return result
+}
+
+func mergeInto(dst, src map[string]interface{}) {
+	for key, srcValue := range src {
+		srcMap, srcIsMap := srcValue.(map[string]interface{})
+		if !srcIsMap {
+			dst[key] = srcValue
+			continue
+		}
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if !dstIsMap {
+			dstMap = make(map[string]interface{})
+			dst[key] = dstMap
+		}
+		mergeInto(dstMap, srcMap)
+	}
+}
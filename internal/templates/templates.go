@@ -0,0 +1,52 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package templates provides the default HMC Templates embedded into the manager
+// binary. The manifests in the files directory are generated by hack/templates.sh
+// together with the ones shipped in the hmc-templates chart.
+package templates
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+
+	"k8s.io/apimachinery/pkg/util/yaml"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+//go:embed files/*.yaml
+var files embed.FS
+
+// Templates returns the default Templates embedded into the binary.
+func Templates() ([]hmc.Template, error) {
+	names, err := fs.Glob(files, "files/*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	templates := make([]hmc.Template, 0, len(names))
+	for _, name := range names {
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded Template %s: %w", name, err)
+		}
+		template := hmc.Template{}
+		if err := yaml.Unmarshal(data, &template); err != nil {
+			return nil, fmt.Errorf("failed to parse embedded Template %s: %w", name, err)
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
@@ -16,9 +16,11 @@ package webhook // nolint:dupl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -31,6 +33,10 @@ import (
 
 type DeploymentValidator struct {
 	client.Client
+	// SystemNamespace is the namespace HMC is installed to.
+	SystemNamespace string
+	// HelmEngine is the engine installing the releases of the Deployments.
+	HelmEngine string
 }
 
 func (in *DeploymentValidator) SetupWebhookWithManager(mgr ctrl.Manager) error {
@@ -48,13 +54,28 @@ var (
 )
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
-func (*DeploymentValidator) ValidateCreate(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+func (in *DeploymentValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	deployment, ok := obj.(*v1alpha1.Deployment)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected Deployment but got a %T", obj))
+	}
+	return nil, in.validate(deployment)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
-func (*DeploymentValidator) ValidateUpdate(_ context.Context, _ runtime.Object, _ runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+func (in *DeploymentValidator) ValidateUpdate(_ context.Context, _ runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
+	deployment, ok := newObj.(*v1alpha1.Deployment)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected Deployment but got a %T", newObj))
+	}
+	return nil, in.validate(deployment)
+}
+
+func (in *DeploymentValidator) validate(deployment *v1alpha1.Deployment) error {
+	if len(deployment.Spec.Services) > 0 && in.HelmEngine == helm.EngineNative {
+		return errors.New("spec.services: services are not supported by the native Helm engine")
+	}
+	return nil
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -69,7 +90,7 @@ func (in *DeploymentValidator) Default(ctx context.Context, obj runtime.Object)
 		return apierrors.NewBadRequest(fmt.Sprintf("expected Deployment but got a %T", obj))
 	}
 	template := &v1alpha1.Template{}
-	templateRef := types.NamespacedName{Name: deployment.Spec.Template, Namespace: v1alpha1.TemplatesNamespace}
+	templateRef := types.NamespacedName{Name: deployment.Spec.Template, Namespace: in.SystemNamespace}
 	if err := in.Get(ctx, templateRef, template); err != nil {
 		return err
 	}
@@ -0,0 +1,56 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
+)
+
+var _ = Describe("Deployment webhook", func() {
+	ctx := context.Background()
+
+	deployment := func(services ...v1alpha1.DeploymentService) *v1alpha1.Deployment {
+		return &v1alpha1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+			Spec:       v1alpha1.DeploymentSpec{Template: "aws-standalone-cp", Services: services},
+		}
+	}
+	ingress := v1alpha1.DeploymentService{Name: "ingress", Template: "ingress-nginx"}
+
+	It("should reject the services with the native Helm engine", func() {
+		validator := &DeploymentValidator{HelmEngine: helm.EngineNative}
+		_, err := validator.ValidateCreate(ctx, deployment(ingress))
+		Expect(err).To(MatchError(ContainSubstring("services are not supported by the native Helm engine")))
+		_, err = validator.ValidateUpdate(ctx, deployment(), deployment(ingress))
+		Expect(err).To(MatchError(ContainSubstring("services are not supported by the native Helm engine")))
+
+		_, err = validator.ValidateCreate(ctx, deployment())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should accept the services with the Flux Helm engine", func() {
+		for _, engine := range []string{"", helm.EngineFlux} {
+			_, err := (&DeploymentValidator{HelmEngine: engine}).ValidateCreate(ctx, deployment(ingress))
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+})
@@ -16,19 +16,31 @@ package webhook // nolint:dupl
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 
+	"helm.sh/helm/v3/pkg/chartutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"github.com/Mirantis/hmc/api/v1alpha1"
+	"github.com/Mirantis/hmc/internal/helm"
 )
 
 type ManagementValidator struct {
 	client.Client
+	// SystemNamespace is the namespace HMC is installed to.
+	SystemNamespace string
+	// ManagementName is the name of the only allowed Management object.
+	ManagementName string
 }
 
 var (
@@ -50,13 +62,25 @@ var (
 )
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
-func (*ManagementValidator) ValidateCreate(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+func (v *ManagementValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	mgmt, ok := obj.(*v1alpha1.Management)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected Management but got a %T", obj))
+	}
+	return v.validate(ctx, mgmt)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
-func (*ManagementValidator) ValidateUpdate(_ context.Context, _ runtime.Object, _ runtime.Object) (admission.Warnings, error) {
-	return nil, nil
+func (v *ManagementValidator) ValidateUpdate(ctx context.Context, _ runtime.Object, newObj runtime.Object) (admission.Warnings, error) {
+	mgmt, ok := newObj.(*v1alpha1.Management)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected Management but got a %T", newObj))
+	}
+	if !mgmt.DeletionTimestamp.IsZero() {
+		// do not block the finalizers removal
+		return nil, nil
+	}
+	return v.validate(ctx, mgmt)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -73,6 +97,170 @@ func (v *ManagementValidator) ValidateDelete(ctx context.Context, _ runtime.Obje
 }
 
 // Default implements webhook.Defaulter so a webhook will be registered for the type.
-func (*ManagementValidator) Default(_ context.Context, _ runtime.Object) error {
+func (*ManagementValidator) Default(_ context.Context, obj runtime.Object) error {
+	mgmt, ok := obj.(*v1alpha1.Management)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected Management but got a %T", obj))
+	}
+	applyDefaultCoreConfiguration(mgmt)
 	return nil
 }
+
+func applyDefaultCoreConfiguration(mgmt *v1alpha1.Management) {
+	if mgmt.Spec.Core != nil {
+		// Only apply defaults when there's no configuration provided
+		return
+	}
+	mgmt.Spec.SetCoreDefaults()
+}
+
+func (v *ManagementValidator) validate(ctx context.Context, mgmt *v1alpha1.Management) (admission.Warnings, error) {
+	if mgmt.Name != v.ManagementName || mgmt.Namespace != v.SystemNamespace {
+		return nil, fmt.Errorf("only a single Management object %s/%s is allowed, got %s/%s",
+			v.SystemNamespace, v.ManagementName, mgmt.Namespace, mgmt.Name)
+	}
+	if mgmt.Spec.Core == nil {
+		return nil, errors.New("core components are not specified")
+	}
+
+	var release *v1alpha1.Release
+	if mgmt.Spec.Release != "" {
+		release = &v1alpha1.Release{}
+		releaseRef := types.NamespacedName{Name: mgmt.Spec.Release, Namespace: v.SystemNamespace}
+		if err := v.Get(ctx, releaseRef, release); err != nil {
+			return nil, fmt.Errorf("failed to get Release %s: %w", releaseRef, err)
+		}
+	}
+
+	var warnings admission.Warnings
+	var errs error
+	validateComponent := func(component v1alpha1.Component, templateType v1alpha1.TemplateType) {
+		w, err := v.validateComponent(ctx, component, templateType)
+		warnings = append(warnings, w...)
+		errs = errors.Join(errs, err)
+	}
+	hmcComponent, capiComponent := mgmt.Spec.Core.HMC, mgmt.Spec.Core.CAPI
+	if release != nil {
+		hmcComponent.Template = release.Spec.HMC.Template
+		capiComponent.Template = release.Spec.CAPI.Template
+	}
+	errs = errors.Join(errs, validateGlobalSettings(mgmt.Spec.Global))
+	validateComponent(hmcComponent, v1alpha1.TemplateTypeCore)
+	errs = errors.Join(errs, validateHMCConfig(hmcComponent))
+	validateComponent(capiComponent, v1alpha1.TemplateTypeCore)
+
+	seen := make(map[string]struct{}, len(mgmt.Spec.Providers))
+	for _, provider := range mgmt.Spec.Providers {
+		name := provider.GetName()
+		if name == "" {
+			errs = errors.Join(errs, errors.New("either name or template of the provider must be specified"))
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			errs = errors.Join(errs, fmt.Errorf("provider %s is specified more than once", name))
+			continue
+		}
+		seen[name] = struct{}{}
+		if release != nil {
+			if template := release.Spec.ProviderTemplate(name); template != "" {
+				provider.Template = template
+			}
+		}
+		if provider.Template == "" {
+			errs = errors.Join(errs, fmt.Errorf("template of the provider %s is neither specified nor provided by the Release", name))
+			continue
+		}
+		validateComponent(provider, v1alpha1.TemplateTypeProvider)
+	}
+	return warnings, errs
+}
+
+// validateGlobalSettings checks the proxy URLs and the trusted CA certificates are well-formed.
+func validateGlobalSettings(global *v1alpha1.GlobalSettings) error {
+	if global == nil {
+		return nil
+	}
+	var errs error
+	if proxy := global.Proxy; proxy != nil {
+		for _, p := range []struct{ field, value string }{
+			{"httpProxy", proxy.HTTPProxy},
+			{"httpsProxy", proxy.HTTPSProxy},
+		} {
+			if p.value == "" {
+				continue
+			}
+			if u, err := url.Parse(p.value); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = errors.Join(errs, fmt.Errorf("global.proxy.%s %q is not a valid URL", p.field, p.value))
+			}
+		}
+	}
+	if global.TrustedCAs != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(global.TrustedCAs)) {
+		errs = errors.Join(errs, errors.New("global.trustedCAs does not contain any PEM encoded certificate"))
+	}
+	return errs
+}
+
+// validateHMCConfig checks the config of the HMC core component against the values known to HMC.
+func validateHMCConfig(component v1alpha1.Component) error {
+	values, err := helm.ParseHMCValues(component.Config)
+	if err != nil {
+		return err
+	}
+	values.Default()
+	if err := values.Validate(); err != nil {
+		return fmt.Errorf("invalid HMC config: %w", err)
+	}
+	return nil
+}
+
+// validateComponent checks the referenced template has the expected type and
+// the component configuration is valid against the values schema published in
+// the status of the template. The templates not yet created or validated are
+// reported as warnings, so the Management can be updated before they appear.
+func (v *ManagementValidator) validateComponent(ctx context.Context, component v1alpha1.Component, templateType v1alpha1.TemplateType) (admission.Warnings, error) {
+	if component.Template == "" {
+		return nil, fmt.Errorf("template of the component %s is neither specified nor provided by the Release", component.GetName())
+	}
+	template := &v1alpha1.Template{}
+	templateRef := types.NamespacedName{Name: component.Template, Namespace: v.SystemNamespace}
+	if err := v.Get(ctx, templateRef, template); err != nil {
+		if apierrors.IsNotFound(err) {
+			return admission.Warnings{fmt.Sprintf("Template %s is not found", templateRef)}, nil
+		}
+		return nil, fmt.Errorf("failed to get Template %s: %w", templateRef, err)
+	}
+	if template.Status.Type == "" {
+		return admission.Warnings{fmt.Sprintf("Template %s is not yet validated", templateRef)}, nil
+	}
+	if template.Status.Type != templateType {
+		return nil, fmt.Errorf("template %s has type %q, expected %q", templateRef, template.Status.Type, templateType)
+	}
+	if component.Config == nil {
+		return nil, nil
+	}
+
+	values, err := component.HelmValues()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config of the component %s: %w", component.GetName(), err)
+	}
+	if err := validateValues(template, values); err != nil {
+		return nil, fmt.Errorf("invalid config of the component %s: %w", component.GetName(), err)
+	}
+	return nil, nil
+}
+
+// validateValues validates the values merged over the default values of the
+// template against its values schema. The templates without schema accept any
+// values.
+func validateValues(template *v1alpha1.Template, values map[string]interface{}) error {
+	if template.Status.ValuesSchema == nil {
+		return nil
+	}
+	var defaults map[string]interface{}
+	if template.Status.Config != nil {
+		if err := json.Unmarshal(template.Status.Config.Raw, &defaults); err != nil {
+			return fmt.Errorf("failed to parse default values of the Template %s: %w", template.Name, err)
+		}
+	}
+	return chartutil.ValidateAgainstSingleSchema(helm.MergeValues(defaults, values), template.Status.ValuesSchema.Raw)
+}
@@ -0,0 +1,203 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+const (
+	testNamespace      = "hmc-system"
+	testManagementName = "hmc"
+)
+
+func template(name string, templateType v1alpha1.TemplateType, schema string) *v1alpha1.Template {
+	t := &v1alpha1.Template{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Status: v1alpha1.TemplateStatus{
+			Type:   templateType,
+			Config: &apiextensionsv1.JSON{Raw: []byte(`{"replicas":1}`)},
+		},
+	}
+	if schema != "" {
+		t.Status.ValuesSchema = &apiextensionsv1.JSON{Raw: []byte(schema)}
+	}
+	return t
+}
+
+func config(raw string) *apiextensionsv1.JSON {
+	return &apiextensionsv1.JSON{Raw: []byte(raw)}
+}
+
+var _ = Describe("Management webhook", func() {
+	ctx := context.Background()
+	const schema = `{"type":"object","properties":{"replicas":{"type":"integer","minimum":1}}}`
+
+	var validator *ManagementValidator
+	var mgmt *v1alpha1.Management
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(v1alpha1.AddToScheme(scheme)).To(Succeed())
+		validator = &ManagementValidator{
+			Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+				template("hmc", v1alpha1.TemplateTypeCore, ""),
+				template("cluster-api", v1alpha1.TemplateTypeCore, schema),
+				template("k0smotron", v1alpha1.TemplateTypeProvider, schema),
+				template("k0smotron-0-0-2", v1alpha1.TemplateTypeProvider, schema),
+				template("aws-standalone-cp", v1alpha1.TemplateTypeDeployment, ""),
+				template("pending", "", ""),
+				&v1alpha1.Release{
+					ObjectMeta: metav1.ObjectMeta{Name: "hmc-0-0-2", Namespace: testNamespace},
+					Spec: v1alpha1.ReleaseSpec{
+						HMC:       v1alpha1.ReleaseTemplate{Template: "hmc"},
+						CAPI:      v1alpha1.ReleaseTemplate{Template: "cluster-api"},
+						Providers: []v1alpha1.ReleaseProvider{{Name: "k0smotron", Template: "k0smotron-0-0-2"}},
+					},
+				},
+			).Build(),
+			SystemNamespace: testNamespace,
+			ManagementName:  testManagementName,
+		}
+		mgmt = &v1alpha1.Management{
+			ObjectMeta: metav1.ObjectMeta{Name: testManagementName, Namespace: testNamespace},
+			Spec: v1alpha1.ManagementSpec{
+				Core: &v1alpha1.Core{
+					HMC:  v1alpha1.Component{Template: "hmc"},
+					CAPI: v1alpha1.Component{Template: "cluster-api"},
+				},
+				Providers: []v1alpha1.Component{{Template: "k0smotron"}},
+			},
+		}
+	})
+
+	It("should accept a valid Management", func() {
+		mgmt.Spec.Providers[0].Config = config(`{"replicas":2}`)
+		warnings, err := validator.validate(ctx, mgmt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("should only allow the singleton Management", func() {
+		mgmt.Name = "other"
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("only a single Management object hmc-system/hmc is allowed")))
+	})
+
+	It("should require the core components", func() {
+		mgmt.Spec.Core = nil
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("core components are not specified")))
+	})
+
+	It("should check the types of the Templates", func() {
+		mgmt.Spec.Core.CAPI.Template = "k0smotron"
+		mgmt.Spec.Providers = []v1alpha1.Component{{Template: "aws-standalone-cp"}}
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring(`template hmc-system/k0smotron has type "provider", expected "core"`)))
+		Expect(err).To(MatchError(ContainSubstring(`template hmc-system/aws-standalone-cp has type "deployment", expected "provider"`)))
+	})
+
+	It("should warn about the Templates not yet validated", func() {
+		mgmt.Spec.Providers = []v1alpha1.Component{{Template: "pending"}}
+		warnings, err := validator.validate(ctx, mgmt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf("Template hmc-system/pending is not yet validated"))
+	})
+
+	It("should warn about the missing Templates", func() {
+		mgmt.Spec.Providers = []v1alpha1.Component{{Template: "missing", Config: &apiextensionsv1.JSON{Raw: []byte(`{"any":true}`)}}}
+		warnings, err := validator.validate(ctx, mgmt)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf("Template hmc-system/missing is not found"))
+	})
+
+	It("should reject duplicate providers", func() {
+		mgmt.Spec.Providers = []v1alpha1.Component{{Template: "k0smotron"}, {Template: "k0smotron"}}
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("provider k0smotron is specified more than once")))
+	})
+
+	It("should validate the config against the values schema of the Template", func() {
+		mgmt.Spec.Core.CAPI.Config = config(`{"replicas":0}`)
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("invalid config of the component cluster-api")))
+
+		By("Accepting any config of the Templates without schema")
+		mgmt.Spec.Core.CAPI.Config = nil
+		mgmt.Spec.Core.HMC.Config = config(`{"replicas":0}`)
+		_, err = validator.validate(ctx, mgmt)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should validate the config of the HMC core component", func() {
+		mgmt.Spec.Core.HMC.Config = config(`{"controllerManager":{"manager":{"args":["--webhook-port=8443"]}}}`)
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("--webhook-port")))
+	})
+
+	It("should take the component Templates from the Release", func() {
+		mgmt.Spec.Release = "hmc-0-0-2"
+		mgmt.Spec.Core.HMC.Template = "aws-standalone-cp"
+		mgmt.Spec.Providers = []v1alpha1.Component{{Name: "k0smotron"}}
+		_, err := validator.validate(ctx, mgmt)
+		Expect(err).NotTo(HaveOccurred())
+
+		mgmt.Spec.Release = "missing"
+		_, err = validator.validate(ctx, mgmt)
+		Expect(err).To(MatchError(ContainSubstring("failed to get Release hmc-system/missing")))
+	})
+})
+
+var _ = Describe("Management defaults", func() {
+	It("should default the core components only if not specified", func() {
+		mgmt := &v1alpha1.Management{}
+		applyDefaultCoreConfiguration(mgmt)
+		Expect(mgmt.Spec.Core).To(Equal(&v1alpha1.Core{
+			HMC:  v1alpha1.Component{Template: v1alpha1.DefaultCoreHMCTemplate},
+			CAPI: v1alpha1.Component{Template: v1alpha1.DefaultCoreCAPITemplate},
+		}))
+
+		core := &v1alpha1.Core{HMC: v1alpha1.Component{Template: "custom"}}
+		mgmt.Spec.Core = core
+		applyDefaultCoreConfiguration(mgmt)
+		Expect(mgmt.Spec.Core).To(BeIdenticalTo(core))
+		Expect(mgmt.Spec.Core.CAPI.Template).To(BeEmpty())
+	})
+})
+
+var _ = DescribeTable("HMC core component config",
+	func(raw string, errMsg string) {
+		err := validateHMCConfig(v1alpha1.Component{Config: config(raw)})
+		if errMsg == "" {
+			Expect(err).NotTo(HaveOccurred())
+			return
+		}
+		Expect(err).To(MatchError(ContainSubstring(errMsg)))
+	},
+	Entry("empty", `{}`, ""),
+	Entry("valid", `{"admissionWebhook":{"port":8443},"controllerManager":{"manager":{"args":["--create-management=false"]}}}`, ""),
+	Entry("flag managed by the chart", `{"controllerManager":{"manager":{"args":["--webhook-port=8443"]}}}`, "--webhook-port"),
+	Entry("unexpected shape", `{"admissionWebhook":"enabled"}`, "admissionWebhook"),
+)
@@ -0,0 +1,182 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package templatechart loads the Helm charts of the HMC Templates, parses
+// their HMC metadata and renders them without a cluster. It is shared by the
+// controllers validating the Templates and Deployments, by the hmc CLI and by
+// the tooling of the chart authors checking the charts before they are
+// published.
+package templatechart
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+var (
+	// knownChartAnnotations is the list of hmc.mirantis.com chart annotations supported by HMC.
+	knownChartAnnotations = []string{
+		hmc.ChartAnnotationType,
+		hmc.ChartAnnotationInfraProviders,
+		hmc.ChartAnnotationBootstrapProviders,
+		hmc.ChartAnnotationControlPlaneProviders,
+		hmc.ChartAnnotationDependsOn,
+		hmc.ChartAnnotationGlobalValues,
+	}
+
+	// knownInfrastructureProviders, knownBootstrapProviders and knownControlPlaneProviders
+	// are the registries of CAPI providers known to HMC.
+	knownInfrastructureProviders = []string{"aws", "azure", "docker", "gcp", "k0smotron", "metal3", "openstack", "vsphere"}
+	knownBootstrapProviders      = []string{"k0s", "kubeadm", "microk8s", "rke2", "talos"}
+	knownControlPlaneProviders   = []string{"k0s", "k0smotron", "kubeadm", "microk8s", "rke2", "talos"}
+
+	errNoProviderType = fmt.Errorf("template type is not supported: %s chart annotation must be one of [%s/%s/%s/%s]",
+		hmc.ChartAnnotationType, hmc.TemplateTypeDeployment, hmc.TemplateTypeProvider, hmc.TemplateTypeCore, hmc.TemplateTypeService)
+)
+
+// Metadata is the HMC metadata of a Template chart.
+type Metadata struct {
+	// Type is the type of the Template.
+	Type hmc.TemplateType
+	// Providers are the CAPI providers required or exposed by the Template.
+	Providers hmc.Providers
+	// DependsOn is the list of Management components the Template depends on.
+	DependsOn []string
+	// GlobalValues indicates whether the chart honors the HMC global values.
+	GlobalValues bool
+	// Warnings are the non-fatal issues found in the metadata, such as
+	// providers unknown to HMC.
+	Warnings []string
+}
+
+// Load loads the chart from a directory or a .tgz archive.
+func Load(path string) (*chart.Chart, error) {
+	helmChart, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart %s: %w", path, err)
+	}
+	return helmChart, nil
+}
+
+// ParseMetadata parses the HMC metadata from the chart annotations. The values
+// set in the spec of the Template have higher priority, the spec may be nil.
+func ParseMetadata(helmChart *chart.Chart, spec *hmc.TemplateSpec) (*Metadata, error) {
+	if helmChart.Metadata == nil {
+		return nil, fmt.Errorf("chart metadata is empty")
+	}
+	if spec == nil {
+		spec = &hmc.TemplateSpec{}
+	}
+	annotations := helmChart.Metadata.Annotations
+	if err := validateChartAnnotations(annotations); err != nil {
+		return nil, err
+	}
+	metadata := &Metadata{}
+	// the value in spec has higher priority
+	metadata.Type = spec.Type
+	if metadata.Type == "" {
+		metadata.Type = hmc.TemplateType(strings.TrimSpace(annotations[hmc.ChartAnnotationType]))
+		switch metadata.Type {
+		case hmc.TemplateTypeDeployment, hmc.TemplateTypeProvider, hmc.TemplateTypeCore, hmc.TemplateTypeService:
+		default:
+			return nil, errNoProviderType
+		}
+	}
+	metadata.DependsOn = parseList(spec.DependsOn, annotations[hmc.ChartAnnotationDependsOn])
+
+	if value, ok := annotations[hmc.ChartAnnotationGlobalValues]; ok {
+		globalValues, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q of the chart annotation %s: %w", value, hmc.ChartAnnotationGlobalValues, err)
+		}
+		metadata.GlobalValues = globalValues
+	}
+
+	var warnings []string
+	metadata.Providers.InfrastructureProviders, warnings = parseProviders("infrastructure",
+		spec.Providers.InfrastructureProviders,
+		annotations[hmc.ChartAnnotationInfraProviders],
+		knownInfrastructureProviders)
+	metadata.Warnings = append(metadata.Warnings, warnings...)
+
+	metadata.Providers.BootstrapProviders, warnings = parseProviders("bootstrap",
+		spec.Providers.BootstrapProviders,
+		annotations[hmc.ChartAnnotationBootstrapProviders],
+		knownBootstrapProviders)
+	metadata.Warnings = append(metadata.Warnings, warnings...)
+
+	metadata.Providers.ControlPlaneProviders, warnings = parseProviders("control plane",
+		spec.Providers.ControlPlaneProviders,
+		annotations[hmc.ChartAnnotationControlPlaneProviders],
+		knownControlPlaneProviders)
+	metadata.Warnings = append(metadata.Warnings, warnings...)
+	return metadata, nil
+}
+
+// validateChartAnnotations returns an error if the chart has annotations with
+// the hmc.mirantis.com prefix which are not recognized by HMC.
+func validateChartAnnotations(annotations map[string]string) error {
+	var unknown []string
+	for key := range annotations {
+		if !strings.HasPrefix(key, hmc.ChartAnnotationPrefix) {
+			continue
+		}
+		if !slices.Contains(knownChartAnnotations, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	return fmt.Errorf("unknown chart annotations [%s]: supported annotations are [%s]",
+		strings.Join(unknown, ", "), strings.Join(knownChartAnnotations, ", "))
+}
+
+// parseProviders returns the normalized list of providers of the given kind.
+// The value in spec has higher priority than the chart annotation.
+// Names which are missing in the registry of known providers are reported as warnings.
+func parseProviders(kind string, fromSpec []string, fromAnnotation string, known []string) (providers, warnings []string) {
+	providers = parseList(fromSpec, fromAnnotation)
+	for _, name := range providers {
+		if !slices.Contains(known, name) {
+			warnings = append(warnings, fmt.Sprintf("unknown %s provider %q", kind, name))
+		}
+	}
+	return providers, warnings
+}
+
+// parseList returns the list from spec or, if it is empty, the comma-separated
+// list from the chart annotation. The names are trimmed and deduplicated.
+func parseList(fromSpec []string, fromAnnotation string) (result []string) {
+	raw := fromSpec
+	if len(raw) == 0 && fromAnnotation != "" {
+		raw = strings.Split(fromAnnotation, ",")
+	}
+	for _, name := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(result, name) {
+			continue
+		}
+		result = append(result, name)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatechart
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"helm.sh/helm/v3/pkg/chart"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+var _ = Describe("Template chart metadata", func() {
+	It("should parse the metadata from the chart annotations", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		metadata, err := ParseMetadata(helmChart, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.Type).To(Equal(hmc.TemplateTypeDeployment))
+		Expect(metadata.Providers.InfrastructureProviders).To(Equal([]string{"aws"}))
+		Expect(metadata.Providers.BootstrapProviders).To(Equal([]string{"k0s"}))
+		Expect(metadata.Providers.ControlPlaneProviders).To(Equal([]string{"k0smotron", "custom"}))
+		Expect(metadata.GlobalValues).To(BeTrue())
+		Expect(metadata.Warnings).To(ConsistOf(`unknown control plane provider "custom"`))
+	})
+
+	It("should prefer the values of the Template spec", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		metadata, err := ParseMetadata(helmChart, &hmc.TemplateSpec{
+			Type:      hmc.TemplateTypeProvider,
+			DependsOn: []string{"cluster-api", " cluster-api "},
+			Providers: hmc.Providers{InfrastructureProviders: []string{"azure"}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.Type).To(Equal(hmc.TemplateTypeProvider))
+		Expect(metadata.DependsOn).To(Equal([]string{"cluster-api"}))
+		Expect(metadata.Providers.InfrastructureProviders).To(Equal([]string{"azure"}))
+		Expect(metadata.Providers.BootstrapProviders).To(Equal([]string{"k0s"}))
+	})
+
+	DescribeTable("should reject the invalid metadata",
+		func(annotations map[string]string, errMsg string) {
+			_, err := ParseMetadata(&chart.Chart{Metadata: &chart.Metadata{Annotations: annotations}}, nil)
+			Expect(err).To(MatchError(ContainSubstring(errMsg)))
+		},
+		Entry("missing type", map[string]string{}, "template type is not supported"),
+		Entry("unknown type", map[string]string{hmc.ChartAnnotationType: "cluster"}, "template type is not supported"),
+		Entry("unknown annotation", map[string]string{
+			hmc.ChartAnnotationType:      "deployment",
+			"hmc.mirantis.com/providers": "aws",
+		}, "unknown chart annotations [hmc.mirantis.com/providers]"),
+		Entry("invalid global values", map[string]string{
+			hmc.ChartAnnotationType:         "deployment",
+			hmc.ChartAnnotationGlobalValues: "yes",
+		}, `invalid value "yes" of the chart annotation hmc.mirantis.com/global-values`),
+	)
+
+	It("should reject the chart without metadata", func() {
+		_, err := ParseMetadata(&chart.Chart{}, nil)
+		Expect(err).To(MatchError("chart metadata is empty"))
+	})
+
+	It("should report the charts failed to load", func() {
+		_, err := Load("testdata/missing")
+		Expect(err).To(MatchError(ContainSubstring("failed to load chart testdata/missing")))
+	})
+})
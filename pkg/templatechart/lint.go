@@ -0,0 +1,100 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatechart
+
+import (
+	"context"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+// LintResult is the result of the linting of a chart.
+type LintResult struct {
+	// Metadata is the HMC metadata of the chart, nil if it can not be parsed.
+	Metadata *Metadata
+	// Errors are the issues making the chart unusable as a Template.
+	Errors []string
+	// Warnings are the issues which do not prevent the chart from being used.
+	Warnings []string
+}
+
+// Failed returns whether the chart has errors.
+func (r *LintResult) Failed() bool {
+	return len(r.Errors) > 0
+}
+
+// Lint checks the chart directory or .tgz archive with the Helm linter, parses
+// its HMC metadata and renders it with the values of the options, the way HMC
+// validates the Template and the Deployments using it. The returned error
+// reports the failures of the linting itself, the issues of the chart are
+// reported in the result.
+func Lint(ctx context.Context, path string, opts RenderOptions) (*LintResult, error) {
+	result := &LintResult{}
+
+	lint := action.NewLint()
+	lint.Namespace = opts.Namespace
+	if lint.Namespace == "" {
+		lint.Namespace = DefaultNamespace
+	}
+	if opts.KubeVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kubernetes version %q: %w", opts.KubeVersion, err)
+		}
+		lint.KubeVersion = kubeVersion
+	}
+	values := opts.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	helmResult := lint.Run([]string{path}, values)
+	for _, msg := range helmResult.Messages {
+		if msg.Severity == support.WarningSev {
+			result.Warnings = append(result.Warnings, msg.Error())
+		}
+	}
+	for _, err := range helmResult.Errors {
+		result.Errors = append(result.Errors, err.Error())
+	}
+
+	helmChart, err := Load(path)
+	if err != nil {
+		if len(result.Errors) == 0 {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		return result, nil
+	}
+	metadata, err := ParseMetadata(helmChart, nil)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("invalid HMC metadata: %s", err))
+	} else {
+		result.Metadata = metadata
+		result.Warnings = append(result.Warnings, metadata.Warnings...)
+	}
+	if err := helmChart.Validate(); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("invalid chart: %s", err))
+	}
+	if len(helmResult.Errors) > 0 {
+		// the rendering errors are already reported by the Helm linter
+		return result, nil
+	}
+	if _, err := Render(ctx, helmChart, opts); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to render chart: %s", err))
+	}
+	return result, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatechart
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	hmc "github.com/Mirantis/hmc/api/v1alpha1"
+)
+
+var _ = Describe("Template chart linting", func() {
+	ctx := context.Background()
+
+	It("should accept the valid chart", func() {
+		result, err := Lint(ctx, "testdata/cluster", RenderOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Failed()).To(BeFalse(), "errors: %v", result.Errors)
+		Expect(result.Metadata.Type).To(Equal(hmc.TemplateTypeDeployment))
+		Expect(result.Warnings).To(ContainElement(`unknown control plane provider "custom"`))
+	})
+
+	It("should report the values not matching the schema", func() {
+		result, err := Lint(ctx, "testdata/cluster", RenderOptions{Values: map[string]interface{}{"replicas": 0}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Failed()).To(BeTrue())
+		Expect(result.Errors).To(ContainElement(ContainSubstring("replicas")))
+	})
+
+	It("should report the invalid metadata and templates", func() {
+		result, err := Lint(ctx, "testdata/invalid", RenderOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Failed()).To(BeTrue())
+		Expect(result.Metadata).To(BeNil())
+		Expect(result.Errors).To(ContainElement(ContainSubstring("invalid HMC metadata: unknown chart annotations")))
+		Expect(result.Errors).To(ContainElement(ContainSubstring("unknownFunction")))
+	})
+
+	It("should report the charts failed to load", func() {
+		result, err := Lint(ctx, "testdata/missing", RenderOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Failed()).To(BeTrue())
+	})
+
+	It("should fail on the invalid Kubernetes versions", func() {
+		_, err := Lint(ctx, "testdata/cluster", RenderOptions{KubeVersion: "latest"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid Kubernetes version "latest"`)))
+	})
+})
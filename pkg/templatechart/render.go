@@ -0,0 +1,78 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatechart
+
+import (
+	"context"
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const (
+	// DefaultReleaseName is the name of the release used if not set in the RenderOptions.
+	DefaultReleaseName = "release-name"
+	// DefaultNamespace is the namespace of the release used if not set in the RenderOptions.
+	DefaultNamespace = "default"
+)
+
+// RenderOptions configures the rendering of a chart.
+type RenderOptions struct {
+	// ReleaseName is the name of the release.
+	ReleaseName string
+	// Namespace is the namespace of the release.
+	Namespace string
+	// Values are the values of the release merged over the chart values.
+	Values map[string]interface{}
+	// KubeVersion is the Kubernetes version the chart is rendered for, the
+	// default version of the Helm SDK is used if not set.
+	KubeVersion string
+	// APIVersions are the additional API versions available to the chart
+	// through the .Capabilities.APIVersions.
+	APIVersions []string
+}
+
+// Render renders the chart with the values the same way Helm installs it,
+// including the validation of the values against the values schema. The
+// cluster is not contacted, so the lookup function returns empty results.
+func Render(ctx context.Context, helmChart *chart.Chart, opts RenderOptions) (*release.Release, error) {
+	install := action.NewInstall(&action.Configuration{Log: func(string, ...interface{}) {}})
+	install.DryRun = true
+	install.ClientOnly = true
+	install.ReleaseName = opts.ReleaseName
+	if install.ReleaseName == "" {
+		install.ReleaseName = DefaultReleaseName
+	}
+	install.Namespace = opts.Namespace
+	if install.Namespace == "" {
+		install.Namespace = DefaultNamespace
+	}
+	install.APIVersions = opts.APIVersions
+	if opts.KubeVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Kubernetes version %q: %w", opts.KubeVersion, err)
+		}
+		install.KubeVersion = kubeVersion
+	}
+	values := opts.Values
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	return install.RunWithContext(ctx, helmChart, values)
+}
@@ -0,0 +1,75 @@
+// Copyright 2024
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templatechart
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Template chart rendering", func() {
+	ctx := context.Background()
+
+	It("should render the chart with the default options", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		rel, err := Render(ctx, helmChart, RenderOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Name).To(Equal(DefaultReleaseName))
+		Expect(rel.Namespace).To(Equal(DefaultNamespace))
+		Expect(rel.Manifest).To(ContainSubstring("name: release-name"))
+		Expect(rel.Manifest).To(ContainSubstring(`replicas: "1"`))
+		Expect(rel.Manifest).NotTo(ContainSubstring("capa"))
+	})
+
+	It("should render the chart with the options", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		rel, err := Render(ctx, helmChart, RenderOptions{
+			ReleaseName: "cluster",
+			Namespace:   "tenant",
+			Values:      map[string]interface{}{"replicas": 3},
+			KubeVersion: "v1.30.2",
+			APIVersions: []string{"infrastructure.cluster.x-k8s.io/v1beta2"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rel.Manifest).To(ContainSubstring("name: cluster"))
+		Expect(rel.Manifest).To(ContainSubstring("namespace: tenant"))
+		Expect(rel.Manifest).To(ContainSubstring(`replicas: "3"`))
+		Expect(rel.Manifest).To(ContainSubstring(`region: "us-east-2"`))
+		Expect(rel.Manifest).To(ContainSubstring(`kubeVersion: "v1.30.2"`))
+		Expect(rel.Manifest).To(ContainSubstring(`capa: "true"`))
+	})
+
+	It("should validate the values against the schema", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Render(ctx, helmChart, RenderOptions{Values: map[string]interface{}{"replicas": 0}})
+		Expect(err).To(MatchError(ContainSubstring("replicas")))
+	})
+
+	It("should reject the invalid Kubernetes versions", func() {
+		helmChart, err := Load("testdata/cluster")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Render(ctx, helmChart, RenderOptions{KubeVersion: "latest"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid Kubernetes version "latest"`)))
+	})
+})
@@ -92,3 +92,22 @@ The name of the webhook port. Must be no more than 15 characters
 {{- define "hmc.webhook.portName" -}}
 hmc-webhook
 {{- end }}
+
+{{/*
+The image of the controller manager, pulled from the registry mirror if configured
+*/}}
+{{- define "hmc.manager.image" -}}
+{{- $repository := .Values.controllerManager.manager.image.repository }}
+{{- $parts := splitList "/" $repository }}
+{{- with get .Values.global.hmc.registryMirrors (first $parts) }}
+{{- $repository = printf "%s/%s" . (join "/" (rest $parts)) }}
+{{- end }}
+{{- printf "%s:%s" $repository (.Values.controllerManager.manager.image.tag | default .Chart.AppVersion) }}
+{{- end }}
+
+{{/*
+The name of the ConfigMap with the trusted CA certificates
+*/}}
+{{- define "hmc.trustedCAs.name" -}}
+{{ include "hmc.fullname" . }}-trusted-cas
+{{- end }}